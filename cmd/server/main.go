@@ -1,147 +1,917 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"os/signal"
 	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	gkc "github.com/anselm94/googlekeepclone"
 	gkcserver "github.com/anselm94/googlekeepclone/server"
+	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 	"github.com/volatiletech/authboss/v3"
-	_ "github.com/volatiletech/authboss/v3/auth" // Adds Login support
+	_ "github.com/volatiletech/authboss/v3/auth"    // Adds Login support
+	_ "github.com/volatiletech/authboss/v3/confirm" // Adds Confirm support
 	"github.com/volatiletech/authboss/v3/defaults"
+	"github.com/volatiletech/authboss/v3/lock"       // Adds Lock support
 	_ "github.com/volatiletech/authboss/v3/logout"   // Adds Logout support
+	_ "github.com/volatiletech/authboss/v3/recover"  // Adds Recover support
 	_ "github.com/volatiletech/authboss/v3/register" // Adds Register support
+	"github.com/volatiletech/authboss/v3/remember"   // Adds Remember Me support
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 )
 
+// trashRetention is how long a deleted todo is kept in trash before purging
+const trashRetention = 7 * 24 * time.Hour
+
+// authEventPurgeInterval is how often the auth events older than the retention are purged
+const authEventPurgeInterval = 24 * time.Hour
+
+// reminderInterval is how often the due reminders are looked up
+const reminderInterval = time.Minute
+
+// requestIDPattern matches the request IDs, which are taken as is from 'X-Request-ID'
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// The rules of the user details, when registering or changing them
 var (
-	config *gkc.AppConfig
-	db     *gorm.DB
+	emailRule = defaults.Rules{
+		FieldName: "email", Required: false,
+		MatchError: "Must be a valid e-mail address",
+		MustMatch:  regexp.MustCompile(`.*@.*\.[a-z]+`),
+	}
+	passwordRule = defaults.Rules{
+		FieldName: "password", Required: true,
+		MinLength: 4,
+	}
+	nameRule = defaults.Rules{
+		FieldName: "name", Required: false,
+		AllowWhitespace: true,
+		MinLength:       2,
+	}
+)
+
+var (
+	config   *gkc.AppConfig
+	logger   *gkcserver.Logger
+	db       *gorm.DB
+	blobs    gkcserver.BlobStore
+	auditLog *gkcserver.AuditLog
 )
 
 func main() {
+	seed := flag.Bool("seed", false, "create a demo user with a board of todos & labels, for development only")
+	flag.Parse()
+
 	config = gkc.DefaultAppConfig()
+	logLevel, _ := gkcserver.ParseLogLevel(config.LogLevel)
+	logger = gkcserver.NewLogger(logLevel)
 
 	db = setupDB()
 	defer db.Close()
+	if config.AttachmentStore == "s3" {
+		blobs = gkcserver.NewS3Store(config.S3Endpoint, config.S3Bucket, config.S3Region, config.S3AccessKeyID, config.S3SecretAccessKey)
+	} else {
+		blobs = gkcserver.NewLocalStore(config.AttachmentDir)
+	}
+	if *seed {
+		seedDB()
+		return
+	}
+	if config.MetricsEnabled {
+		gkcserver.RegisterDBMetrics(db)
+	}
+
+	auditLog = gkcserver.NewAuditLog(db, config.TrustedProxies, logger)
+
+	go runTrashPurge()
+	go runAuthEventPurge()
+	if config.DBDriver == "sqlite3" { // The DB servers are rather maintained & backed up on their own
+		go runDBMaintenance()
+	}
+
+	var searchIndex *gkcserver.SearchIndex
+	if config.DBDriver == "sqlite3" {
+		var err error
+		if searchIndex, err = gkcserver.NewSearchIndex(db); err != nil {
+			logger.Warnf("Full-text search is unavailable, falling back to the basic search -> %s", err)
+			searchIndex = nil
+		}
+	}
 
 	ab := setupAuthboss()
 
+	handlerLogging := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(recorder, r)
+			requestLogger := logger.WithContext(r.Context())
+			if recorder.status >= http.StatusInternalServerError {
+				requestLogger.Errorf("%s %s -> %d in %s", r.Method, r.URL.Path, recorder.status, time.Since(start))
+			} else {
+				requestLogger.Debugf("%s %s -> %d in %s", r.Method, r.URL.Path, recorder.status, time.Since(start))
+			}
+		})
+	}
+
+	handlerRequestID := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get("X-Request-ID")
+			if !requestIDPattern.MatchString(requestID) { // Only the sane IDs of a proxy are kept, as they end up in the logs
+				requestID, _ = gonanoid.New()
+			}
+			w.Header().Set("X-Request-ID", requestID)
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), gkcserver.CtxRequestIDKey, requestID)))
+		})
+	}
+
+	handlerMetrics := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(recorder, r)
+			route, _ := mux.CurrentRoute(r).GetPathTemplate() // the template keeps the label values few
+			gkcserver.ObserveRequest(route, r.Method, recorder.status, time.Since(start))
+		})
+	}
+
 	handlerUserContext := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			userID, _ := ab.CurrentUserID(r)
-			userID = url.QueryEscape(userID) // Encode the email, so it's available as userID
-			ctx = context.WithValue(ctx, gkcserver.CtxUserIDKey, userID)
+			// The PID in session is the provider's for OAuth2 logins, or the email as entered on logging in, which may be
+			// of another casing than registered. So the userID is rather of the user it loads
+			userID := ""
+			if user, err := ab.CurrentUser(r); err == nil {
+				userID = url.QueryEscape(user.GetPID()) // Encode the email, so it's available as userID
+				if !isSessionCurrent(user.(*gkcserver.User), w, r) {
+					authboss.DelKnownSession(w) // logged out everywhere since the login
+					userID = ""
+				}
+			}
+			if userID != "" { // Anonymous requests carry no user ID at all, rather than an empty one
+				ctx = context.WithValue(ctx, gkcserver.CtxUserIDKey, userID)
+			}
 			h.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 
+	handlerConfirmed := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !config.IsMailEnabled() {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if user, err := ab.CurrentUser(r); err == nil && !authboss.MustBeConfirmable(user).GetConfirmed() {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"errors":[{"message":"%s"}],"data":null}`, gkcserver.MsgNotConfirmed)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	handlerUnlocked := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, err := ab.CurrentUser(r); err == nil && lock.IsLocked(authboss.MustBeLockable(user)) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"errors":[{"message":"%s"}],"data":null}`, gkcserver.MsgLocked)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	// sessionUser is the user of the session cookie, whose value is sent other than as a cookie, like along with
+	// the 'connection_init' of a websocket. It goes through the same checks as the cookies of the requests. The
+	// request is new, as gorilla/sessions keeps the sessions read in the context, like those of the upgrade
+	sessionUser := func(cookie string) string {
+		if cookie == "" {
+			return ""
+		}
+		r, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			return ""
+		}
+		r.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: cookie})
+		userID := ""
+		handlerUser := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ = r.Context().Value(gkcserver.CtxUserIDKey).(string)
+		})
+		ab.LoadClientStateMiddleware(handlerUserContext(handlerUnlocked(handlerConfirmed(handlerUser)))).ServeHTTP(httptest.NewRecorder(), r)
+		return userID
+	}
+
+	csrfKey, err := gkc.DecodeStoreKey(config.CSRFKey)
+	if err != nil {
+		logger.Fatalf("Error while decoding CSRF key -> %s", err)
+	}
+	// The state changing requests carry the token in the 'X-CSRF-Token' header or the 'gorilla.csrf.Token' form
+	// field, which matches the secret in the CSRF cookie
+	csrfProtect := csrf.Protect(csrfKey,
+		csrf.CookieName("gkc_csrf"),
+		csrf.Path("/"),
+		csrf.MaxAge(int(config.CookieMaxAge.Seconds())),
+		csrf.Secure(config.IsProd || config.IsTLSEnabled()),
+		csrf.SameSite(csrf.SameSiteMode(config.CookieSameSite)),
+		csrf.RequestHeader("X-CSRF-Token"),
+		csrf.ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.WithContext(r.Context()).Warnf("Request rejected -> %s", csrf.FailureReason(r))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `{"errors":[{"message":"%s"}],"data":null}`, gkcserver.MsgCSRFInvalid)
+		})),
+	)
+
+	// handlerCSRF protects the GraphQL requests of the signed in users, whose session cookie is sent along
+	handlerCSRF := func(h http.Handler) http.Handler {
+		protected := csrfProtect(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID, _ := r.Context().Value(gkcserver.CtxUserIDKey).(string); userID != "" {
+				protected.ServeHTTP(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	handlerCSRFToken := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, `{"token":"%s"}`, csrf.Token(r))
+	}
+
+	handlerLiveness := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "ok")
+	}
+
+	handlerReadiness := func(w http.ResponseWriter, r *http.Request) {
+		if err := db.DB().PingContext(r.Context()); err != nil {
+			logger.Errorf("Error while pinging DB -> %s", err)
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "ok")
+	}
+
+	handlerStatic := gkcserver.NewStaticHandler(config.StaticDir)
+
 	handlerCors := cors.New(cors.Options{
-		AllowedOrigins: []string{
-			config.AppHost.String(),
-		},
+		AllowOriginFunc:  config.IsOriginAllowed,
+		AllowedMethods:   config.AllowedMethods,
+		AllowedHeaders:   append([]string{"Origin", "Accept", "Content-Type", "X-Requested-With", "X-CSRF-Token", gkcserver.SourceDeviceHeader}, config.AllowedHeaders...),
 		AllowCredentials: true,
 	}).Handler
 
-	handlerGraphQL := handler.NewDefaultServer(
+	websockets := gkcserver.NewWebsocketConns(config.WSMaxConnsPerUser, config.WSMaxLifetime, config.WSIdleTimeout, config.WSMaxMessageSize)
+
+	authLimiter := gkcserver.NewRateLimiter(config.AuthRateLimit, config.TrustedProxies)
+	queryLimiter := gkcserver.NewRateLimiter(config.QueryRateLimit, config.TrustedProxies)
+
+	reminders := gkcserver.NewReminderHub()
+	webhooks := gkcserver.NewWebhookDispatcher(db, config.WebhookPrivateIPs, logger)
+	go runReminders(reminders, webhooks)
+
+	handlerGraphQL := handler.New(
 		gkcserver.NewExecutableSchema(gkcserver.Config{
 			Resolvers: &gkcserver.Resolver{
-				DB: db,
+				DB:                db,
+				Reminders:         reminders,
+				TodoEvents:        gkcserver.NewTodoHub(db),
+				LabelEvents:       gkcserver.NewLabelHub(db),
+				Presence:          gkcserver.NewPresenceHub(),
+				Undos:             gkcserver.NewUndoLog(config.UndoWindow),
+				Idempotency:       gkcserver.NewIdempotencyLog(config.IdempotencyWindow),
+				SearchIndex:       searchIndex,
+				AuditLog:          auditLog,
+				Blobs:             blobs,
+				MaxAttachmentSize: config.MaxAttachmentSize,
+				RevisionLimit:     config.RevisionLimit,
+				Auth:              ab,
+				EmailRule:         emailRule,
+				PasswordRule:      passwordRule,
+				NameRule:          nameRule,
+				Limits: gkcserver.Limits{
+					MaxTitleLength: config.MaxTitleLength,
+					MaxNoteLength:  config.MaxNoteLength,
+					MaxNotes:       config.MaxNotes,
+					MaxLabels:      config.MaxLabels,
+				},
+				Quota: gkcserver.Quota{
+					MaxTodos:           config.QuotaTodos,
+					MaxAttachmentBytes: config.QuotaBytes,
+				},
 			},
+			Directives: gkcserver.NewDirectiveRoot(db),
+			Complexity: gkcserver.NewComplexityRoot(),
 		}),
 	)
+	handlerGraphQL.AddTransport(transport.Websocket{
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || config.IsOriginAllowed(origin) // non-browser clients send no origin
+			},
+			ReadBufferSize: 4096, // reads through the hijacked connection, for its idle timeout & message size limit
+		},
+		KeepAlivePingInterval: config.WSKeepAlive,
+		InitFunc: func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			// The user is resolved from the session cookie of the upgrade request, so that
+			// subscriptions only ever stream the changes of the owning user. The clients, which
+			// can't send the cookie along with the upgrade, send its value in the payload instead
+			userID, _ := ctx.Value(gkcserver.CtxUserIDKey).(string)
+			if userID == "" {
+				userID = sessionUser(initPayload.GetString("sessionToken"))
+			}
+			if userID == "" {
+				return nil, errors.New(gkcserver.MsgNotAuthenticated)
+			}
+			ctx = context.WithValue(ctx, gkcserver.CtxUserIDKey, userID)
+			logger.WithContext(ctx).Debugf("Websocket connection initialised") // its subscriptions log with the request ID of the upgrade
+			return ctx, nil
+		},
+	})
+	handlerGraphQL.AroundResponses(func(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+		response := next(ctx)
+		if response != nil && len(response.Errors) > 0 {
+			logger.WithContext(ctx).Warnf("Error while resolving query -> %s", strings.TrimSpace(response.Errors.Error()))
+		}
+		return response
+	})
+	if config.MetricsEnabled {
+		handlerGraphQL.AroundFields(func(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+			field := graphql.GetFieldContext(ctx)
+			if !field.IsResolver {
+				return next(ctx) // plain struct fields aren't worth timing
+			}
+			start := time.Now()
+			res, err := next(ctx)
+			gkcserver.ObserveResolver(field.Object, field.Field.Name, time.Since(start))
+			return res, err
+		})
+	}
+	if config.IsProd {
+		// The internal errors are logged in full, but the clients only get the request ID to report
+		handlerGraphQL.SetErrorPresenter(func(ctx context.Context, err error) *gqlerror.Error {
+			if gkcserver.IsUserError(err) {
+				return graphql.DefaultErrorPresenter(ctx, err)
+			}
+			requestID, _ := ctx.Value(gkcserver.CtxRequestIDKey).(string)
+			logger.WithContext(ctx).Errorf("Internal error while resolving -> %s", err)
+			return &gqlerror.Error{
+				Message:    "internal system error",
+				Path:       graphql.GetPath(ctx),
+				Extensions: map[string]interface{}{"code": "INTERNAL", "requestId": requestID},
+			}
+		})
+	}
+	handlerGraphQL.SetRecoverFunc(func(ctx context.Context, err interface{}) error {
+		logger.WithContext(ctx).Errorf("Panic while resolving -> %v\n%s", err, debug.Stack())
+		return errors.New("internal system error")
+	})
+	handlerGraphQL.AddTransport(transport.Options{})
+	handlerGraphQL.AddTransport(transport.GET{})
+	handlerGraphQL.AddTransport(transport.POST{})
+	handlerGraphQL.AddTransport(transport.MultipartForm{
+		MaxUploadSize: config.MaxAttachmentSize + 1<<20, // room for the 'operations' & 'map' parts
+	})
+	handlerGraphQL.SetQueryCache(lru.New(1000))
+	if config.Introspectable {
+		handlerGraphQL.Use(extension.Introspection{}) // without it, the introspection queries are rejected
+	}
+	handlerGraphQL.Use(extension.FixedComplexityLimit(config.ComplexityLimit))
+	handlerGraphQL.Use(gkcserver.DepthLimit{Limit: config.DepthLimit})
+	handlerGraphQL.Use(gkcserver.QueryTimeout{DB: db, Timeout: config.QueryTimeout})
+	handlerGraphQL.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
 
-	log.Println("Setting up routes ...")
+	logger.Infof("Setting up routes ...")
 	router := mux.NewRouter()
-	router.Use(handlerCors, ab.LoadClientStateMiddleware, handlerUserContext)
-	router.Path("/playground").Handler(playground.Handler("Playground", "/query"))
-	router.PathPrefix("/query").Handler(handlerGraphQL)
-	router.PathPrefix("/auth").Handler(http.StripPrefix("/auth", ab.Config.Core.Router))
+	router.Use(handlerRequestID, auditLog.Middleware, handlerCors, ab.LoadClientStateMiddleware, remember.Middleware(ab), handlerUserContext, handlerLogging)
+	if config.CompressionEnabled {
+		router.Use(gkcserver.Compress)
+	}
+	if config.MetricsEnabled {
+		router.Use(handlerMetrics)
+		if config.MetricsPort == "" {
+			router.Path("/metrics").Handler(promhttp.Handler())
+		}
+	}
+	router.Path("/healthz").HandlerFunc(handlerLiveness)
+	router.Path("/readyz").HandlerFunc(handlerReadiness)
+	if config.PlaygroundEnabled {
+		router.Path("/playground").Handler(playground.Handler("Playground", "/query"))
+	}
+	router.Path("/csrf").Handler(csrfProtect(http.HandlerFunc(handlerCSRFToken)))
+	router.PathPrefix("/query").Handler(queryLimiter.Middleware(websockets.Track(handlerCSRF(handlerUnlocked(handlerConfirmed(gkcserver.ClientDevice(handlerGraphQL)))))))
+	router.Path("/attachments/{id}").Handler(handlerUnlocked(handlerConfirmed(gkcserver.NewAttachmentHandler(db, blobs))))
+	router.Path("/export").Handler(handlerUnlocked(handlerConfirmed(gkcserver.NewExportHandler(db))))
+	handlerAuth := http.StripPrefix("/auth", ab.Config.Core.Router)
+	router.Path("/auth/login").Methods(http.MethodPost).Handler(authLimiter.Middleware(csrfProtect(auditLog.RecordFailedLogins(handlerAuth))))
+	router.PathPrefix("/auth").Handler(authLimiter.Middleware(csrfProtect(handlerAuth)))
 	router.PathPrefix("/login").Handler(http.RedirectHandler("/", http.StatusMovedPermanently))    // handled by SPA client router
 	router.PathPrefix("/register").Handler(http.RedirectHandler("/", http.StatusMovedPermanently)) // handled by SPA client router
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir(config.StaticDir)))
-	log.Println("Route setup complete")
+	router.PathPrefix("/").Handler(handlerStatic)                                                  // the routes of the SPA client router, like '/confirm' & '/recover', get the index
+	logger.Infof("Route setup complete")
 
-	log.Printf("Starting and listening server at %s", config.AppHost)
-	log.Fatalf("Error running server -> %s", http.ListenAndServe(fmt.Sprintf(":%s", config.AppHost.Port()), router))
+	// Cancelling the base context ends the subscriptions, which watch the request context
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        fmt.Sprintf(":%s", config.Port),
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	if config.MetricsEnabled && config.MetricsPort != "" {
+		go func() {
+			logger.Infof("Serving metrics at port %s", config.MetricsPort)
+			metricsRouter := http.NewServeMux()
+			metricsRouter.Handle("/metrics", promhttp.Handler())
+			logger.Errorf("Error serving metrics -> %s", http.ListenAndServe(fmt.Sprintf(":%s", config.MetricsPort), metricsRouter))
+		}()
+	}
+	if config.HTTPRedirectPort != "" {
+		go func() {
+			logger.Infof("Redirecting plain HTTP at port %s to HTTPS", config.HTTPRedirectPort)
+			redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				target := *config.AppHost
+				target.Path = r.URL.Path
+				target.RawQuery = r.URL.RawQuery
+				http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+			})
+			logger.Errorf("Error running HTTP redirect -> %s", http.ListenAndServe(fmt.Sprintf(":%s", config.HTTPRedirectPort), redirect))
+		}()
+	}
+	go func() {
+		logger.Infof("Starting and listening server at %s", config.AppHost)
+		var err error
+		if config.IsTLSEnabled() {
+			err = server.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			logger.Fatalf("Error running server -> %s", err)
+		}
+	}()
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	<-signals.Done()
+	stopSignals() // a second signal kills the server right away
+
+	logger.Infof("Shutting down server, draining requests for up to %s ...", config.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Error while draining requests -> %s", err)
+	}
+	cancelBaseCtx()
+	logger.Infof("Closed %d websocket connections", websockets.CloseAll())
+	logger.Infof("Server shutdown complete")
 }
 
 func setupDB() *gorm.DB {
-	log.Println("Setting up SQLite 3 database ...")
-	db, err := gorm.Open("sqlite3", config.DBFile)
+	logger.Infof("Setting up %s database ...", config.DBDriver)
+	dsn := config.DBDSN
+	if config.DBDriver == "sqlite3" {
+		// SQLite has the foreign key support turned off by default. It's turned on in the DSN rather than with
+		// 'PRAGMA foreign_keys', which holds only for the one connection of the pool it runs on. Likewise the
+		// writers wait for the lock instead of failing with 'database is locked', and WAL lets the readers
+		// go on alongside a writer
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL"
+	}
+	db, err := gorm.Open(config.DBDriver, dsn)
 	if err != nil {
-		log.Fatalf("Error while setting up DB -> %s", err)
+		logger.Fatalf("Error while setting up DB -> %s", err)
 	}
-	db.Exec("PRAGMA foreign_keys = ON;")
-	log.Println("Database initialised")
-	db.AutoMigrate(&gkcserver.Todo{}, &gkcserver.Note{}, &gkcserver.Label{}, &gkcserver.User{})
-	log.Println("Database migration complete")
+	db.DB().SetMaxOpenConns(config.DBMaxOpenConns)
+	db.DB().SetMaxIdleConns(config.DBMaxIdleConns)
+	db.DB().SetConnMaxLifetime(config.DBConnMaxLifetime)
+	logger.Infof("Database initialised")
+	isNewDB := !db.HasTable(&gkcserver.User{})
+	isUntrackedReminders := db.HasTable(&gkcserver.Todo{}) && !db.Dialect().HasColumn("todos", "reminded_at")
+	// Referenced tables are migrated first, as Postgres & MySQL check the references while creating the tables
+	db.AutoMigrate(&gkcserver.User{}, &gkcserver.Label{}, &gkcserver.Todo{}, &gkcserver.Note{}, &gkcserver.TodoCollaborator{}, &gkcserver.Attachment{}, &gkcserver.TodoRevision{}, &gkcserver.RememberToken{}, &gkcserver.AuthEvent{}, &gkcserver.Webhook{}, &gkcserver.TodoTemplate{})
+	if config.DBDriver == "mysql" && isNewDB { // MySQL ignores the inline 'REFERENCES', so add the foreign keys separately
+		db.Model(&gkcserver.Label{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.Todo{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.Note{}).AddForeignKey("todo_id", "todos(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.TodoCollaborator{}).AddForeignKey("todo_id", "todos(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.TodoCollaborator{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.Attachment{}).AddForeignKey("todo_id", "todos(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.TodoRevision{}).AddForeignKey("todo_id", "todos(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.Webhook{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+		db.Model(&gkcserver.TodoTemplate{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+	}
+	// Users registered before confirming existed are treated as confirmed
+	db.Model(&gkcserver.User{}).Where("confirmed IS NULL").UpdateColumn("confirmed", true)
+	// Users registered before the canonical PIDs existed log in whatever the casing of their emails, unless another's
+	// differs only in the casing, which is left for an admin to resolve
+	if conflicts, err := gkcserver.CanonicalizePIDs(db); err != nil {
+		logger.Errorf("Error while canonicalizing the emails of the users -> %s", err)
+	} else {
+		for _, userIDs := range conflicts {
+			logger.Warnf("Users %s have the emails differing only in the casing, so they log in with the casing registered", strings.Join(userIDs, ", "))
+		}
+	}
+	// Todos created before 'created_at' existed are treated as the oldest ones
+	db.Unscoped().Model(&gkcserver.Todo{}).Where("created_at IS NULL").UpdateColumn("created_at", time.Unix(0, 0))
+	// Rows created before the timestamps existed are treated as the oldest ones, last updated at their creation
+	db.Unscoped().Model(&gkcserver.Todo{}).Where("updated_at IS NULL").UpdateColumn("updated_at", gorm.Expr("created_at"))
+	db.Model(&gkcserver.Note{}).Where("created_at IS NULL").UpdateColumns(map[string]interface{}{"created_at": time.Unix(0, 0), "updated_at": time.Unix(0, 0)})
+	db.Model(&gkcserver.Label{}).Where("created_at IS NULL").UpdateColumns(map[string]interface{}{"created_at": time.Unix(0, 0), "updated_at": time.Unix(0, 0)})
+	// Colors given in another casing were stored as is, before they were stored as the palette keys
+	db.Unscoped().Model(&gkcserver.Todo{}).Where("color <> LOWER(color)").UpdateColumn("color", gorm.Expr("LOWER(color)"))
+	db.Model(&gkcserver.TodoTemplate{}).Where("color <> LOWER(color)").UpdateColumn("color", gorm.Expr("LOWER(color)"))
+	// Todos created before the devices were told came from an unknown one
+	db.Unscoped().Model(&gkcserver.Todo{}).Where("source_device IS NULL OR source_device = ''").UpdateColumn("source_device", "unknown")
+	// Todos created before the backgrounds existed have none
+	db.Unscoped().Model(&gkcserver.Todo{}).Where("background IS NULL OR background = ''").UpdateColumn("background", "none")
+	// Reminders fallen due before the delivery was kept track of were delivered already
+	if isUntrackedReminders {
+		db.Unscoped().Model(&gkcserver.Todo{}).Where("remind_at <= ?", time.Now().UTC()).UpdateColumn("reminded_at", gorm.Expr("remind_at"))
+	}
+	// Todos created before the order existed keep the order of their creation
+	unordered := []*gkcserver.Todo{}
+	db.Unscoped().Where("order_index IS NULL").Find(&unordered)
+	for _, todo := range unordered {
+		db.Unscoped().Model(todo).UpdateColumn("order_index", float64(todo.CreatedAt.UnixNano())/float64(time.Second))
+	}
+	logger.Infof("Database migration complete")
 	return db
 }
 
+// seedDB creates the demo user & its board, which is meant for the development only. Its well-known
+// password is never to be seeded in production
+func seedDB() {
+	if config.IsProd {
+		logger.Fatalf("Refusing to seed the demo data in production")
+	}
+	created, err := gkcserver.Seed(db, config.SeedEmail, config.SeedName, config.SeedPassword)
+	if err != nil {
+		logger.Fatalf("Error while seeding the demo data -> %s", err)
+	}
+	if !created {
+		logger.Infof("The demo user %s exists already, nothing is seeded", config.SeedEmail)
+		return
+	}
+	logger.Warnf("Seeded the demo user %s with the password '%s', for development only", config.SeedEmail, config.SeedPassword)
+}
+
+func runTrashPurge() {
+	logger.Infof("Purging trashed todos older than %s every %s", trashRetention, config.TrashPurgeInterval)
+	ticker := time.NewTicker(config.TrashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := purgeTrash(time.Now().Add(-trashRetention)); err != nil {
+			logger.Errorf("Error while purging trash -> %s", err)
+		}
+		<-ticker.C
+	}
+}
+
+func runAuthEventPurge() {
+	logger.Infof("Purging auth events older than %s every %s", config.AuthEventRetention, authEventPurgeInterval)
+	ticker := time.NewTicker(authEventPurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := auditLog.Purge(time.Now().Add(-config.AuthEventRetention)); err != nil {
+			logger.Errorf("Error while purging auth events -> %s", err)
+		}
+		<-ticker.C
+	}
+}
+
+func runDBMaintenance() {
+	logger.Infof("Compacting the database every %s", config.DBVacuumInterval)
+	ticker := time.NewTicker(config.DBVacuumInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		start := time.Now()
+		if err := gkcserver.VacuumSQLite(db); err != nil {
+			logger.Errorf("Error while compacting the database -> %s", err)
+		} else {
+			logger.Infof("Database compacted in %s", time.Since(start))
+		}
+		if config.BackupDir == "" {
+			continue
+		}
+		if path, err := gkcserver.BackupSQLite(db, config.BackupDir, config.BackupKeep); err != nil {
+			logger.Errorf("Error while backing up the database -> %s", err)
+		} else {
+			logger.Infof("Database backed up to %s", path)
+		}
+	}
+}
+
+func runReminders(reminders *gkcserver.ReminderHub, webhooks *gkcserver.WebhookDispatcher) {
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		todos, err := gkcserver.DueReminders(db, now)
+		if err != nil {
+			logger.Errorf("Error while looking up due reminders -> %s", err) // those not delivered are retried on the next tick
+		}
+		reminders.Notify(todos)
+		webhooks.Notify(todos)
+	}
+}
+
+func purgeTrash(before time.Time) error {
+	trashed := db.Unscoped().Model(&gkcserver.Todo{}).Where("deleted_at < ?", before).Select("id").QueryExpr()
+	// Join table rows, notes, collaborators, revisions and attachments are not soft-deleted, so clean them up along with the todos
+	if err := db.Exec("DELETE FROM todos_labels WHERE todo_id IN (?)", trashed).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("DELETE FROM notes WHERE todo_id IN (?)", trashed).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("DELETE FROM todo_collaborators WHERE todo_id IN (?)", trashed).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("DELETE FROM todo_revisions WHERE todo_id IN (?)", trashed).Error; err != nil {
+		return err
+	}
+	attachments := []*gkcserver.Attachment{}
+	if err := db.Where("todo_id IN (?)", trashed).Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := blobs.Delete(context.Background(), attachment.Path); err != nil {
+			return err
+		}
+	}
+	if err := db.Exec("DELETE FROM attachments WHERE todo_id IN (?)", trashed).Error; err != nil {
+		return err
+	}
+	return db.Unscoped().Where("deleted_at < ?", before).Delete(&gkcserver.Todo{}).Error
+}
+
 func setupAuthboss() *authboss.Authboss {
-	log.Println("Setting up authentication ...")
+	logger.Infof("Setting up authentication ...")
 	ab := authboss.New()
 	ab.Config.Paths.Mount = "/auth"
 	ab.Config.Paths.RootURL = config.AppHost.String()
 
-	cookieStoreKey, _ := base64.StdEncoding.DecodeString(config.CookieStoreKey)
-	sessionStoreKey, _ := base64.StdEncoding.DecodeString(config.SessionStoreKey)
+	cookieStoreKey, err := gkc.DecodeStoreKey(config.CookieStoreKey)
+	if err != nil {
+		logger.Fatalf("Error while decoding cookie store key -> %s", err)
+	}
+	sessionStoreKey, err := gkc.DecodeStoreKey(config.SessionStoreKey)
+	if err != nil {
+		logger.Fatalf("Error while decoding session store key -> %s", err)
+	}
 
-	ab.Config.Storage.Server = gkcserver.NewSQLiteStorer(db)
-	ab.Config.Storage.SessionState = gkcserver.NewSessionStorer(config.SessionCookieName, sessionStoreKey)
-	ab.Config.Storage.CookieState = gkcserver.NewCookieStorer(cookieStoreKey, config.IsProd)
+	templates, err := gkcserver.ReadTemplateSeeds(config.TemplatesFile)
+	if err != nil {
+		logger.Fatalf("Error while reading the templates to seed -> %s", err)
+	}
+	ab.Config.Storage.Server = gkcserver.NewDBStorer(db, templates)
+	ab.Config.Storage.SessionState = gkcserver.NewSessionStorer(config.SessionCookieName, sessionStoreKey, config.SessionMaxAge, config.CookieSameSite)
+	ab.Config.Storage.CookieState = gkcserver.NewCookieStorer(cookieStoreKey, config.IsProd || config.IsTLSEnabled(), config.CookieMaxAge, config.CookieSameSite)
 	ab.Config.Core.ViewRenderer = defaults.JSONRenderer{}
 
 	defaults.SetCore(&ab.Config, true, false)
+	ab.Config.Core.Logger = logger
+	ab.Config.Core.ErrorHandler = defaults.NewErrorHandler(logger)
 
 	ab.Config.Modules.LogoutMethod = "POST"
+	ab.Config.Modules.LockAfter = config.LockAfter
+	ab.Config.Modules.LockWindow = config.LockWindow
+	ab.Config.Modules.LockDuration = config.LockDuration
+	ab.Config.Modules.BCryptCost = config.BcryptCost
+
+	ab.Config.Core.MailRenderer = gkcserver.NewMailRenderer()
+	ab.Config.Core.Mailer = gkcserver.NewMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword)
+	ab.Config.Mail.RootURL = config.AppHost.String() // Links in e-mails are opened in the SPA
+	ab.Config.Mail.From = config.MailFrom
+	ab.Config.Mail.FromName = "Google Keep Clone"
+
+	if config.GoogleClientID != "" {
+		ab.Config.Modules.OAuth2Providers = map[string]authboss.OAuth2Provider{
+			"google": {
+				OAuth2Config: &oauth2.Config{
+					ClientID:     config.GoogleClientID,
+					ClientSecret: config.GoogleClientSecret,
+					Scopes:       []string{"profile", "email"},
+					Endpoint:     google.Endpoint,
+				},
+				FindUserDetails: gkcserver.GoogleUserDetails,
+			},
+		}
+	}
 
 	redirector := defaults.NewRedirector(ab.Config.Core.ViewRenderer, authboss.FormValueRedirect)
 	redirector.CorceRedirectTo200 = true // Since using in API mode, map redirects to API
 	ab.Config.Core.Redirector = redirector
 
-	// Overriding the default bodyreader and making lenient
-	emailRule := defaults.Rules{
-		FieldName: "email", Required: false,
-		MatchError: "Must be a valid e-mail address",
-		MustMatch:  regexp.MustCompile(`.*@.*\.[a-z]+`),
+	// The durations allowed to keep signed in, as the body reader writes the one chosen. Empty is session-only too
+	signInDurations, signInPatterns := []string{}, []string{"", "0s"}
+	for _, duration := range config.SignInDurations {
+		signInDurations = append(signInDurations, duration.String())
+		signInPatterns = append(signInPatterns, regexp.QuoteMeta(duration.String()))
 	}
-	passwordRule := defaults.Rules{
-		FieldName: "password", Required: true,
-		MinLength: 4,
-	}
-	nameRule := defaults.Rules{
-		FieldName: "name", Required: false,
-		AllowWhitespace: true,
-		MinLength:       2,
+	keepSignedInRule := defaults.Rules{
+		FieldName: gkcserver.FormValueKeepSignedIn, Required: false,
+		MatchError: "Must be session-only or one of " + strings.Join(signInDurations, ", "),
+		MustMatch:  regexp.MustCompile(`^(` + strings.Join(signInPatterns, "|") + `)$`),
 	}
-	ab.Config.Core.BodyReader = defaults.HTTPBodyReader{
-		ReadJSON:    true,
-		UseUsername: false,
-		Rulesets: map[string][]defaults.Rules{
-			"login":    {emailRule},
-			"register": {emailRule, passwordRule, nameRule},
-		},
-		Whitelist: map[string][]string{ // for arbitrary values to not get filtered
-			"register": {"email", "name"},
+
+	// Overriding the default bodyreader and making lenient
+	ab.Config.Core.BodyReader = gkcserver.BodyReader{
+		HTTPBodyReader: defaults.HTTPBodyReader{
+			ReadJSON:    true,
+			UseUsername: false,
+			Rulesets: map[string][]defaults.Rules{
+				"login":         {emailRule, keepSignedInRule},
+				"register":      {emailRule, passwordRule, nameRule},
+				"recover_start": {emailRule},
+				"recover_end":   {passwordRule},
+			},
+			Whitelist: map[string][]string{ // for arbitrary values to not get filtered
+				"register": {"email", "name"},
+			},
 		},
 	}
 
-	if err := ab.Init(); err != nil {
-		log.Fatalf("Error while initialising Authboss -> %s", err)
+	modules := []string{"auth", "lock", "logout", "oauth2", "register", "remember"}
+	if config.IsMailEnabled() {
+		modules = append(modules, "confirm", "recover")
 	}
-	log.Println("Authentication setup complete")
+	if err := ab.Init(modules...); err != nil {
+		logger.Fatalf("Error while initialising Authboss -> %s", err)
+	}
+	// Logging out drops the 'remember me' cookie of this browser, but the tokens of all the other sessions are revoked too
+	ab.Events.Before(authboss.EventLogout, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		if user, err := ab.CurrentUser(r); err == nil {
+			return false, authboss.EnsureCanRemember(ab.Config.Storage.Server).DelRememberTokens(r.Context(), user.GetPID())
+		}
+		return false, nil
+	})
+	// The duration to keep signed in is checked by its rule alone, as authboss checks none at login. It's kept in
+	// the session, and alongside the 'remember me' cookie, whose storers expire the cookies after it
+	ab.Events.Before(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		values, ok := r.Context().Value(authboss.CTXKeyValues).(defaults.UserValues)
+		if !ok {
+			return false, nil
+		}
+		keepSignedIn := values.Values[gkcserver.FormValueKeepSignedIn]
+		if errs := keepSignedInRule.Errors(keepSignedIn); len(errs) > 0 {
+			data := authboss.HTMLData{authboss.DataValidation: authboss.ErrorMap(errs)}
+			return true, ab.Core.Responder.Respond(w, r, http.StatusOK, "login", data)
+		}
+		if keepSignedIn == "" && values.GetShouldRemember() {
+			return false, nil // 'remember me' alone, as before, is for COOKIE_MAX_AGE
+		}
+		if keepSignedIn == "" || keepSignedIn == "0s" {
+			authboss.PutSession(w, gkcserver.SessionKeepSignedInKey, "0s")
+			values.Values[authboss.CookieRemember] = "false"
+			if _, ok := authboss.GetCookie(r, authboss.CookieRemember); ok {
+				authboss.DelCookie(w, authboss.CookieRemember) // of an earlier login, which would outlast this one
+			}
+			return false, nil
+		}
+		authboss.PutSession(w, gkcserver.SessionKeepSignedInKey, keepSignedIn)
+		authboss.PutCookie(w, gkcserver.CookieKeepSignedIn, keepSignedIn)
+		values.Values[authboss.CookieRemember] = "true"
+		return false, nil
+	})
+	// The logins, logouts & password resets are recorded in the audit log. The failed logins are recorded
+	// by auditLog.RecordFailedLogins, as the unknown emails fire no event
+	recordAuthEvent := func(eventType gkcserver.AuthEventType) authboss.EventHandler {
+		return func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+			if user, ok := r.Context().Value(authboss.CTXKeyUser).(*gkcserver.User); ok {
+				auditLog.Record(r, eventType, user)
+			} else if user, err := ab.CurrentUser(r); err == nil {
+				auditLog.Record(r, eventType, user.(*gkcserver.User))
+			}
+			return false, nil
+		}
+	}
+	ab.Events.After(authboss.EventAuth, recordAuthEvent(gkcserver.AuthEventTypeLogin))
+	ab.Events.After(authboss.EventOAuth2, recordAuthEvent(gkcserver.AuthEventTypeLogin))
+	ab.Events.Before(authboss.EventLogout, recordAuthEvent(gkcserver.AuthEventTypeLogout))
+	ab.Events.After(authboss.EventRecoverEnd, recordAuthEvent(gkcserver.AuthEventTypePasswordChanged))
+	// The sessions keep the epoch of the user at login, so that they can be logged out everywhere by moving it on
+	putSessionEpoch := func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		if user, err := ab.CurrentUser(r); err == nil {
+			authboss.PutSession(w, gkcserver.SessionEpochKey, strconv.Itoa(user.(*gkcserver.User).SessionEpoch))
+		}
+		return false, nil
+	}
+	ab.Events.After(authboss.EventAuth, putSessionEpoch)
+	ab.Events.After(authboss.EventOAuth2, putSessionEpoch)
+	// The password hashed before the cost was raised is rehashed, while it's at hand on logging in
+	ab.Events.After(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		user, _ := r.Context().Value(authboss.CTXKeyUser).(*gkcserver.User)
+		values, _ := r.Context().Value(authboss.CTXKeyValues).(authboss.UserValuer)
+		if user != nil && values != nil && gkcserver.NeedsRehash(user.Password, config.BcryptCost) {
+			if err := gkcserver.RehashPassword(db, user, values.GetPassword(), config.BcryptCost); err != nil {
+				logger.Errorf("Error while rehashing the password of %s -> %s", user.Email, err)
+			}
+		}
+		return false, nil
+	})
+	if config.AdminFirstUser {
+		promoteFirstUser := func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+			if user, err := ab.CurrentUser(r); err == nil {
+				if err := gkcserver.PromoteFirstUser(db, user.(*gkcserver.User).ID); err != nil {
+					logger.Errorf("Error while promoting the first user to admin -> %s", err)
+				}
+			}
+			return false, nil
+		}
+		ab.Events.After(authboss.EventRegister, promoteFirstUser)
+		ab.Events.After(authboss.EventOAuth2, promoteFirstUser) // Signing up with Google is a registration too
+	}
+	logger.Infof("Authentication setup complete")
 	return ab
 }
+
+// isSessionCurrent tells whether the session of the user was logged in after the last logout everywhere. The
+// sessions logged in before the epochs existed are of the epoch 0
+func isSessionCurrent(user *gkcserver.User, w http.ResponseWriter, r *http.Request) bool {
+	epoch := strconv.Itoa(user.SessionEpoch)
+	if _, ok := authboss.GetSession(r, authboss.SessionKey); !ok {
+		// Just logged in by the 'remember me' token, which would have been revoked along with the older epoch
+		authboss.PutSession(w, gkcserver.SessionEpochKey, epoch)
+		return true
+	}
+	sessionEpoch, ok := authboss.GetSession(r, gkcserver.SessionEpochKey)
+	if !ok {
+		sessionEpoch = "0"
+	}
+	return sessionEpoch == epoch
+}
+
+// statusRecorder captures the status code of the response for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// UnderlyingResponseWriter lets authboss reach its client state writer below the recorder
+func (r *statusRecorder) UnderlyingResponseWriter() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack lets the websocket transport take over the connection
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush lets the streamed responses through
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
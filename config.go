@@ -1,69 +1,934 @@
 package googlekeepclone
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
 )
 
 // AppConfig holds the configuration for the application
 type AppConfig struct {
-	IsProd            bool
-	AppHost           *url.URL
-	DBFile            string
-	StaticDir         string
-	CookieStoreKey    string
-	SessionStoreKey   string
+	IsProd             bool
+	LogLevel           string
+	AppHost            *url.URL
+	Port               string   // listened at, that of the app host unless it's reached through a proxy
+	AllowedOrigins     []string // any origin is allowed, when empty. Those like 'https://*.example.com' match the subdomains
+	AllowedMethods     []string
+	AllowedHeaders     []string // along with those the app needs
+	DBDriver           string
+	DBDSN              string
+	DBMaxOpenConns     int
+	DBMaxIdleConns     int
+	DBConnMaxLifetime  time.Duration // connections are kept open forever, when 0
+	StaticDir          string
+	CookieStoreKey     string
+	SessionStoreKey    string
+	CSRFKey            string // derived from the session store key, when not set
+	TrashPurgeInterval time.Duration
+	DBVacuumInterval   time.Duration // of SQLite, which is backed up too into BackupDir, if given
+	BackupDir          string
+	BackupKeep         int // latest backups kept
+	GoogleClientID     string
+	GoogleClientSecret string
+	SMTPHost           string
+	SMTPPort           string
+	SMTPUsername       string
+	SMTPPassword       string
+	MailFrom           string
+	LockAfter          int
+	LockWindow         time.Duration
+	LockDuration       time.Duration
+	BcryptCost         int
+	AuthEventRetention time.Duration // of the audit log of logins, logouts & password changes
+	ShutdownTimeout    time.Duration
+	AttachmentDir      string
+	AttachmentStore    string // 'local' in AttachmentDir, or 's3' in S3Bucket
+	S3Endpoint         *url.URL
+	S3Region           string
+	S3Bucket           string
+	S3AccessKeyID      string
+	S3SecretAccessKey  string
+	MaxAttachmentSize  int64
+	RevisionLimit      int
+	UndoWindow         time.Duration
+	IdempotencyWindow  time.Duration
+	MaxTitleLength     int // in characters
+	MaxNoteLength      int // in characters, of each note
+	MaxNotes           int // per todo
+	MaxLabels          int // per todo
+	QuotaTodos         int
+	QuotaBytes         int64  // of the attachments
+	TrustedProxies     int    // in front of the server, whose entries of 'X-Forwarded-For' are trusted
+	AdminFirstUser     bool   // the first user registered becomes an admin
+	TemplatesFile      string // YAML list of the templates seeded for each user signing up, the built-in ones when empty
+	AuthRateLimit      int
+	QueryRateLimit     int
+	ComplexityLimit    int
+	DepthLimit         int
+	QueryTimeout       time.Duration
+	PlaygroundEnabled  bool
+	Introspectable     bool // the schema, by the introspection queries
+	WebhookPrivateIPs  bool // the webhooks may call the host & its network
+	MetricsEnabled     bool
+	CompressionEnabled bool // of the responses, with brotli or gzip
+	MetricsPort        string
+	TLSCertFile        string
+	TLSKeyFile         string
+	HTTPRedirectPort   string
+
+	// SessionCookieName is worth changing when other apps on the same domain use a cookie of the same name,
+	// as either would overwrite the other
 	SessionCookieName string
+	// SessionMaxAge is how long a session is valid after the login. Until then, a stolen session cookie
+	// is as good as the password, so the shorter, the safer
+	SessionMaxAge time.Duration
+	// CookieMaxAge is how long the 'remember me' cookie logs in again, once the session has expired. It
+	// outlives the session, so it extends the reach of a stolen cookie alike
+	CookieMaxAge time.Duration
+	// SignInDurations are how long the users may choose to keep signed in at login, besides session-only.
+	// The 'remember me' cookie expires after the duration chosen, rather than after CookieMaxAge
+	SignInDurations []time.Duration
+	// CookieSameSite is the 'SameSite' attribute of the session & 'remember me' cookies. 'Strict' keeps
+	// them from any request started by other sites, at the cost of following links into the app signed out.
+	// 'None' sends them along with the requests of any site, leaving the app open to forged requests
+	CookieSameSite http.SameSite
+	// WSKeepAlive is how often the websockets are sent a keep-alive message, which keeps the proxies
+	// in between from closing them as idle
+	WSKeepAlive time.Duration
+	// WSIdleTimeout closes the websockets, whose client has sent nothing for so long. It's off when 0, as the
+	// clients of 'subscriptions-transport-ws' send nothing but their subscriptions
+	WSIdleTimeout time.Duration
+	// WSMaxLifetime closes the websockets after so long with 'going away', for the clients to reconnect. It
+	// moves the long-lived connections along to the new instances, and is off when 0
+	WSMaxLifetime time.Duration
+	// WSMaxConnsPerUser caps the websockets of a user, so that a client leaking them can't exhaust the memory.
+	// The websockets over the cap are closed with 'policy violation' right after the upgrade, unlimited when 0
+	WSMaxConnsPerUser int
+	// WSMaxMessageSize caps the messages the clients send over the websockets, like the 'connection_init' &
+	// the subscriptions. The websockets sending a bigger one are closed with 'message too big', unlimited when 0
+	WSMaxMessageSize int64
+	// SeedEmail, SeedName & SeedPassword are of the demo user created with '-seed'. The password is well-known,
+	// so the demo data is meant for development only, and refused in production
+	SeedEmail    string
+	SeedName     string
+	SeedPassword string
 }
 
-// DefaultAppConfig creates an instance of AppConfig and populates with default/environment values
+// DefaultAppConfig creates an instance of AppConfig and populates with default/environment values.
+// Every value is looked up in the order of precedence below, the first one found wins
+//  1. 'GKC_' prefixed environment variable, like GKC_DB_FILE
+//  2. Unprefixed environment variable, like DB_FILE
+//  3. Lowercased key in the YAML file at GKC_CONFIG_FILE (or CONFIG_FILE), like 'db_file: keepclone.db'
+//  4. Default value
 func DefaultAppConfig() *AppConfig {
-	production := os.Getenv("PRODUCTION")
-
-	host := os.Getenv("HOST")
-	if host == "" {
-		log.Fatal("The environment variable HOST doesn't exist")
+	configFile, err := readConfigFile(firstEnv("GKC_CONFIG_FILE", "CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("The config file couldn't be read -> %s", err)
+	}
+	getenv := func(name string) string {
+		if value := firstEnv("GKC_"+name, name); value != "" {
+			return value
+		}
+		return configFile[strings.ToLower(name)]
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("The environment variable PORT doesn't exist")
+	production := getenv("PRODUCTION")
+
+	logLevel := strings.ToLower(getenv("LOG_LEVEL"))
+	switch logLevel {
+	case "":
+		logLevel = "info"
+	case "debug", "info", "warn", "error":
+	default:
+		log.Fatal("The environment variable LOG_LEVEL must be one of 'debug', 'info', 'warn' or 'error'")
 	}
 
-	appHost, err := url.Parse(fmt.Sprintf("%s:%s", host, port))
+	appHost, port, err := parseAppHost(getenv("APP_HOST"), getenv("HOST"), getenv("PORT"))
 	if err != nil {
-		log.Fatal("The environmental variable HOST or PORT is malformed")
+		log.Fatal(err)
 	}
 
-	cookieStoreKey := os.Getenv("COOKIE_STORE_KEY")
-	if cookieStoreKey == "" {
-		log.Fatal("The environment variable COOKIE_STORE_KEY doesn't exist")
+	// The app host is always allowed, when other origins like those of a CDN are given. Without them, any
+	// origin is allowed for the convenience of local development, but only the app host in production
+	allowedOrigins := []string{}
+	if origins := getenv("ALLOWED_ORIGINS"); origins != "" || production != "" {
+		allowedOrigins = append(allowedOrigins, appHost.Scheme+"://"+appHost.Host)
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin == "" {
+				continue
+			}
+			originURL, err := url.Parse(origin)
+			if err != nil || originURL.Scheme == "" || originURL.Host == "" {
+				log.Fatal("The environment variable ALLOWED_ORIGINS is malformed")
+			}
+			// The credentials are allowed, so the browsers refuse the origin '*'. Only the subdomains can be wildcarded
+			if host := strings.TrimPrefix(originURL.Hostname(), "*."); strings.Contains(host, "*") || host == "" {
+				log.Fatal("The environment variable ALLOWED_ORIGINS can have '*' only for the subdomains, like 'https://*.example.com'")
+			}
+			allowedOrigins = append(allowedOrigins, originURL.Scheme+"://"+originURL.Host)
+		}
+	}
+	allowedMethods := []string{http.MethodGet, http.MethodPost, http.MethodHead}
+	if methods := getenv("ALLOWED_METHODS"); methods != "" {
+		allowedMethods = []string{}
+		for _, method := range strings.Split(methods, ",") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if !isToken(method) {
+				log.Fatal("The environment variable ALLOWED_METHODS is malformed")
+			}
+			allowedMethods = append(allowedMethods, method)
+		}
+	}
+	allowedHeaders := []string{}
+	for _, header := range strings.Split(getenv("ALLOWED_HEADERS"), ",") {
+		if header = strings.TrimSpace(header); header == "" {
+			continue
+		}
+		if header == "*" || !isToken(header) {
+			log.Fatal("The environment variable ALLOWED_HEADERS is malformed")
+		}
+		allowedHeaders = append(allowedHeaders, http.CanonicalHeaderKey(header))
 	}
 
-	sessionStoreKey := os.Getenv("SESSION_STORE_KEY")
-	if sessionStoreKey == "" {
-		log.Fatal("The environment variable SESSION_STORE_KEY doesn't exist")
+	cookieStoreKey := getenv("COOKIE_STORE_KEY")
+	sessionStoreKey := getenv("SESSION_STORE_KEY")
+	if cookieStoreKey == "" || sessionStoreKey == "" {
+		cookieStoreKey, sessionStoreKey, err = loadStoreKeys(getenv("STORE_KEYS_FILE"), cookieStoreKey, sessionStoreKey)
+		if err != nil {
+			log.Fatalf("The store keys couldn't be generated -> %s", err)
+		}
+	}
+	if _, err := DecodeStoreKey(cookieStoreKey); err != nil {
+		log.Fatalf("The environment variable COOKIE_STORE_KEY is malformed -> %s", err)
+	}
+	if _, err := DecodeStoreKey(sessionStoreKey); err != nil {
+		log.Fatalf("The environment variable SESSION_STORE_KEY is malformed -> %s", err)
+	}
+	csrfKey := getenv("CSRF_KEY")
+	if csrfKey == "" {
+		csrfKey = deriveKey(sessionStoreKey, "csrf")
+	}
+	if _, err := DecodeStoreKey(csrfKey); err != nil {
+		log.Fatalf("The environment variable CSRF_KEY is malformed -> %s", err)
+	}
+
+	dbDriver := getenv("DB_DRIVER")
+	switch dbDriver {
+	case "":
+		dbDriver = "sqlite3"
+	case "sqlite3", "postgres", "mysql":
+	default:
+		log.Fatal("The environment variable DB_DRIVER must be one of 'sqlite3', 'postgres' or 'mysql'")
+	}
+
+	dbDSN := getenv("DB_DSN") // MySQL DSN needs 'parseTime=true' for the timestamp columns
+	if dbDSN == "" && dbDriver == "sqlite3" {
+		dbDSN = getenv("DB_FILE")
+		if dbDSN == "" {
+			dbDSN = "keepclone.db"
+		}
+	}
+	if dbDSN == "" {
+		log.Fatal("The environment variable DB_DSN doesn't exist")
 	}
 
-	dbFile := os.Getenv("DB_FILE")
-	if dbFile == "" {
-		dbFile = "keepclone.db"
+	// SQLite has a single writer at a time anyway, so a few connections are enough for the readers alongside.
+	// The DB servers are given more, and renewed before they drop the idle connections by themselves
+	dbMaxOpenConns, dbMaxIdleConns, dbConnMaxLifetime := 25, 10, 5*time.Minute
+	if dbDriver == "sqlite3" {
+		dbMaxOpenConns, dbMaxIdleConns, dbConnMaxLifetime = 4, 4, 0
+	}
+	if conns := getenv("DB_MAX_OPEN_CONNS"); conns != "" {
+		dbMaxOpenConns, err = strconv.Atoi(conns)
+		if err != nil || dbMaxOpenConns <= 0 {
+			log.Fatal("The environment variable DB_MAX_OPEN_CONNS is malformed")
+		}
+	}
+	if conns := getenv("DB_MAX_IDLE_CONNS"); conns != "" {
+		dbMaxIdleConns, err = strconv.Atoi(conns)
+		if err != nil || dbMaxIdleConns < 0 {
+			log.Fatal("The environment variable DB_MAX_IDLE_CONNS is malformed")
+		}
+	}
+	if lifetime := getenv("DB_CONN_MAX_LIFETIME"); lifetime != "" {
+		dbConnMaxLifetime, err = time.ParseDuration(lifetime)
+		if err != nil || dbConnMaxLifetime < 0 {
+			log.Fatal("The environment variable DB_CONN_MAX_LIFETIME is malformed")
+		}
 	}
 
-	staticDir := os.Getenv("STATIC_DIR")
+	staticDir := getenv("STATIC_DIR")
 	if staticDir == "" {
 		staticDir = "./web/build/"
 	}
 
+	attachmentDir := getenv("ATTACHMENT_DIR")
+	if attachmentDir == "" {
+		attachmentDir = "./attachments/"
+	}
+
+	// The attachments are stored on the disk of the host, or in S3 or any storage compatible with it for
+	// scaling beyond a single host
+	attachmentStore := strings.ToLower(getenv("ATTACHMENT_STORE"))
+	var s3Endpoint *url.URL
+	s3Region := getenv("S3_REGION")
+	if s3Region == "" {
+		s3Region = "us-east-1"
+	}
+	switch attachmentStore {
+	case "":
+		attachmentStore = "local"
+	case "local":
+	case "s3":
+		endpoint := getenv("S3_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "https://s3." + s3Region + ".amazonaws.com"
+		}
+		s3Endpoint, err = url.Parse(endpoint)
+		if err != nil || (s3Endpoint.Scheme != "http" && s3Endpoint.Scheme != "https") || s3Endpoint.Host == "" {
+			log.Fatal("The environment variable S3_ENDPOINT is malformed")
+		}
+		if getenv("S3_BUCKET") == "" || getenv("S3_ACCESS_KEY_ID") == "" || getenv("S3_SECRET_ACCESS_KEY") == "" {
+			log.Fatal("The environment variables S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set for ATTACHMENT_STORE 's3'")
+		}
+	default:
+		log.Fatal("The environment variable ATTACHMENT_STORE must be one of 'local' or 's3'")
+	}
+
+	maxAttachmentSize := int64(10 << 20) // 10 MiB
+	if size := getenv("ATTACHMENT_MAX_SIZE"); size != "" {
+		maxAttachmentSize, err = strconv.ParseInt(size, 10, 64)
+		if err != nil || maxAttachmentSize <= 0 {
+			log.Fatal("The environment variable ATTACHMENT_MAX_SIZE is malformed")
+		}
+	}
+
+	revisionLimit := 20
+	if limit := getenv("REVISION_LIMIT"); limit != "" {
+		revisionLimit, err = strconv.Atoi(limit)
+		if err != nil || revisionLimit < 0 {
+			log.Fatal("The environment variable REVISION_LIMIT is malformed")
+		}
+	}
+
+	undoWindow := 10 * time.Second
+	if window := getenv("UNDO_WINDOW"); window != "" {
+		undoWindow, err = time.ParseDuration(window)
+		if err != nil || undoWindow <= 0 {
+			log.Fatal("The environment variable UNDO_WINDOW is malformed")
+		}
+	}
+
+	// The idempotency keys outlive the retries of a flaky network, without piling up for long
+	idempotencyWindow := time.Hour
+	if window := getenv("IDEMPOTENCY_WINDOW"); window != "" {
+		idempotencyWindow, err = time.ParseDuration(window)
+		if err != nil || idempotencyWindow <= 0 {
+			log.Fatal("The environment variable IDEMPOTENCY_WINDOW is malformed")
+		}
+	}
+
+	// Todos beyond the limits are rejected before they reach the DB
+	maxTitleLength, maxNoteLength, maxNotes, maxLabels := 1000, 20000, 1000, 100
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{
+		{"MAX_TITLE_LENGTH", &maxTitleLength},
+		{"MAX_NOTE_LENGTH", &maxNoteLength},
+		{"MAX_NOTES", &maxNotes},
+		{"MAX_LABELS", &maxLabels},
+	} {
+		if value := getenv(limit.name); value != "" {
+			*limit.value, err = strconv.Atoi(value)
+			if err != nil || *limit.value <= 0 {
+				log.Fatalf("The environment variable %s is malformed", limit.name)
+			}
+		}
+	}
+
+	// What each user stores is capped on shared instances, the admins aside. Either is unlimited when 0
+	quotaTodos := 0
+	if quota := getenv("MAX_TODOS_PER_USER"); quota != "" {
+		quotaTodos, err = strconv.Atoi(quota)
+		if err != nil || quotaTodos < 0 {
+			log.Fatal("The environment variable MAX_TODOS_PER_USER is malformed")
+		}
+	}
+	quotaBytes := int64(0)
+	if quota := getenv("MAX_ATTACHMENT_BYTES_PER_USER"); quota != "" {
+		quotaBytes, err = strconv.ParseInt(quota, 10, 64)
+		if err != nil || quotaBytes < 0 {
+			log.Fatal("The environment variable MAX_ATTACHMENT_BYTES_PER_USER is malformed")
+		}
+	}
+
+	trashPurgeInterval := time.Hour
+	if interval := getenv("TRASH_PURGE_INTERVAL"); interval != "" {
+		trashPurgeInterval, err = time.ParseDuration(interval)
+		if err != nil || trashPurgeInterval <= 0 {
+			log.Fatal("The environment variable TRASH_PURGE_INTERVAL is malformed")
+		}
+	}
+
+	dbVacuumInterval := 24 * time.Hour
+	if interval := getenv("DB_VACUUM_INTERVAL"); interval != "" {
+		dbVacuumInterval, err = time.ParseDuration(interval)
+		if err != nil || dbVacuumInterval <= 0 {
+			log.Fatal("The environment variable DB_VACUUM_INTERVAL is malformed")
+		}
+	}
+	backupKeep := 7
+	if keep := getenv("BACKUP_KEEP"); keep != "" {
+		backupKeep, err = strconv.Atoi(keep)
+		if err != nil || backupKeep <= 0 {
+			log.Fatal("The environment variable BACKUP_KEEP is malformed")
+		}
+	}
+
+	// Google login is enabled only when the OAuth2 client is configured. Redirect URL
+	// of the client is '<APP_HOST>/auth/oauth2/callback/google'
+	googleClientID := getenv("GOOGLE_CLIENT_ID")
+	googleClientSecret := getenv("GOOGLE_CLIENT_SECRET")
+	if googleClientID != "" && googleClientSecret == "" {
+		log.Fatal("The environment variable GOOGLE_CLIENT_SECRET doesn't exist")
+	}
+
+	smtpHost := getenv("SMTP_HOST")
+	smtpPort := getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	mailFrom := getenv("MAIL_FROM")
+	if smtpHost != "" && mailFrom == "" {
+		log.Fatal("The environment variable MAIL_FROM doesn't exist")
+	}
+
+	// Accounts are locked for LOCK_DURATION after LOCK_AFTER failed logins within LOCK_WINDOW
+	lockAfter := 5
+	if after := getenv("LOCK_AFTER"); after != "" {
+		lockAfter, err = strconv.Atoi(after)
+		if err != nil || lockAfter <= 0 {
+			log.Fatal("The environment variable LOCK_AFTER is malformed")
+		}
+	}
+	lockWindow := 5 * time.Minute
+	if window := getenv("LOCK_WINDOW"); window != "" {
+		lockWindow, err = time.ParseDuration(window)
+		if err != nil || lockWindow <= 0 {
+			log.Fatal("The environment variable LOCK_WINDOW is malformed")
+		}
+	}
+	lockDuration := 15 * time.Minute
+	if duration := getenv("LOCK_DURATION"); duration != "" {
+		lockDuration, err = time.ParseDuration(duration)
+		if err != nil || lockDuration <= 0 {
+			log.Fatal("The environment variable LOCK_DURATION is malformed")
+		}
+	}
+	// Each step of the cost doubles the CPU time of hashing, which makes guessing the passwords from a leaked hash
+	// twice as slow, and so each login & registration
+	bcryptCost := 12
+	if cost := getenv("BCRYPT_COST"); cost != "" {
+		bcryptCost, err = strconv.Atoi(cost)
+		if err != nil || bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			log.Fatal("The environment variable BCRYPT_COST is malformed")
+		}
+	}
+	seedEmail := getenv("SEED_EMAIL")
+	if seedEmail == "" {
+		seedEmail = "demo@example.com"
+	}
+	seedName := getenv("SEED_NAME")
+	if seedName == "" {
+		seedName = "Demo User"
+	}
+	seedPassword := getenv("SEED_PASSWORD")
+	if seedPassword == "" {
+		seedPassword = "demo1234"
+	}
+	authEventRetention := 90 * 24 * time.Hour
+	if retention := getenv("AUTH_EVENT_RETENTION"); retention != "" {
+		authEventRetention, err = time.ParseDuration(retention)
+		if err != nil || authEventRetention <= 0 {
+			log.Fatal("The environment variable AUTH_EVENT_RETENTION is malformed")
+		}
+	}
+
+	// The number of the proxies in front of the server, or 'true' for one. The clients are identified by the
+	// entries of 'X-Forwarded-For' added by them
+	trustedProxies := 0
+	if trust := getenv("TRUST_PROXY"); trust != "" {
+		if isTrusted, err := strconv.ParseBool(trust); err == nil {
+			if isTrusted {
+				trustedProxies = 1
+			}
+		} else if trustedProxies, err = strconv.Atoi(trust); err != nil || trustedProxies < 0 {
+			log.Fatal("The environment variable TRUST_PROXY is malformed")
+		}
+	}
+
+	// Requests per minute of a client, which is identified by 'X-Forwarded-For' when TRUST_PROXY is set
+	authRateLimit := 20
+	if limit := getenv("AUTH_RATE_LIMIT"); limit != "" {
+		authRateLimit, err = strconv.Atoi(limit)
+		if err != nil || authRateLimit <= 0 {
+			log.Fatal("The environment variable AUTH_RATE_LIMIT is malformed")
+		}
+	}
+	queryRateLimit := 600
+	if limit := getenv("QUERY_RATE_LIMIT"); limit != "" {
+		queryRateLimit, err = strconv.Atoi(limit)
+		if err != nil || queryRateLimit <= 0 {
+			log.Fatal("The environment variable QUERY_RATE_LIMIT is malformed")
+		}
+	}
+
+	complexityLimit := 2000
+	if limit := getenv("QUERY_COMPLEXITY_LIMIT"); limit != "" {
+		complexityLimit, err = strconv.Atoi(limit)
+		if err != nil || complexityLimit <= 0 {
+			log.Fatal("The environment variable QUERY_COMPLEXITY_LIMIT is malformed")
+		}
+	}
+
+	depthLimit := 10
+	if limit := getenv("QUERY_DEPTH_LIMIT"); limit != "" {
+		depthLimit, err = strconv.Atoi(limit)
+		if err != nil || depthLimit <= 0 {
+			log.Fatal("The environment variable QUERY_DEPTH_LIMIT is malformed")
+		}
+	}
+
+	queryTimeout := 10 * time.Second
+	if timeout := getenv("QUERY_TIMEOUT"); timeout != "" {
+		queryTimeout, err = time.ParseDuration(timeout)
+		if err != nil || queryTimeout <= 0 {
+			log.Fatal("The environment variable QUERY_TIMEOUT is malformed")
+		}
+	}
+
+	// The playground & the introspection tell the whole schema, so they're off in production unless enabled
+	playgroundEnabled, err := parseDevelopmentOnly(getenv("ENABLE_PLAYGROUND"), production != "")
+	if err != nil {
+		log.Fatal("The environment variable ENABLE_PLAYGROUND is malformed")
+	}
+	introspectable, err := parseDevelopmentOnly(getenv("ENABLE_INTROSPECTION"), production != "")
+	if err != nil {
+		log.Fatal("The environment variable ENABLE_INTROSPECTION is malformed")
+	}
+	// The webhooks registered by the users could reach the services behind the firewall, so they're kept out in
+	// production unless allowed
+	webhookPrivateIPs := production == ""
+	if allowed := getenv("WEBHOOK_ALLOW_PRIVATE_IPS"); allowed != "" {
+		webhookPrivateIPs, err = strconv.ParseBool(allowed)
+		if err != nil {
+			log.Fatal("The environment variable WEBHOOK_ALLOW_PRIVATE_IPS is malformed")
+		}
+	}
+
+	// HTTPS is served when both the certificate & key are given, optionally redirecting from plain HTTP port
+	tlsCertFile := getenv("TLS_CERT_FILE")
+	tlsKeyFile := getenv("TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		log.Fatal("The environment variables TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	httpRedirectPort := getenv("HTTP_REDIRECT_PORT")
+	if httpRedirectPort != "" && tlsCertFile == "" {
+		log.Fatal("The environment variable HTTP_REDIRECT_PORT needs TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	sessionCookieName := getenv("SESSION_COOKIE_NAME")
+	if sessionCookieName == "" {
+		sessionCookieName = "gkc_session"
+	}
+	sessionMaxAge := 12 * time.Hour
+	if maxAge := getenv("SESSION_MAX_AGE"); maxAge != "" {
+		sessionMaxAge, err = time.ParseDuration(maxAge)
+		if err != nil || sessionMaxAge <= 0 {
+			log.Fatal("The environment variable SESSION_MAX_AGE is malformed")
+		}
+	}
+	cookieMaxAge := 730 * time.Hour // a month
+	if maxAge := getenv("COOKIE_MAX_AGE"); maxAge != "" {
+		cookieMaxAge, err = time.ParseDuration(maxAge)
+		if err != nil || cookieMaxAge <= 0 {
+			log.Fatal("The environment variable COOKIE_MAX_AGE is malformed")
+		}
+	}
+
+	signInDurations := []time.Duration{7 * 24 * time.Hour, 30 * 24 * time.Hour}
+	if durations := getenv("KEEP_SIGNED_IN_DURATIONS"); durations != "" {
+		signInDurations = []time.Duration{}
+		for _, duration := range strings.Split(durations, ",") {
+			signInDuration, err := time.ParseDuration(strings.TrimSpace(duration))
+			if err != nil || signInDuration <= 0 {
+				log.Fatal("The environment variable KEEP_SIGNED_IN_DURATIONS is malformed")
+			}
+			signInDurations = append(signInDurations, signInDuration)
+		}
+	}
+
+	// Browsers drop the 'SameSite=None' cookies, unless they are 'Secure', which they are only in production or with HTTPS
+	var cookieSameSite http.SameSite
+	switch strings.ToLower(getenv("COOKIE_SAME_SITE")) {
+	case "", "lax":
+		cookieSameSite = http.SameSiteLaxMode
+	case "strict":
+		cookieSameSite = http.SameSiteStrictMode
+	case "none":
+		if production == "" && tlsCertFile == "" {
+			log.Fatal("The environment variable COOKIE_SAME_SITE can be 'none' only in production or with TLS_CERT_FILE")
+		}
+		cookieSameSite = http.SameSiteNoneMode
+	default:
+		log.Fatal("The environment variable COOKIE_SAME_SITE must be one of 'lax', 'strict' or 'none'")
+	}
+
+	wsKeepAlive := 10 * time.Second
+	if interval := getenv("WS_KEEPALIVE_INTERVAL"); interval != "" {
+		wsKeepAlive, err = time.ParseDuration(interval)
+		if err != nil || wsKeepAlive <= 0 {
+			log.Fatal("The environment variable WS_KEEPALIVE_INTERVAL is malformed")
+		}
+	}
+	wsIdleTimeout := time.Duration(0)
+	if timeout := getenv("WS_IDLE_TIMEOUT"); timeout != "" {
+		wsIdleTimeout, err = time.ParseDuration(timeout)
+		if err != nil || wsIdleTimeout < 0 {
+			log.Fatal("The environment variable WS_IDLE_TIMEOUT is malformed")
+		}
+	}
+	wsMaxLifetime := 24 * time.Hour
+	if lifetime := getenv("WS_MAX_LIFETIME"); lifetime != "" {
+		wsMaxLifetime, err = time.ParseDuration(lifetime)
+		if err != nil || wsMaxLifetime < 0 {
+			log.Fatal("The environment variable WS_MAX_LIFETIME is malformed")
+		}
+	}
+	wsMaxConnsPerUser := 10
+	if conns := getenv("WS_MAX_CONNS_PER_USER"); conns != "" {
+		wsMaxConnsPerUser, err = strconv.Atoi(conns)
+		if err != nil || wsMaxConnsPerUser < 0 {
+			log.Fatal("The environment variable WS_MAX_CONNS_PER_USER is malformed")
+		}
+	}
+	wsMaxMessageSize := int64(64 << 10) // 64 KiB
+	if size := getenv("WS_MAX_MESSAGE_SIZE"); size != "" {
+		wsMaxMessageSize, err = strconv.ParseInt(size, 10, 64)
+		if err != nil || wsMaxMessageSize < 0 {
+			log.Fatal("The environment variable WS_MAX_MESSAGE_SIZE is malformed")
+		}
+	}
+	shutdownTimeout := 15 * time.Second
+	if timeout := getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		shutdownTimeout, err = time.ParseDuration(timeout)
+		if err != nil || shutdownTimeout <= 0 {
+			log.Fatal("The environment variable SHUTDOWN_TIMEOUT is malformed")
+		}
+	}
+
 	return &AppConfig{
-		IsProd:            production != "",
-		AppHost:           appHost,
-		DBFile:            dbFile,
-		StaticDir:         staticDir,
-		CookieStoreKey:    cookieStoreKey,
-		SessionStoreKey:   sessionStoreKey,
-		SessionCookieName: "gkc_session",
+		IsProd:             production != "",
+		LogLevel:           logLevel,
+		AppHost:            appHost,
+		Port:               port,
+		AllowedOrigins:     allowedOrigins,
+		AllowedMethods:     allowedMethods,
+		AllowedHeaders:     allowedHeaders,
+		DBDriver:           dbDriver,
+		DBDSN:              dbDSN,
+		DBMaxOpenConns:     dbMaxOpenConns,
+		DBMaxIdleConns:     dbMaxIdleConns,
+		DBConnMaxLifetime:  dbConnMaxLifetime,
+		StaticDir:          staticDir,
+		CookieStoreKey:     cookieStoreKey,
+		SessionStoreKey:    sessionStoreKey,
+		CSRFKey:            csrfKey,
+		SessionCookieName:  sessionCookieName,
+		SessionMaxAge:      sessionMaxAge,
+		CookieMaxAge:       cookieMaxAge,
+		SignInDurations:    signInDurations,
+		CookieSameSite:     cookieSameSite,
+		TrashPurgeInterval: trashPurgeInterval,
+		DBVacuumInterval:   dbVacuumInterval,
+		BackupDir:          getenv("BACKUP_DIR"),
+		BackupKeep:         backupKeep,
+		GoogleClientID:     googleClientID,
+		GoogleClientSecret: googleClientSecret,
+		SMTPHost:           smtpHost,
+		SMTPPort:           smtpPort,
+		SMTPUsername:       getenv("SMTP_USERNAME"),
+		SMTPPassword:       getenv("SMTP_PASSWORD"),
+		MailFrom:           mailFrom,
+		LockAfter:          lockAfter,
+		LockWindow:         lockWindow,
+		LockDuration:       lockDuration,
+		BcryptCost:         bcryptCost,
+		AuthEventRetention: authEventRetention,
+		ShutdownTimeout:    shutdownTimeout,
+		AttachmentDir:      attachmentDir,
+		AttachmentStore:    attachmentStore,
+		S3Endpoint:         s3Endpoint,
+		S3Region:           s3Region,
+		S3Bucket:           getenv("S3_BUCKET"),
+		S3AccessKeyID:      getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:  getenv("S3_SECRET_ACCESS_KEY"),
+		MaxAttachmentSize:  maxAttachmentSize,
+		RevisionLimit:      revisionLimit,
+		UndoWindow:         undoWindow,
+		IdempotencyWindow:  idempotencyWindow,
+		MaxTitleLength:     maxTitleLength,
+		MaxNoteLength:      maxNoteLength,
+		MaxNotes:           maxNotes,
+		MaxLabels:          maxLabels,
+		QuotaTodos:         quotaTodos,
+		QuotaBytes:         quotaBytes,
+		TrustedProxies:     trustedProxies,
+		AdminFirstUser:     getenv("ADMIN_FIRST_USER") != "",
+		TemplatesFile:      getenv("TEMPLATES_FILE"),
+		WSKeepAlive:        wsKeepAlive,
+		WSIdleTimeout:      wsIdleTimeout,
+		WSMaxLifetime:      wsMaxLifetime,
+		WSMaxConnsPerUser:  wsMaxConnsPerUser,
+		WSMaxMessageSize:   wsMaxMessageSize,
+		SeedEmail:          seedEmail,
+		SeedName:           seedName,
+		SeedPassword:       seedPassword,
+		AuthRateLimit:      authRateLimit,
+		QueryRateLimit:     queryRateLimit,
+		ComplexityLimit:    complexityLimit,
+		DepthLimit:         depthLimit,
+		QueryTimeout:       queryTimeout,
+		PlaygroundEnabled:  playgroundEnabled,
+		Introspectable:     introspectable,
+		WebhookPrivateIPs:  webhookPrivateIPs,
+		MetricsEnabled:     getenv("ENABLE_METRICS") != "",
+		CompressionEnabled: getenv("DISABLE_COMPRESSION") == "",
+		MetricsPort:        getenv("METRICS_PORT"), // metrics are served at the app port, if not set
+		TLSCertFile:        tlsCertFile,
+		TLSKeyFile:         tlsKeyFile,
+		HTTPRedirectPort:   httpRedirectPort,
+	}
+}
+
+// IsMailEnabled tells whether e-mails can be delivered, which is needed for confirming
+// registrations and recovering passwords
+func (c *AppConfig) IsMailEnabled() bool {
+	return c.SMTPHost != ""
+}
+
+// IsTLSEnabled tells whether the server serves HTTPS by itself
+func (c *AppConfig) IsTLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// IsOriginAllowed tells whether the browser origin, like 'https://keep.example.com', may call the app
+func (c *AppConfig) IsOriginAllowed(origin string) bool {
+	if len(c.AllowedOrigins) == 0 {
+		return true
+	}
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, allowed := range c.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == origin {
+			return true
+		}
+		// 'https://*.example.com' matches 'https://keep.example.com', but not 'https://example.com'
+		if prefix := strings.Index(allowed, "://*."); prefix >= 0 {
+			scheme, domain := allowed[:prefix+3], allowed[prefix+4:]
+			if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, domain) && len(origin) > len(scheme)+len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseAppHost makes the app host of APP_HOST, which is a whole URL like 'https://keep.example.com', or else of
+// HOST & PORT. The port to listen at is that of the URL, or else PORT, as the app is reached through a proxy at
+// the port of the scheme, or else the port of the scheme
+func parseAppHost(appHostURL string, host string, port string) (*url.URL, string, error) {
+	if appHostURL == "" {
+		if host == "" {
+			return nil, "", errors.New("The environment variable APP_HOST or HOST doesn't exist")
+		}
+		if port == "" {
+			return nil, "", errors.New("The environment variable PORT doesn't exist")
+		}
+		appHost, err := url.Parse(fmt.Sprintf("%s:%s", host, port))
+		if err != nil {
+			return nil, "", fmt.Errorf("The environment variables HOST and PORT make a malformed app host '%s:%s' -> %s", host, port, err)
+		}
+		if problems := appHostProblems(appHost); len(problems) > 0 {
+			return nil, "", fmt.Errorf("The environment variables HOST and PORT make an app host '%s' of %s. HOST is like 'http://localhost' and PORT like '3000'", appHost, strings.Join(problems, ", "))
+		}
+		return appHost, port, nil
+	}
+	appHost, err := url.Parse(strings.TrimSuffix(appHostURL, "/"))
+	if err != nil {
+		return nil, "", fmt.Errorf("The environment variable APP_HOST is malformed -> %s", err)
+	}
+	listened := *appHost
+	if appHost.Port() == "" && appHost.Hostname() != "" {
+		switch {
+		case port != "":
+		case appHost.Scheme == "https":
+			port = "443"
+		default:
+			port = "80"
+		}
+		listened.Host = appHost.Host + ":" + port
+	}
+	if problems := appHostProblems(&listened); len(problems) > 0 {
+		return nil, "", fmt.Errorf("The environment variable APP_HOST is an app host '%s' of %s. APP_HOST is like 'https://keep.example.com' or 'http://localhost:3000'", appHost, strings.Join(problems, ", "))
+	}
+	return appHost, listened.Port(), nil
+}
+
+// appHostProblems tells what's wrong with the app host, which needs a scheme, a host & a port for the server to
+// listen and to tell its own origin apart. Without them, the server would listen on a random port, and the
+// requests of the app would be taken as of other origins
+func appHostProblems(appHost *url.URL) []string {
+	problems := []string{}
+	if appHost.Scheme != "http" && appHost.Scheme != "https" {
+		problems = append(problems, "no scheme of 'http' or 'https'")
+	}
+	if appHost.Hostname() == "" {
+		problems = append(problems, "no host")
+	} else if strings.Contains(appHost.Hostname(), ":") && !strings.HasPrefix(appHost.Host, "[") { // but of IPv6
+		problems = append(problems, "a port in HOST too")
+	}
+	if port, err := strconv.Atoi(appHost.Port()); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, "no port from 1 to 65535")
+	}
+	if appHost.Path != "" || appHost.RawQuery != "" || appHost.Fragment != "" || appHost.User != nil {
+		problems = append(problems, "a path, query or user info") // which the port would be appended to, or the app isn't served under
+	}
+	return problems
+}
+
+// isToken tells whether the name of the header or the method is a valid token of HTTP
+func isToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, char := range name {
+		if char > unicode.MaxASCII || strings.ContainsRune(" \t\"(),/:;<=>?@[\\]{}", char) || unicode.IsControl(char) {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeStoreKey decodes the base64 cookie/session store key, which must be of 32 or 64 bytes
+// as expected by securecookie
+func DecodeStoreKey(key string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid base64 -> %s", err)
+	}
+	if len(decoded) != 32 && len(decoded) != 64 {
+		return nil, fmt.Errorf("decodes to %d bytes instead of 32 or 64", len(decoded))
+	}
+	return decoded, nil
+}
+
+// deriveKey derives a key of 32 bytes for the purpose from the base64 encoded key, as base64
+func deriveKey(key string, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(purpose))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// loadStoreKeys fills the missing store keys with random ones. They are kept in the file at the path, if given,
+// so that they are the same on the next start. Otherwise the sessions don't survive a restart
+func loadStoreKeys(path string, cookieStoreKey string, sessionStoreKey string) (string, string, error) {
+	keys, err := readConfigFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	if keys == nil {
+		keys = map[string]string{}
+	}
+	generated := false
+	for _, name := range []string{"cookie_store_key", "session_store_key"} {
+		if keys[name] == "" {
+			key := make([]byte, 64)
+			if _, err := rand.Read(key); err != nil {
+				return "", "", err
+			}
+			keys[name] = base64.StdEncoding.EncodeToString(key)
+			generated = true
+		}
+	}
+	if path == "" {
+		log.Println("The store keys are generated for this run only, so the sessions won't survive a restart. Set COOKIE_STORE_KEY & SESSION_STORE_KEY or STORE_KEYS_FILE to keep them")
+	} else if generated {
+		content := fmt.Sprintf("cookie_store_key: %s\nsession_store_key: %s\n", keys["cookie_store_key"], keys["session_store_key"])
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			return "", "", err
+		}
+		log.Printf("The store keys are generated and kept in %s", path)
+	}
+	if cookieStoreKey == "" {
+		cookieStoreKey = keys["cookie_store_key"]
+	}
+	if sessionStoreKey == "" {
+		sessionStoreKey = keys["session_store_key"]
+	}
+	return cookieStoreKey, sessionStoreKey, nil
+}
+
+// parseDevelopmentOnly parses the setting of what's on in development & off in production, unless it's set
+func parseDevelopmentOnly(value string, production bool) (bool, error) {
+	if value == "" {
+		return !production, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// firstEnv is the value of the first of the environment variables, which is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// readConfigFile reads the flat 'key: value' YAML config file, none when the path is empty
+func readConfigFile(path string) (map[string]string, error) {
+	values := map[string]string{}
+	if path == "" {
+		return values, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	for key, value := range raw {
+		values[strings.ToLower(key)] = fmt.Sprint(value) // Numbers & booleans are read as strings, like the environment
 	}
+	return values, nil
 }
@@ -0,0 +1,228 @@
+package googlekeepclone
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAppHost(t *testing.T) {
+	tests := []struct {
+		name       string
+		appHostURL string
+		host       string
+		port       string
+		wantHost   string // empty for an error
+		wantPort   string
+	}{
+		{"host & port", "", "http://localhost", "3000", "http://localhost:3000", "3000"},
+		{"no host", "", "", "3000", "", ""},
+		{"no port", "", "http://localhost", "", "", ""},
+		{"port in host", "", "http://localhost:3000", "3000", "", ""},
+		{"app host", "http://localhost:3000", "", "", "http://localhost:3000", "3000"},
+		{"app host over host & port", "https://keep.example.com:8443", "http://localhost", "3000", "https://keep.example.com:8443", "8443"},
+		{"app host behind a proxy", "https://keep.example.com", "", "8080", "https://keep.example.com", "8080"},
+		{"app host over host", "https://keep.example.com", "http://localhost", "8080", "https://keep.example.com", "8080"},
+		{"app host of https", "https://keep.example.com/", "", "", "https://keep.example.com", "443"},
+		{"app host of http", "http://keep.example.com", "", "", "http://keep.example.com", "80"},
+		{"app host of ipv6", "http://[::1]", "", "3000", "http://[::1]", "3000"},
+		{"app host without scheme", "keep.example.com", "", "3000", "", ""},
+		{"app host of other scheme", "ftp://keep.example.com", "", "3000", "", ""},
+		{"app host with path", "https://example.com/keep", "", "", "", ""},
+		{"app host with user", "https://user@keep.example.com", "", "", "", ""},
+		{"app host of bad port", "https://keep.example.com:99999", "", "", "", ""},
+		{"malformed app host", "https://keep example.com:x", "", "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appHost, port, err := parseAppHost(test.appHostURL, test.host, test.port)
+			if test.wantHost == "" {
+				if err == nil {
+					t.Errorf("got app host %s & port %s, want an error", appHost, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s, want app host %s", err, test.wantHost)
+			}
+			if appHost.String() != test.wantHost || port != test.wantPort {
+				t.Errorf("got app host %s & port %s, want %s & %s", appHost, port, test.wantHost, test.wantPort)
+			}
+		})
+	}
+}
+
+func TestAppHostProblems(t *testing.T) {
+	tests := []struct {
+		appHost string
+		want    string // of the problems, none when empty
+	}{
+		{"http://localhost:3000", ""},
+		{"https://keep.example.com:443", ""},
+		{"http://[::1]:3000", ""},
+		{"localhost:3000", "no scheme of 'http' or 'https', no host, no port from 1 to 65535"}, // taken as the scheme 'localhost'
+		{"ftp://localhost:21", "no scheme of 'http' or 'https'"},
+		{"http://:3000", "no host"},
+		{"http://localhost", "no port from 1 to 65535"},
+		{"http://localhost:", "no port from 1 to 65535"},
+		{"http://localhost:0", "no port from 1 to 65535"},
+		{"http://localhost:65536", "no port from 1 to 65535"},
+		{"http://localhost:3000:3000", "a port in HOST too"},
+		{"http://localhost:3000/keep", "a path, query or user info"},
+		{"http://localhost:3000?debug=1", "a path, query or user info"},
+		{"http://localhost:3000#keep", "a path, query or user info"},
+		{"http://user@localhost:3000", "a path, query or user info"},
+		{"//localhost", "no scheme of 'http' or 'https', no port from 1 to 65535"},
+		{"", "no scheme of 'http' or 'https', no host, no port from 1 to 65535"},
+	}
+	for _, test := range tests {
+		t.Run(test.appHost, func(t *testing.T) {
+			appHost, err := url.Parse(test.appHost)
+			if err != nil {
+				t.Fatalf("Error while parsing the app host -> %s", err)
+			}
+			if got := strings.Join(appHostProblems(appHost), ", "); got != test.want {
+				t.Errorf("got problems %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStoreKey(t *testing.T) {
+	key := func(size int) string { return base64.StdEncoding.EncodeToString(make([]byte, size)) }
+	tests := []struct {
+		name     string
+		key      string
+		wantSize int // 0 for an error
+	}{
+		{"32 bytes", key(32), 32},
+		{"64 bytes", key(64), 64},
+		{"empty", "", 0},
+		{"16 bytes", key(16), 0},
+		{"33 bytes", key(33), 0},
+		{"128 bytes", key(128), 0},
+		{"not base64", "not a key!", 0},
+		{"url base64", strings.Replace(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("\xfb\xff", 16))), "+", "-", -1), 0},
+		{"unpadded", strings.TrimRight(key(64), "="), 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := DecodeStoreKey(test.key)
+			if test.wantSize == 0 {
+				if err == nil {
+					t.Errorf("got a key of %d bytes, want an error", len(decoded))
+				}
+				return
+			}
+			if err != nil || len(decoded) != test.wantSize {
+				t.Errorf("got a key of %d bytes & error %v, want %d bytes", len(decoded), err, test.wantSize)
+			}
+		})
+	}
+}
+
+func TestLoadStoreKeys(t *testing.T) {
+	given := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	tests := []struct {
+		name            string
+		file            string // content of the keys file, none when empty
+		cookieStoreKey  string
+		sessionStoreKey string
+		wantCookie      string // generated when empty
+		wantSession     string
+	}{
+		{"generated", "", "", "", "", ""},
+		{"kept", "cookie_store_key: " + given + "\nsession_store_key: " + given + "\n", "", "", given, given},
+		{"given over kept", "cookie_store_key: a\nsession_store_key: b\n", given, "", given, "b"},
+		{"missing generated", "cookie_store_key: " + given + "\n", "", "", given, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.yml")
+			if test.file != "" {
+				if err := ioutil.WriteFile(path, []byte(test.file), 0600); err != nil {
+					t.Fatalf("Error while writing the keys -> %s", err)
+				}
+			}
+			cookieStoreKey, sessionStoreKey, err := loadStoreKeys(path, test.cookieStoreKey, test.sessionStoreKey)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			for _, key := range []struct{ got, want string }{{cookieStoreKey, test.wantCookie}, {sessionStoreKey, test.wantSession}} {
+				if key.want != "" && key.got != key.want {
+					t.Errorf("got key %q, want %q", key.got, key.want)
+				}
+				if _, err := DecodeStoreKey(key.got); key.want == "" && err != nil {
+					t.Errorf("got key %q generated, which is malformed -> %s", key.got, err)
+				}
+			}
+			// The next start takes the same keys
+			cookieAgain, sessionAgain, err := loadStoreKeys(path, test.cookieStoreKey, test.sessionStoreKey)
+			if err != nil || cookieAgain != cookieStoreKey || sessionAgain != sessionStoreKey {
+				t.Errorf("got keys %q & %q on the next start, want %q & %q", cookieAgain, sessionAgain, cookieStoreKey, sessionStoreKey)
+			}
+		})
+	}
+}
+
+func TestIsOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"any without allowed", nil, "https://evil.com", true},
+		{"same", []string{"https://keep.example.com"}, "https://keep.example.com", true},
+		{"casing & trailing slash", []string{"https://Keep.example.com"}, "HTTPS://keep.EXAMPLE.com/", true},
+		{"second of several", []string{"https://keep.example.com", "https://cdn.example.net"}, "https://cdn.example.net", true},
+		{"other", []string{"https://keep.example.com", "https://cdn.example.net"}, "https://evil.com", false},
+		{"other scheme", []string{"https://keep.example.com"}, "http://keep.example.com", false},
+		{"other port", []string{"https://keep.example.com"}, "https://keep.example.com:8443", false},
+		{"subdomain of wildcard", []string{"https://*.example.com"}, "https://keep.example.com", true},
+		{"nested subdomain of wildcard", []string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{"domain of wildcard", []string{"https://*.example.com"}, "https://example.com", false},
+		{"empty subdomain of wildcard", []string{"https://*.example.com"}, "https://.example.com", false},
+		{"suffix of wildcard", []string{"https://*.example.com"}, "https://evilexample.com", false},
+		{"wildcard within", []string{"https://*.example.com"}, "https://keep.example.com.evil.com", false},
+		{"other scheme of wildcard", []string{"https://*.example.com"}, "http://keep.example.com", false},
+		{"port of wildcard", []string{"https://*.example.com:8443"}, "https://keep.example.com:8443", true},
+		{"other port of wildcard", []string{"https://*.example.com"}, "https://keep.example.com:8443", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &AppConfig{AllowedOrigins: test.allowed}
+			if got := config.IsOriginAllowed(test.origin); got != test.want {
+				t.Errorf("got %v for %s, want %v", got, test.origin, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDevelopmentOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		production bool
+		want       bool
+		wantErr    bool
+	}{
+		{"development by default", "", false, true, false},
+		{"production by default", "", true, false, false},
+		{"enabled in production", "true", true, true, false},
+		{"enabled as 1", "1", true, true, false},
+		{"disabled in development", "false", false, false, false},
+		{"malformed", "yes", true, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseDevelopmentOnly(test.value, test.production)
+			if (err != nil) != test.wantErr || (err == nil && got != test.want) {
+				t.Errorf("got %v & error %v, want %v & error %v", got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
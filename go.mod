@@ -4,15 +4,24 @@ go 1.16
 
 require (
 	github.com/99designs/gqlgen v0.13.0
+	github.com/andybalholm/brotli v1.0.4
+	github.com/go-sql-driver/mysql v1.5.0 // indirect
+	github.com/gorilla/csrf v1.7.1
 	github.com/gorilla/mux v1.8.0
-	github.com/gorilla/sessions v1.2.1 // indirect
+	github.com/gorilla/sessions v1.2.1
 	github.com/gorilla/websocket v1.4.2
 	github.com/jinzhu/gorm v1.9.16
+	github.com/lib/pq v1.10.9 // indirect
 	github.com/matoous/go-nanoid/v2 v2.0.0
 	github.com/mattn/go-sqlite3 v1.14.7 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/prometheus/client_golang v1.11.0
 	github.com/rs/cors v1.7.0
+	github.com/russross/blackfriday/v2 v2.1.0
 	github.com/vektah/gqlparser/v2 v2.1.0
 	github.com/volatiletech/authboss-clientstate v0.0.0-20200826024349-8d4e74078241
 	github.com/volatiletech/authboss/v3 v3.0.3
-	golang.org/x/oauth2 v0.0.0-20210413134643-5e61552d6c78 // indirect
+	golang.org/x/crypto v0.24.0
+	golang.org/x/oauth2 v0.0.0-20210413134643-5e61552d6c78
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -1,5 +1,5 @@
 export STATIC_DIR=/static 
 export DB_FILE=keepclone.db
-export COOKIE_STORE_KEY=$(uuidgen | base64)
-export SESSION_STORE_KEY=$(uuidgen | base64)
+export COOKIE_STORE_KEY=$(head -c 32 /dev/urandom | base64)
+export SESSION_STORE_KEY=$(head -c 32 /dev/urandom | base64)
 ./server
\ No newline at end of file
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DeleteUser deletes the user along with everything owned, in a transaction. The rows are deleted
+// explicitly rather than relying on 'ON DELETE CASCADE', as the join table of the labels has no
+// foreign keys, and the DBs migrated before the foreign keys existed don't have them either
+func DeleteUser(db *gorm.DB, blobs BlobStore, userID string) error {
+	user := User{ID: userID}
+	if err := db.First(&user).Error; err != nil {
+		return err
+	}
+	owned := db.Unscoped().Model(&Todo{}).Where("user_id = ?", userID).Select("id").QueryExpr() // trashed ones too
+	attachments := []*Attachment{}
+	err := transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Where("todo_id IN (?)", owned).Find(&attachments).Error; err != nil {
+			return err
+		}
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{"DELETE FROM todos_labels WHERE todo_id IN (?) OR label_id IN (?)", []interface{}{owned, tx.Model(&Label{}).Where("user_id = ?", userID).Select("id").QueryExpr()}},
+			{"DELETE FROM todo_templates_labels WHERE todo_template_id IN (?) OR label_id IN (?)", []interface{}{tx.Model(&TodoTemplate{}).Where("user_id = ?", userID).Select("id").QueryExpr(), tx.Model(&Label{}).Where("user_id = ?", userID).Select("id").QueryExpr()}},
+			{"DELETE FROM notes WHERE todo_id IN (?)", []interface{}{owned}},
+			{"DELETE FROM attachments WHERE todo_id IN (?)", []interface{}{owned}},
+			{"DELETE FROM todo_revisions WHERE todo_id IN (?)", []interface{}{owned}},
+			{"DELETE FROM todo_collaborators WHERE todo_id IN (?) OR user_id = ?", []interface{}{owned, userID}},
+			{"DELETE FROM todos WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM todo_templates WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM labels WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM webhooks WHERE user_id = ?", []interface{}{userID}},
+			{"DELETE FROM remember_tokens WHERE pid = ?", []interface{}{user.GetPID()}},
+			{"DELETE FROM users WHERE id = ?", []interface{}{userID}},
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement.query, statement.args...).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments { // Blobs can't be rolled back, so they go only once the rows are gone
+		blobs.Delete(context.Background(), attachment.Path)
+	}
+	return nil
+}
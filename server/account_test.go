@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		foreignKeys bool // off like the DBs migrated before they existed
+	}{
+		{"foreign keys", true},
+		{"no foreign keys", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if !test.foreignKeys {
+				db.DB().SetMaxOpenConns(1) // of the connection the pragma's set for
+				if err := db.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+					t.Fatalf("Error while turning off the foreign keys -> %s", err)
+				}
+			}
+			deleted := newTestUser(t, db, "deleted@example.com")
+			kept := newTestUser(t, db, "kept@example.com")
+			newID := func() string {
+				id, _ := gonanoid.New(IDSize)
+				return id
+			}
+			blobs := NewLocalStore(t.TempDir())
+			// The rows of each user, along with those between them
+			for _, pair := range []struct{ owner, other *User }{{deleted, kept}, {kept, deleted}} {
+				owner := pair.owner.ID
+				todo := newTestTodo(t, db, owner, "Todo of "+owner)
+				trashed := newTestTodo(t, db, owner, "Trashed of "+owner)
+				label := newTestLabel(t, db, owner, "Label")
+				attachment := &Attachment{ID: newID(), TodoID: todo.ID, Filename: "file.txt", Path: "blob-" + owner}
+				if err := blobs.Put(context.Background(), attachment.Path, strings.NewReader("blob"), 4); err != nil {
+					t.Fatalf("Error while storing the blob -> %s", err)
+				}
+				template := &TodoTemplate{ID: newID(), Name: "Template", Color: "default", UserID: owner, Labels: []*Label{label}}
+				for _, value := range []interface{}{
+					&Note{ID: newID(), TodoID: todo.ID, Text: "Note"},
+					&TodoRevision{ID: newID(), TodoID: todo.ID, Title: "Revision"},
+					attachment, template,
+					&TodoCollaborator{TodoID: todo.ID, UserID: pair.other.ID, Permission: PermissionWrite},
+					&Webhook{ID: newID(), URL: "https://example.com", Secret: "secret", UserID: owner},
+					&RememberToken{PID: pair.owner.Email, Token: "token"},
+				} {
+					if err := db.Create(value).Error; err != nil {
+						t.Fatalf("Error while creating %T -> %s", value, err)
+					}
+				}
+				if err := db.Model(todo).Association("Labels").Append(label).Error; err != nil {
+					t.Fatalf("Error while labelling the todo -> %s", err)
+				}
+				if err := db.Delete(trashed).Error; err != nil {
+					t.Fatalf("Error while trashing the todo -> %s", err)
+				}
+			}
+			// The label of the one kept on the todo of the one deleted, and the other way around
+			deletedTodo, keptTodo := Todo{}, Todo{}
+			db.Where("user_id = ? AND title LIKE 'Todo%'", deleted.ID).First(&deletedTodo)
+			db.Where("user_id = ? AND title LIKE 'Todo%'", kept.ID).First(&keptTodo)
+			deletedLabel, keptLabel := Label{}, Label{}
+			db.Where("user_id = ?", deleted.ID).First(&deletedLabel)
+			db.Where("user_id = ?", kept.ID).First(&keptLabel)
+			db.Model(&deletedTodo).Association("Labels").Append(&keptLabel)
+			db.Model(&keptTodo).Association("Labels").Append(&deletedLabel)
+
+			if err := DeleteUser(db, blobs, deleted.ID); err != nil {
+				t.Fatalf("Error while deleting the user -> %s", err)
+			}
+
+			// The rows left of each table, all those of the one kept
+			rows := []struct {
+				query string
+				want  int
+			}{
+				{"SELECT COUNT(*) FROM users", 1},
+				{"SELECT COUNT(*) FROM todos", 2},
+				{"SELECT COUNT(*) FROM labels", 1},
+				{"SELECT COUNT(*) FROM notes", 1},
+				{"SELECT COUNT(*) FROM attachments", 1},
+				{"SELECT COUNT(*) FROM todo_revisions", 1},
+				{"SELECT COUNT(*) FROM todo_templates", 1},
+				{"SELECT COUNT(*) FROM todo_templates_labels", 1},
+				{"SELECT COUNT(*) FROM todos_labels", 1}, // the collaborators' labels go with them
+				{"SELECT COUNT(*) FROM todo_collaborators", 0},
+				{"SELECT COUNT(*) FROM webhooks", 1},
+				{"SELECT COUNT(*) FROM remember_tokens", 1},
+			}
+			for _, row := range rows {
+				count := 0
+				if err := db.Raw(row.query).Row().Scan(&count); err != nil {
+					t.Fatalf("Error while counting with %s -> %s", row.query, err)
+				}
+				if count != row.want {
+					t.Errorf("%s gave %d, want %d", row.query, count, row.want)
+				}
+			}
+			if _, err := blobs.Get(context.Background(), "blob-"+deleted.ID); err == nil {
+				t.Error("got the blob of the user deleted, want it deleted")
+			}
+			if content, err := blobs.Get(context.Background(), "blob-"+kept.ID); err != nil {
+				t.Errorf("Error while reading the blob of the user kept -> %s", err)
+			} else {
+				content.Close()
+			}
+			if err := DeleteUser(db, blobs, deleted.ID); err == nil {
+				t.Error("got the user deleted again, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
+)
+
+// adminLockDuration is how long the users locked by an admin stay locked, which is as good as forever
+const adminLockDuration = 100 * 365 * 24 * time.Hour
+
+// NewDirectiveRoot creates the directives of the schema. '@admin' lets only the admins resolve the field,
+// the others get an authorization error. '@owner' lets only those, who may change the resources of the field
+func NewDirectiveRoot(db *gorm.DB) DirectiveRoot {
+	return DirectiveRoot{
+		Owner: ownerDirective(db),
+		Admin: func(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+			userID, _ := ctx.Value(CtxUserIDKey).(string)
+			if userID == "" {
+				return nil, errors.New(MsgNotAuthenticated)
+			}
+			user := User{ID: userID}
+			if err := contextDB(ctx, db).First(&user).Error; err != nil || !user.IsAdmin {
+				return nil, errors.New(MsgNotAuthorized)
+			}
+			return next(ctx)
+		},
+	}
+}
+
+// PromoteFirstUser makes the user an admin, if no one else has registered before
+func PromoteFirstUser(db *gorm.DB, userID string) error {
+	count := 0
+	if err := db.Model(&User{}).Where("id <> ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Model(&User{ID: userID}).UpdateColumn("is_admin", true).Error
+}
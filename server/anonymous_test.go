@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestAnonymousRequests resolves every field without a user, which is refused rather than resolved for nobody.
+// The fields of the admins are refused by '@admin' before their resolvers
+func TestAnonymousRequests(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	resolver.TodoEvents = NewTodoHub(db)
+	resolver.LabelEvents = NewLabelHub(db)
+	roots := map[string]struct {
+		resolver interface{}
+		methods  reflect.Type
+	}{
+		"Query":        {resolver.Query(), reflect.TypeOf((*QueryResolver)(nil)).Elem()},
+		"Mutation":     {resolver.Mutation(), reflect.TypeOf((*MutationResolver)(nil)).Elem()},
+		"Subscription": {resolver.Subscription(), reflect.TypeOf((*SubscriptionResolver)(nil)).Elem()},
+	}
+	// The anonymous sessions get no user, so that the SPA tells them apart without an error
+	anonymous := map[string]bool{"Query.Me": true}
+	contexts := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"no user ID", context.Background()},
+		{"empty user ID", userContext("")},
+		{"user ID of another type", context.WithValue(context.Background(), CtxUserIDKey, 42)},
+	}
+	for _, c := range contexts {
+		for typeName, root := range roots {
+			admins := map[string]bool{}
+			for _, field := range parsedSchema.Types[typeName].Fields {
+				if field.Directives.ForName("admin") != nil {
+					admins[typeName+"."+strings.Title(field.Name)] = true
+				}
+			}
+			for index := 0; index < root.methods.NumMethod(); index++ {
+				method := root.methods.Method(index)
+				name := typeName + "." + method.Name
+				if admins[name] || anonymous[name] {
+					continue
+				}
+				t.Run(c.name+"/"+name, func(t *testing.T) {
+					args := []reflect.Value{reflect.ValueOf(c.ctx)}
+					for arg := 1; arg < method.Type.NumIn(); arg++ {
+						args = append(args, reflect.Zero(method.Type.In(arg)))
+					}
+					var results []reflect.Value
+					func() {
+						defer func() {
+							if err := recover(); err != nil {
+								t.Fatalf("panicked -> %v", err)
+							}
+						}()
+						results = reflect.ValueOf(root.resolver).MethodByName(method.Name).Call(args)
+					}()
+					err, _ := results[len(results)-1].Interface().(error)
+					if err == nil || err.Error() != MsgNotAuthenticated {
+						t.Errorf("got %s & error %v, want %s", fmt.Sprint(results[0]), err, MsgNotAuthenticated)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestAnonymousRequestsOfSchema(t *testing.T) {
+	db := newTestDB(t)
+	c := newTestClient(newTestResolver(db), db)
+	tests := []struct {
+		name      string
+		query     string
+		wantError string
+		wantData  string
+	}{
+		{"me", `{ me { id } }`, "", `{"me":null}`},
+		{"of the owner", `mutation { deleteTodo(id: "todo") { id } }`, MsgNotAuthenticated, `{"deleteTodo":null}`},
+		{"of the admins", `{ allUsers { id } }`, MsgNotAuthenticated, `null`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := c.RawPost(test.query)
+			if err != nil && response == nil {
+				t.Fatalf("got error %s", err)
+			}
+			errs := []struct{ Message string }{}
+			if len(response.Errors) > 0 {
+				if err := json.Unmarshal(response.Errors, &errs); err != nil {
+					t.Fatalf("Error while reading the errors -> %s", err)
+				}
+			}
+			got := ""
+			if len(errs) > 0 {
+				got = errs[0].Message
+			}
+			data, _ := json.Marshal(response.Data)
+			if got != test.wantError || string(data) != test.wantData {
+				t.Errorf("got error %q & data %s, want %q & %s", got, data, test.wantError, test.wantData)
+			}
+		})
+	}
+}
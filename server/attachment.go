@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	// MsgAttachmentTooLarge is the constant for Attachment Too Large message
+	MsgAttachmentTooLarge string = "AttachmentTooLarge"
+	// MsgAttachmentTypeNotAllowed is the constant for Attachment Type Not Allowed message
+	MsgAttachmentTypeNotAllowed string = "AttachmentTypeNotAllowed"
+)
+
+// allowedAttachmentTypes are the content types, which can be attached to the todos
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// sniffContentType detects the content type from the content itself, as the one sent by the client can't be trusted
+func sniffContentType(reader *bufio.Reader) string {
+	head, _ := reader.Peek(512)
+	return http.DetectContentType(head)
+}
+
+// storeAttachment puts the content into the store, keyed with a random ID
+func storeAttachment(ctx context.Context, blobs BlobStore, content io.Reader, size int64) (string, error) {
+	key, _ := gonanoid.New()
+	if err := blobs.Put(ctx, key, content, size); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// NewAttachmentHandler serves the attachments of the todos visible to the user at '/attachments/{id}'. The ranges
+// are served only from the stores, whose content can be seeked, like the files
+func NewAttachmentHandler(db *gorm.DB, blobs BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(CtxUserIDKey).(string)
+		if userID == "" {
+			http.Error(w, MsgNotAuthenticated, http.StatusUnauthorized)
+			return
+		}
+		attachment := Attachment{}
+		if err := db.Where("id = ? AND todo_id IN (?)", mux.Vars(r)["id"], visibleTodos(db, userID).Model(&Todo{}).Select("id").QueryExpr()).First(&attachment).Error; err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		content, err := blobs.Get(r.Context(), attachment.Path)
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.Filename))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if seeker, ok := content.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, "", attachment.CreatedAt, seeker)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(attachment.Size))
+		w.Header().Set("Last-Modified", attachment.CreatedAt.UTC().Format(http.TimeFormat))
+		io.Copy(w, content)
+	}
+}
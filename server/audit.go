@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// authEventsMax is the number of the latest auth events browsed at a time
+const authEventsMax = 1000
+
+// ctxAuditClientKey holds the client of the request, ctxLoginRecordedKey whether the login is recorded already
+type (
+	ctxAuditClientKey   struct{}
+	ctxLoginRecordedKey struct{}
+)
+
+// auditClient tells where the request comes from
+type auditClient struct {
+	IP        string
+	UserAgent string
+}
+
+// AuditLog records the authentication events of the users, along with the IP & the user agent of the client.
+// Failing to record is logged, but doesn't fail the request
+type AuditLog struct {
+	db             *gorm.DB
+	trustedProxies int
+	logger         *Logger
+}
+
+// NewAuditLog creates an instance of AuditLog. The client IP is taken from 'X-Forwarded-For', when
+// the server runs behind the trusted proxies
+func NewAuditLog(db *gorm.DB, trustedProxies int, logger *Logger) *AuditLog {
+	return &AuditLog{db: db, trustedProxies: trustedProxies, logger: logger}
+}
+
+// Middleware keeps the client of the request in the context, for the events recorded while resolving
+func (a *AuditLog) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := auditClient{IP: clientIP(r, a.trustedProxies), UserAgent: r.UserAgent()}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxAuditClientKey{}, client)))
+	})
+}
+
+// RecordFailedLogins records the logins, which don't succeed, along with the email entered. No event of
+// authboss tells about the emails no user has, which are worth knowing to detect credential stuffing
+func (a *AuditLog) RecordFailedLogins(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		credentials := struct {
+			Email string `json:"email"`
+		}{}
+		json.Unmarshal(body, &credentials)
+
+		recorded := false
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxLoginRecordedKey{}, &recorded)))
+		if recorded {
+			return
+		}
+		var userID *string
+		user := User{}
+		if err := a.db.Where("canonical_pid = ?", canonicalPID(credentials.Email)).First(&user).Error; err == nil {
+			userID = &user.ID // locked or not confirmed yet
+		}
+		a.record(r.Context(), AuthEventTypeLoginFailed, userID, credentials.Email)
+	})
+}
+
+// Record records the event of the user of the request
+func (a *AuditLog) Record(r *http.Request, eventType AuthEventType, user *User) {
+	if recorded, ok := r.Context().Value(ctxLoginRecordedKey{}).(*bool); ok {
+		*recorded = true
+	}
+	a.record(r.Context(), eventType, &user.ID, user.Email)
+}
+
+func (a *AuditLog) record(ctx context.Context, eventType AuthEventType, userID *string, email string) {
+	client, _ := ctx.Value(ctxAuditClientKey{}).(auditClient)
+	id, _ := gonanoid.New(IDSize)
+	err := a.db.Create(&AuthEvent{
+		ID:        id,
+		UserID:    userID,
+		Email:     email,
+		Type:      eventType,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}).Error
+	if err != nil {
+		a.logger.WithContext(ctx).Errorf("Error while recording the %s event of %s -> %s", eventType, email, err)
+	}
+}
+
+// Purge deletes the events recorded before the time
+func (a *AuditLog) Purge(before time.Time) error {
+	return a.db.Where("created_at < ?", before).Delete(&AuthEvent{}).Error
+}
+
+// clientIP is the IP of the client, as told by the trusted proxies in front of the server. Each one appends the
+// address it's connected from to 'X-Forwarded-For', so the client is the entry of the outermost one, that many from
+// the right. Those further left are sent by the client, and are as good as made up
+func clientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		forwarded := []string{}
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					forwarded = append(forwarded, entry)
+				}
+			}
+		}
+		if len(forwarded) >= trustedProxies {
+			return forwarded[len(forwarded)-trustedProxies]
+		} else if len(forwarded) > 0 {
+			return forwarded[0] // fewer proxies on the way, which are all trusted
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditLogRecordsFailedLogins(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "Known@example.com")
+	auditLog := NewAuditLog(db, 1, NewLogger(LogLevelError))
+	handler := auditLog.Middleware(auditLog.RecordFailedLogins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})))
+
+	tests := []struct {
+		email      string
+		forwarded  string
+		wantUserID *string
+		wantIP     string
+	}{
+		{"known@example.com", "203.0.113.7", &user.ID, "203.0.113.7"},
+		{"unknown@example.com", "10.0.0.1, 203.0.113.8", nil, "203.0.113.8"}, // the proxy appends the client it's connected from
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"`+test.email+`","password":"wrong"}`))
+		r.Header.Set("X-Forwarded-For", test.forwarded)
+		r.Header.Set("User-Agent", "test")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		event := AuthEvent{}
+		if err := db.Where("email = ?", test.email).First(&event).Error; err != nil {
+			t.Fatalf("no event of %s -> %s", test.email, err)
+		}
+		if event.Type != AuthEventTypeLoginFailed || event.IP != test.wantIP || event.UserAgent != "test" {
+			t.Errorf("event of %s = %s from %s (%s), want %s from %s (test)", test.email, event.Type, event.IP, event.UserAgent, AuthEventTypeLoginFailed, test.wantIP)
+		}
+		if (event.UserID == nil) != (test.wantUserID == nil) || (event.UserID != nil && *event.UserID != *test.wantUserID) {
+			t.Errorf("event of %s is of user %v, want %v", test.email, event.UserID, test.wantUserID)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/volatiletech/authboss/v3"
+	"github.com/volatiletech/authboss/v3/defaults"
+)
+
+const (
+	// FormValueKeepSignedIn is the login value of how long to keep signed in, as a duration like '168h'. Empty
+	// or '0s' is session-only
+	FormValueKeepSignedIn string = "keepSignedIn"
+	// SessionKeepSignedInKey is the session key holding how long to keep signed in, as chosen at login
+	SessionKeepSignedInKey string = "keep_signed_in"
+	// CookieKeepSignedIn is the cookie holding how long the 'remember me' cookie lasts, as chosen at login
+	CookieKeepSignedIn string = "rm_for"
+)
+
+// BodyReader reads the JSON body of the auth API calls, except for the GET requests of
+// the links sent in e-mails (like confirm), which carry the values in the query
+type BodyReader struct {
+	defaults.HTTPBodyReader
+}
+
+// Read the values for the page from the request. The duration to keep signed in at login is written as Go
+// does, so that it's matched by its rule however the client wrote it
+func (b BodyReader) Read(page string, r *http.Request) (authboss.Validator, error) {
+	if r.Method == http.MethodGet {
+		formReader := b.HTTPBodyReader
+		formReader.ReadJSON = false
+		return formReader.Read(page, r)
+	}
+	validator, err := b.HTTPBodyReader.Read(page, r)
+	if values, ok := validator.(defaults.UserValues); ok && page == "login" {
+		if duration, err := time.ParseDuration(values.Values[FormValueKeepSignedIn]); err == nil {
+			values.Values[FormValueKeepSignedIn] = duration.String()
+		}
+	}
+	return validator, err
+}
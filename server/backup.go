@@ -0,0 +1,59 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// backupPrefix & backupSuffix surround the timestamp in the names of the backup files. The timestamps sort
+// as text in the order of time, so the oldest backups come first by name
+const (
+	backupPrefix string = "keepclone-"
+	backupSuffix string = ".db"
+)
+
+// VacuumSQLite rebuilds the SQLite DB, giving the space of the deleted rows back to the file system
+func VacuumSQLite(db *gorm.DB) error {
+	return db.Exec("VACUUM").Error
+}
+
+// BackupSQLite writes a consistent copy of the live SQLite DB into the directory with 'VACUUM INTO', keeping
+// only the latest backups. The path of the new backup is returned
+func BackupSQLite(db *gorm.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format("20060102T150405Z")+backupSuffix)
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return "", err
+	}
+	return path, pruneBackups(dir, keep)
+}
+
+// pruneBackups deletes the oldest backups in the directory beyond the number to keep
+func pruneBackups(dir string, keep int) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	backups := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), backupPrefix) && strings.HasSuffix(file.Name(), backupSuffix) {
+			backups = append(backups, file.Name())
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
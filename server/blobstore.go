@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BlobStore stores the contents of the attachments by their keys. Getting a key, which isn't stored, fails with
+// os.ErrNotExist, while deleting one succeeds as if it was
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalStore stores the blobs as the files of a directory, on the disk of the host
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates an instance of LocalStore, storing in the directory
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// path is the file of the key. The attachments stored before the blob stores existed have the path as their key
+func (s *LocalStore) path(key string) string {
+	if filepath.Base(key) != key {
+		return key
+	}
+	return filepath.Join(s.dir, key)
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, content io.Reader, size int64) error {
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path(key), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, content); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// Get opens the file, which can be seeked, so that the ranges of it are served
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// S3Store stores the blobs as the objects of a bucket, in S3 or any storage compatible with it like MinIO. The
+// requests address the bucket in the path rather than the host, as the compatible ones expect, and are signed
+// with AWS Signature Version 4
+type S3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3Store creates an instance of S3Store, storing in the bucket at the endpoint, like 'https://s3.amazonaws.com'
+func NewS3Store(endpoint *url.URL, bucket string, region string, accessKey string, secretKey string) *S3Store {
+	return &S3Store{
+		endpoint:  endpoint,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{},
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, content io.Reader, size int64) error {
+	response, err := s.do(ctx, http.MethodPut, key, content, size)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	response, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if response != nil {
+		response.Body.Close()
+	}
+	return nil
+}
+
+// do sends the signed request for the object of the key. A missing object fails with os.ErrNotExist, and the
+// other statuses than 2xx with the error told by S3
+func (s *S3Store) do(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	objectURL := *s.endpoint
+	objectURL.Path = path.Join("/", s.endpoint.Path, s.bucket, key)
+	request, err := http.NewRequestWithContext(ctx, method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.ContentLength = size // S3 doesn't take the uploads of unknown length
+	}
+	s.sign(request, time.Now().UTC())
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		response.Body.Close()
+		return nil, fmt.Errorf("S3 %s of %s failed with %s -> %s", method, key, response.Status, message)
+	}
+	return response, nil
+}
+
+// sign signs the request with AWS Signature Version 4. The payload is left unsigned, so that the uploads are
+// streamed rather than read whole for their hash
+func (s *S3Store) sign(request *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	request.Header.Set("X-Amz-Date", timestamp)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + request.URL.Host + "\n" + "x-amz-content-sha256:" + payloadHash + "\n" + "x-amz-date:" + timestamp + "\n"
+	canonicalRequest := strings.Join([]string{request.Method, request.URL.EscapedPath(), request.URL.RawQuery, canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", timestamp, scope, hashHex(canonicalRequest)}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data string) string {
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ownedTodos loads the todos of the IDs, failing unless the user owns every one of them
+func ownedTodos(tx *gorm.DB, userID string, ids []string) ([]*Todo, error) {
+	todos := []*Todo{}
+	if err := tx.Where("user_id = ? AND id IN (?)", userID, ids).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	if len(todos) != countUnique(ids) {
+		return nil, errors.New(MsgNotAuthorized)
+	}
+	return todos, nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// listComplexity is the assumed number of items in a list, as the real one isn't known before execution
+const listComplexity int = 10
+
+func listFieldComplexity(childComplexity int) int {
+	return 1 + listComplexity*childComplexity
+}
+
+// NewComplexityRoot assigns the costs of the list fields, which fetch their items as many times
+func NewComplexityRoot() ComplexityRoot {
+	c := ComplexityRoot{}
+	c.Query.Todos = func(childComplexity int, filter *TodoFilter, orderBy *TodoOrder) int {
+		return listFieldComplexity(childComplexity)
+	}
+	c.Query.TodosConnection = func(childComplexity int, first *int, after *string, filter *TodoFilter) int {
+		return 1 + pageSize(first)*childComplexity
+	}
+	c.Query.Trash = listFieldComplexity
+	c.Query.Reminders = listFieldComplexity
+	c.Query.SearchTodos = func(childComplexity int, query string) int {
+		return listFieldComplexity(childComplexity)
+	}
+	c.Query.TodoHistory = func(childComplexity int, todoID string) int {
+		return listFieldComplexity(childComplexity)
+	}
+	c.Query.Labels = listFieldComplexity
+	c.Query.LabelsConnection = func(childComplexity int, first *int, after *string, nameContains *string) int {
+		return 1 + pageSize(first)*childComplexity
+	}
+	c.Query.SuggestLabels = func(childComplexity int, prefix string, limit *int) int {
+		return 1 + suggestionLimit(limit)*childComplexity
+	}
+	c.Todo.Notes = listFieldComplexity
+	c.Todo.Labels = listFieldComplexity
+	c.Todo.Attachments = listFieldComplexity
+	c.TodoRevision.Notes = listFieldComplexity
+	c.Stats.Labels = listFieldComplexity
+	c.Query.Templates = listFieldComplexity
+	c.TodoTemplate.Notes = listFieldComplexity
+	c.TodoTemplate.Labels = listFieldComplexity
+	return c
+}
+
+// DepthLimit rejects the operations nesting the fields deeper than the limit, before they're executed.
+// Introspection isn't limited, as its queries are deep by nature but cheap
+type DepthLimit struct {
+	Limit int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = DepthLimit{}
+
+// ExtensionName implements graphql.HandlerExtension
+func (d DepthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+// Validate implements graphql.HandlerExtension
+func (d DepthLimit) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext implements graphql.OperationContextMutator
+func (d DepthLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if depth := selectionDepth(op.SelectionSet); depth > d.Limit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.Limit)
+		errcode.Set(err, "DEPTH_LIMIT_EXCEEDED")
+		return err
+	}
+	return nil
+}
+
+// selectionDepth is the number of the nested fields in the deepest path of the selection set
+func selectionDepth(selectionSet ast.SelectionSet) int {
+	depth := 0
+	for _, selection := range selectionSet {
+		childDepth := 0
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name, "__") {
+				continue
+			}
+			childDepth = 1 + selectionDepth(selection.SelectionSet)
+		case *ast.InlineFragment:
+			childDepth = selectionDepth(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			childDepth = selectionDepth(selection.Definition.SelectionSet) // fragment cycles are rejected by the validation
+		}
+		if childDepth > depth {
+			depth = childDepth
+		}
+	}
+	return depth
+}
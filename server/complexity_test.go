@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+)
+
+func TestComplexityLimits(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "complexity@example.com")
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: newTestResolver(db), Directives: NewDirectiveRoot(db), Complexity: NewComplexityRoot()}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(250))
+	srv.Use(DepthLimit{Limit: 3})
+	c := client.New(srv)
+	tests := []struct {
+		name     string
+		query    string
+		wantCode string // empty when executed
+	}{
+		{"flat", `{ labels { id name } }`, ""},
+		{"nested list", `{ todos { title notes { id } } }`, ""},                                                              // 1 + 10 * (1 + 11)
+		{"lists of lists over the limit", `{ todos { notes { id text } labels { id name } } }`, "COMPLEXITY_LIMIT_EXCEEDED"}, // 1 + 10 * (21 + 21)
+		{"page within the limit", `{ todosConnection(first: 10) { edges { cursor } } }`, ""},
+		{"page over the limit", `{ todosConnection(first: 100) { edges { cursor } pageInfo { hasNextPage } } }`, "COMPLEXITY_LIMIT_EXCEEDED"}, // 1 + 100 * (2 + 2)
+		{"aliases within the limit", `{ a: todos { notes { id } } b: todos { notes { id } } }`, ""},
+		{"aliases adding up over the limit", `{ a: todos { notes { id } } b: todos { notes { id } } c: todos { notes { id } } }`, "COMPLEXITY_LIMIT_EXCEEDED"}, // 3 * 111
+		{"depth at the limit", `{ todosConnection(first: 1) { edges { cursor } } }`, ""},
+		{"depth over the limit", `{ todosConnection(first: 1) { edges { node { id } } } }`, "DEPTH_LIMIT_EXCEEDED"},
+		{"depth over the limit in fragment", `{ todosConnection(first: 1) { ...edges } } fragment edges on TodoConnection { edges { node { id } } }`, "DEPTH_LIMIT_EXCEEDED"},
+		{"depth over the limit in inline fragment", `{ todosConnection(first: 1) { ... on TodoConnection { edges { node { id } } } } }`, "DEPTH_LIMIT_EXCEEDED"},
+		{"introspection deep", `{ __schema { types { fields { type { ofType { name } } } } } }`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := c.RawPost(test.query, asUser(user.ID))
+			if err != nil && test.wantCode == "" {
+				t.Fatalf("got error %s", err)
+			}
+			errs := []struct {
+				Message    string
+				Extensions struct{ Code string }
+			}{}
+			if response != nil && len(response.Errors) > 0 {
+				if err := json.Unmarshal(response.Errors, &errs); err != nil {
+					t.Fatalf("Error while reading the errors -> %s", err)
+				}
+			}
+			got := ""
+			if len(errs) > 0 {
+				got = errs[0].Extensions.Code
+				if got == "" {
+					got = errs[0].Message
+				}
+			}
+			if got != test.wantCode {
+				t.Errorf("got error %q, want %q", got, test.wantCode)
+			}
+		})
+	}
+}
+
+// TestIntrospection runs the introspection queries with & without the extension, as it's used when the schema is
+// introspectable by the config
+func TestIntrospection(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "introspection@example.com")
+	tests := []struct {
+		name           string
+		introspectable bool
+		query          string
+		wantError      string // empty when executed
+	}{
+		{"schema", true, `{ __schema { queryType { name } } }`, ""},
+		{"type", true, `{ __type(name: "Todo") { name } }`, ""},
+		{"schema disabled", false, `{ __schema { queryType { name } } }`, "introspection disabled"},
+		{"type disabled", false, `{ __type(name: "Todo") { name } }`, "introspection disabled"},
+		{"schema within a query disabled", false, `{ labels { id } __schema { types { name } } }`, "introspection disabled"},
+		{"typename disabled", false, `{ labels { __typename } }`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := handler.New(NewExecutableSchema(Config{Resolvers: newTestResolver(db), Directives: NewDirectiveRoot(db)}))
+			srv.AddTransport(transport.POST{})
+			if test.introspectable {
+				srv.Use(extension.Introspection{})
+			}
+			response, err := client.New(srv).RawPost(test.query, asUser(user.ID))
+			if err != nil && response == nil {
+				t.Fatalf("got error %s", err)
+			}
+			errs := []struct{ Message string }{}
+			if len(response.Errors) > 0 {
+				if err := json.Unmarshal(response.Errors, &errs); err != nil {
+					t.Fatalf("Error while reading the errors -> %s", err)
+				}
+			}
+			got := ""
+			if len(errs) > 0 {
+				got = errs[0].Message
+			}
+			if got != test.wantError {
+				t.Errorf("got error %q, want %q", got, test.wantError)
+			}
+		})
+	}
+}
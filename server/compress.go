@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressMinSize is the size of the responses worth compressing, the smaller ones hardly shrink
+const compressMinSize int = 1024
+
+// incompressibleTypes are the content types, which are compressed already
+var incompressibleTypes = []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/x-gzip", "application/pdf", "font/woff"}
+
+// Compress compresses the responses with brotli or gzip, whichever the client prefers of those it accepts. The
+// websocket upgrades & the ranges of files are left as they are
+func Compress(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Header.Get("Range") != "" || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer writer.Close()
+		h.ServeHTTP(writer, r)
+	})
+}
+
+// acceptedEncoding picks brotli over gzip, unless the client refuses either with 'q=0'
+func acceptedEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		refused := false
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				value, err := strconv.ParseFloat(q[2:], 64)
+				refused = err != nil || value == 0
+			}
+		}
+		accepted[name] = !refused
+	}
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter holds the start of the response back, until it's known whether it's worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	status      int
+	wroteHeader bool // to the underlying writer
+	buffer      []byte
+	compressor  io.WriteCloser // nil, until the response is known to be compressed
+	passthrough bool
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader || c.status != http.StatusOK {
+		return
+	}
+	c.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || status >= http.StatusMultipleChoices {
+		c.startPassthrough() // no body worth compressing
+	}
+}
+
+func (c *compressWriter) Write(data []byte) (int, error) {
+	switch {
+	case c.compressor != nil:
+		return c.compressor.Write(data)
+	case c.passthrough:
+		return c.ResponseWriter.Write(data)
+	}
+	if c.Header().Get("Content-Type") == "" {
+		c.Header().Set("Content-Type", http.DetectContentType(append(c.buffer, data...)))
+	}
+	if c.Header().Get("Content-Encoding") != "" || !isCompressible(c.Header().Get("Content-Type")) {
+		c.startPassthrough()
+		return c.ResponseWriter.Write(data)
+	}
+	c.buffer = append(c.buffer, data...)
+	if len(c.buffer) >= compressMinSize {
+		if err := c.startCompressing(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush sends what's held back, compressed or not depending on its size so far, as the handler wants it out now
+func (c *compressWriter) Flush() {
+	if c.compressor == nil && !c.passthrough {
+		if len(c.buffer) >= compressMinSize {
+			c.startCompressing()
+		} else {
+			c.startPassthrough()
+		}
+	}
+	if flusher, ok := c.compressor.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands over the connection, as for the websockets which weren't told apart by the 'Upgrade' header
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := c.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Close sends the rest of the response, uncompressed when it's small
+func (c *compressWriter) Close() error {
+	if c.compressor != nil {
+		return c.compressor.Close()
+	}
+	if !c.passthrough {
+		c.startPassthrough()
+	}
+	return nil
+}
+
+func (c *compressWriter) startPassthrough() {
+	c.passthrough = true
+	c.writeHeader()
+	if len(c.buffer) > 0 {
+		c.ResponseWriter.Write(c.buffer)
+		c.buffer = nil
+	}
+}
+
+func (c *compressWriter) startCompressing() error {
+	c.Header().Set("Content-Encoding", c.encoding)
+	c.Header().Del("Content-Length") // of the uncompressed content
+	c.writeHeader()
+	if c.encoding == "br" {
+		c.compressor = brotli.NewWriterLevel(c.ResponseWriter, brotli.DefaultCompression)
+	} else {
+		c.compressor = gzip.NewWriter(c.ResponseWriter)
+	}
+	_, err := c.compressor.Write(c.buffer)
+	c.buffer = nil
+	return err
+}
+
+func (c *compressWriter) writeHeader() {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+}
+
+// isCompressible tells whether the content type is worth compressing
+func isCompressible(contentType string) bool {
+	for _, incompressible := range incompressibleTypes {
+		if strings.HasPrefix(contentType, incompressible) {
+			return false
+		}
+	}
+	return true
+}
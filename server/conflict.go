@@ -0,0 +1,72 @@
+package server
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// MsgConflict is the constant for Conflict message
+const MsgConflict string = "Conflict"
+
+// newConflictError tells the client, that its edit is based on a stale version of the todo. The current
+// state of the todo goes along in 'extensions', so that the client can merge its edit into it
+func newConflictError(todo *Todo) error {
+	notes := make([]map[string]interface{}, len(todo.Notes))
+	for index, note := range todo.Notes {
+		notes[index] = map[string]interface{}{
+			"id":          note.ID,
+			"text":        note.Text,
+			"isCompleted": note.IsCompleted,
+			"position":    note.Position,
+		}
+	}
+	labels := make([]string, len(todo.Labels))
+	for index, label := range todo.Labels {
+		labels[index] = label.ID
+	}
+	return &gqlerror.Error{
+		Message: MsgConflict,
+		Extensions: map[string]interface{}{
+			"code": "CONFLICT",
+			"current": map[string]interface{}{
+				"id":             todo.ID,
+				"title":          todo.Title,
+				"notes":          notes,
+				"labels":         labels,
+				"color":          todo.Color,
+				"isCheckboxMode": todo.IsCheckboxMode,
+				"version":        todo.Version,
+				"updatedAt":      todo.UpdatedAt,
+			},
+		},
+	}
+}
+
+// claimVersion bumps the version of the todo in the transaction, unless another has been saved since it was read.
+// The update of the row holds off the other writers till the transaction ends, and the conflict tells the current
+// todo otherwise. The version of the todo is left as read, for saving it to bump the same
+func claimVersion(tx *gorm.DB, todo *Todo, userID string) error {
+	result := tx.Exec("UPDATE todos SET version = version + 1 WHERE id = ? AND version = ?", todo.ID, todo.Version)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		current := Todo{ID: todo.ID, Labels: []*Label{}, Notes: []*Note{}}
+		if err := visibleTodos(tx, userID).Preload("Notes", orderedNotes).Preload("Labels").First(&current).Error; err != nil {
+			return notFound(err)
+		}
+		return newConflictError(&current)
+	}
+	return nil
+}
+
+// saveClaimed saves the todo in a transaction claiming its version, so that a todo saved by another since it was read
+// tells the conflict instead of being written over
+func saveClaimed(db *gorm.DB, todo *Todo, userID string) error {
+	return transaction(db, func(tx *gorm.DB) error {
+		if err := claimVersion(tx, todo, userID); err != nil {
+			return err
+		}
+		return tx.Save(todo).Error
+	})
+}
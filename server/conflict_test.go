@@ -0,0 +1,127 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestPatchTodoConcurrently(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "writer@example.com")
+	todo := newTestTodo(t, db, user.ID, "Shared")
+
+	const writers = 8
+	// The writers all read the todo, before any of them writes
+	arrived, released := make(chan struct{}, writers), make(chan struct{})
+	var release sync.Once
+	db.Callback().Query().Register("test:barrier", func(scope *gorm.Scope) {
+		select {
+		case <-released:
+			return
+		default:
+		}
+		if scope.TableName() == "todos" {
+			arrived <- struct{}{}
+			if len(arrived) == writers {
+				release.Do(func() { close(released) })
+			}
+			<-released
+		}
+	})
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			title, version := "Edit", 0
+			_, errs[i] = resolver.Mutation().PatchTodo(userContext(user.ID), todo.ID, TodoPatch{Title: &title, ExpectedVersion: &version})
+		}(i)
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range errs {
+		if err == nil {
+			saved++
+		} else if gqlErr, ok := err.(*gqlerror.Error); !ok || gqlErr.Message != MsgConflict {
+			t.Errorf("PatchTodo() error = %v, want %s", err, MsgConflict)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("%d of the writers of version 0 saved, want 1", saved)
+	}
+	current := Todo{ID: todo.ID}
+	db.First(&current)
+	if current.Version != 1 {
+		t.Errorf("version = %d, want 1", current.Version)
+	}
+}
+
+func TestClaimVersionKeepsStaleWritesOut(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "stale@example.com")
+	todo := newTestTodo(t, db, user.ID, "Todo")
+	stale := *todo
+
+	title := "Changed"
+	if _, err := resolver.Mutation().UpdateTodo(userContext(user.ID), todo.ID, &title, []*NotesInput{{Text: "New"}}, nil, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateTodo() error = %v", err)
+	}
+	err := claimVersion(db, &stale, user.ID)
+	gqlErr, ok := err.(*gqlerror.Error)
+	if !ok || gqlErr.Message != MsgConflict {
+		t.Fatalf("claimVersion() error = %v, want %s", err, MsgConflict)
+	}
+	current := gqlErr.Extensions["current"].(map[string]interface{})
+	if current["version"] != 1 || current["title"] != "Changed" {
+		t.Errorf("current = version %v '%v', want version 1 'Changed'", current["version"], current["title"])
+	}
+	if err := claimVersion(db, &Todo{ID: todo.ID, Version: 1}, user.ID); err != nil {
+		t.Errorf("claimVersion() of the current version error = %v", err)
+	}
+}
+
+func TestPinTodoInterleavedWithUpdateTodo(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "pinner@example.com")
+	todo := newTestTodo(t, db, user.ID, "Shared")
+
+	// The pin reads the todo, then holds off till the update has saved it
+	read, proceed := make(chan struct{}), make(chan struct{})
+	var held int32
+	db.Callback().Query().Register("test:interleave", func(scope *gorm.Scope) {
+		if scope.TableName() == "todos" && atomic.CompareAndSwapInt32(&held, 0, 1) {
+			close(read)
+			<-proceed
+		}
+	})
+	pinned := make(chan error)
+	go func() {
+		_, err := resolver.Mutation().PinTodo(userContext(user.ID), todo.ID, true)
+		pinned <- err
+	}()
+	<-read
+	title := "Edited"
+	if _, err := resolver.Mutation().UpdateTodo(userContext(user.ID), todo.ID, &title, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateTodo() error = %v", err)
+	}
+	close(proceed)
+
+	err := <-pinned
+	if gqlErr, ok := err.(*gqlerror.Error); !ok || gqlErr.Message != MsgConflict {
+		t.Errorf("PinTodo() of the todo read before the update error = %v, want %s", err, MsgConflict)
+	}
+	current := Todo{ID: todo.ID}
+	db.First(&current)
+	if current.Title != "Edited" || current.IsPinned || current.Version != 1 {
+		t.Errorf("todo = '%s' pinned %v version %d, want 'Edited' unpinned version 1", current.Title, current.IsPinned, current.Version)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// newTestDB opens a DB of its own for the test, migrated like that of the server, with the foreign keys turned on
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("Error while opening the DB -> %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetLogger(gorm.Logger{LogWriter: log.New(ioutil.Discard, "", 0)}) // of the callbacks registered by each test
+	if err := db.AutoMigrate(&User{}, &Label{}, &Todo{}, &Note{}, &TodoCollaborator{}, &Attachment{}, &TodoRevision{}, &RememberToken{}, &AuthEvent{}, &Webhook{}, &TodoTemplate{}).Error; err != nil {
+		t.Fatalf("Error while migrating the DB -> %s", err)
+	}
+	return db
+}
+
+// newTestUser creates a user of the email, whose ID is the email encoded as of those registered
+func newTestUser(t testing.TB, db *gorm.DB, email string) *User {
+	t.Helper()
+	user := &User{ID: url.QueryEscape(email), Name: email, Email: email, Confirmed: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Error while creating user %s -> %s", email, err)
+	}
+	return user
+}
+
+// newTestTodo creates a todo of the user with the title
+func newTestTodo(t testing.TB, db *gorm.DB, userID string, title string) *Todo {
+	t.Helper()
+	id, _ := gonanoid.New(IDSize)
+	todo := &Todo{ID: id, Title: title, UserID: userID, Color: "default", Notes: []*Note{}, Labels: []*Label{}}
+	if err := db.Create(todo).Error; err != nil {
+		t.Fatalf("Error while creating todo %s -> %s", title, err)
+	}
+	return todo
+}
+
+// newTestResolver creates a resolver of the DB, whose limits are those by default
+func newTestResolver(db *gorm.DB) *Resolver {
+	return &Resolver{
+		DB:            db,
+		Undos:         NewUndoLog(time.Minute),
+		Idempotency:   NewIdempotencyLog(time.Minute),
+		RevisionLimit: 20,
+		Limits:        Limits{MaxTitleLength: 1000, MaxNoteLength: 20000, MaxNotes: 1000, MaxLabels: 100},
+	}
+}
+
+// userContext is the context of the requests of the user
+func userContext(userID string) context.Context {
+	return context.WithValue(context.Background(), CtxUserIDKey, userID)
+}
+
+// newTestClient posts the GraphQL requests to the schema of the resolvers, along with the directives of the DB
+func newTestClient(resolvers ResolverRoot, db *gorm.DB) *client.Client {
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: resolvers, Directives: NewDirectiveRoot(db)}))
+	srv.AddTransport(transport.POST{})
+	return client.New(srv)
+}
+
+// asUser posts the GraphQL request as that of the user
+func asUser(userID string) client.Option {
+	return func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(userContext(userID))
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// SourceDeviceHeader is the header, which the clients tell their kind of device with, like 'mobile'
+const SourceDeviceHeader string = "X-Client-Device"
+
+// ctxSourceDeviceKey holds the device of the client, as told by the header
+type ctxSourceDeviceKey struct{}
+
+// ClientDevice keeps the device told by the header in the context, for the todos created while resolving. The
+// devices unknown to SourceDevice are ignored
+func ClientDevice(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		device := SourceDevice(strings.ToUpper(strings.TrimSpace(r.Header.Get(SourceDeviceHeader))))
+		if !device.IsValid() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxSourceDeviceKey{}, device)))
+	})
+}
+
+// sourceDevice is the device the todo is created on, as given by the mutation, else by the header. It's
+// stored in lowercase, as the colors are
+func sourceDevice(ctx context.Context, given *SourceDevice) string {
+	device, _ := ctx.Value(ctxSourceDeviceKey{}).(SourceDevice)
+	if given != nil {
+		device = *given
+	}
+	if device == "" {
+		device = SourceDeviceUnknown
+	}
+	return strings.ToLower(device.String())
+}
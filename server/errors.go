@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// userMessages are the messages of the errors meant for the users, which tell what's wrong with their request
+var userMessages = map[string]bool{
+	MsgNotAuthenticated:         true,
+	MsgNotConfirmed:             true,
+	MsgLocked:                   true,
+	MsgNotAuthorized:            true,
+	MsgUserNotFound:             true,
+	MsgInvalidColor:             true,
+	MsgLabelExists:              true,
+	MsgWrongPassword:            true,
+	MsgInvalidPassword:          true,
+	MsgInvalidEmail:             true,
+	MsgInvalidName:              true,
+	MsgEmailExists:              true,
+	MsgCSRFInvalid:              true,
+	MsgInvalidCursor:            true,
+	MsgLimitExceeded:            true,
+	MsgQuotaExceeded:            true,
+	MsgAttachmentTooLarge:       true,
+	MsgAttachmentTypeNotAllowed: true,
+	MsgInvalidTakeout:           true,
+	MsgConflict:                 true,
+	MsgNotFound:                 true,
+	MsgUndoExpired:              true,
+	MsgInvalidIdempotencyKey:    true,
+	MsgInvalidWebhookURL:        true,
+	MsgNoWebhookEvents:          true,
+	MsgTimeout:                  true,
+	MsgInvalidTime:              true,
+	MsgTodoLocked:               true,
+	MsgTodoNotLocked:            true,
+	MsgInvalidPassphrase:        true,
+	MsgWrongPassphrase:          true,
+}
+
+// IsUserError tells whether the error is meant for the user, rather than an internal one like of the DB. Those
+// are the errors of the Msg constants, the GraphQL errors made on purpose & the records not found
+func IsUserError(err error) bool {
+	if gqlErr := (*gqlerror.Error)(nil); errors.As(err, &gqlErr) {
+		wrapped := errors.Unwrap(gqlErr) // The errors of the resolvers are wrapped along with their path
+		if wrapped == nil {
+			return true
+		}
+		err = wrapped
+	}
+	return userMessages[err.Error()] || gorm.IsRecordNotFoundError(err)
+}
+
+// notFound tells the user that nothing of theirs has the ID, in place of the error of gorm for the record not found
+func notFound(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New(MsgNotFound)
+	}
+	return err
+}
+
+// rowsAffected fails with the NotFound error, when the statement has changed no row, like when the row is
+// deleted meanwhile or isn't of the user
+func rowsAffected(db *gorm.DB) error {
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return errors.New(MsgNotFound)
+	}
+	return nil
+}
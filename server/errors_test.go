@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestIsUserError(t *testing.T) {
+	path := gqlast.Path{gqlast.PathName("todos")}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"message", errors.New(MsgNotFound), true},
+		{"message of the resolver", gqlerror.WrapPath(path, errors.New(MsgConflict)), true},
+		{"record not found", gorm.ErrRecordNotFound, true},
+		{"record not found of the resolver", gqlerror.WrapPath(path, gorm.ErrRecordNotFound), true},
+		{"made on purpose", gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", 12, 10), true},
+		{"of the DB", errors.New("no such table: todos"), false},
+		{"of the DB of the resolver", gqlerror.WrapPath(path, errors.New("database is locked")), false},
+		{"message wrapped", fmt.Errorf("saving -> %w", errors.New(MsgNotFound)), false}, // along with the internal details
+		{"message of another casing", errors.New(strings.ToLower(MsgNotFound)), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsUserError(test.err); got != test.want {
+				t.Errorf("got %v for %q, want %v", got, test.err, test.want)
+			}
+		})
+	}
+}
+
+// TestUserMessages checks every message of the Msg constants reaches the users in production
+func TestUserMessages(t *testing.T) {
+	packages, err := parser.ParseDir(token.NewFileSet(), ".", func(info os.FileInfo) bool { return !strings.HasSuffix(info.Name(), "_test.go") }, 0)
+	if err != nil {
+		t.Fatalf("Error while parsing the package -> %s", err)
+	}
+	count := 0
+	for _, file := range packages["server"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for index, name := range value.Names {
+					if !strings.HasPrefix(name.Name, "Msg") || index >= len(value.Values) {
+						continue
+					}
+					literal, ok := value.Values[index].(*ast.BasicLit)
+					if !ok {
+						continue
+					}
+					message, _ := strconv.Unquote(literal.Value)
+					count++
+					if !IsUserError(errors.New(message)) {
+						t.Errorf("%s is masked in production, as it's not of the user messages", name.Name)
+					}
+				}
+			}
+		}
+	}
+	if count == 0 {
+		t.Error("found no Msg constants")
+	}
+}
+
+func TestRowsAffected(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "rows@example.com")
+	tests := []struct {
+		name    string
+		query   func() *gorm.DB
+		wantErr string // none when empty
+	}{
+		{"changed", func() *gorm.DB { return db.Model(&User{}).Where("id = ?", user.ID).UpdateColumn("name", "Changed") }, ""},
+		{"changed none", func() *gorm.DB { return db.Model(&User{}).Where("id = ?", "missing").UpdateColumn("name", "Changed") }, MsgNotFound},
+		{"deleted none", func() *gorm.DB { return db.Where("id = ?", "missing").Delete(&Label{}) }, MsgNotFound},
+		{"failed", func() *gorm.DB { return db.Exec("DELETE FROM missing") }, "no such table: missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := rowsAffected(test.query())
+			if (err == nil) != (test.wantErr == "") || (err != nil && err.Error() != test.wantErr) {
+				t.Errorf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestMutationsNotFound runs the mutations on the rows missing, of another user or already gone, which are
+// not found rather than succeeding with nothing changed
+func TestMutationsNotFound(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	owner := newTestUser(t, db, "owner@example.com")
+	other := newTestUser(t, db, "other@example.com")
+	newTodo := func(t *testing.T) string { return newTestTodo(t, db, owner.ID, "Todo").ID }
+	newTrashedTodo := func(t *testing.T) string {
+		todo := newTestTodo(t, db, owner.ID, "Todo")
+		db.Delete(todo)
+		return todo.ID
+	}
+	newLabel := func(t *testing.T) string { return newTestLabel(t, db, owner.ID, "Work").ID }
+	newWebhook := func(t *testing.T) string {
+		id, _ := gonanoid.New(IDSize)
+		if err := db.Create(&Webhook{ID: id, URL: "https://hooks.example.com", UserID: owner.ID}).Error; err != nil {
+			t.Fatalf("Error while creating the webhook -> %s", err)
+		}
+		return id
+	}
+	tests := []struct {
+		name      string
+		create    func(t *testing.T) string
+		mutate    func(ctx context.Context, id string) error
+		unchanged string // counts 1 for the row created, as long as it's unchanged
+		repeated  bool   // succeeding again on the row of the owner
+	}{
+		{"deleteTodo", newTodo, func(ctx context.Context, id string) error {
+			_, err := resolver.Mutation().DeleteTodo(ctx, id)
+			return err
+		}, "SELECT count(*) FROM todos WHERE id = ? AND deleted_at IS NULL", false},
+		{"restoreTodo", newTrashedTodo, func(ctx context.Context, id string) error {
+			_, err := resolver.Mutation().RestoreTodo(ctx, id)
+			return err
+		}, "SELECT count(*) FROM todos WHERE id = ? AND deleted_at IS NOT NULL", false},
+		{"updateTodo", newTodo, func(ctx context.Context, id string) error {
+			title := "Changed"
+			_, err := resolver.Mutation().UpdateTodo(ctx, id, &title, nil, nil, nil, nil, nil)
+			return err
+		}, "SELECT count(*) FROM todos WHERE id = ? AND title = 'Todo'", true},
+		{"deleteLabel", newLabel, func(ctx context.Context, id string) error {
+			_, err := resolver.Mutation().DeleteLabel(ctx, id)
+			return err
+		}, "SELECT count(*) FROM labels WHERE id = ?", false},
+		{"renameLabel", newLabel, func(ctx context.Context, id string) error {
+			_, err := resolver.Mutation().RenameLabel(ctx, id, "Home")
+			return err
+		}, "SELECT count(*) FROM labels WHERE id = ? AND name = 'Work'", true},
+		{"unregisterWebhook", newWebhook, func(ctx context.Context, id string) error {
+			_, err := resolver.Mutation().UnregisterWebhook(ctx, id)
+			return err
+		}, "SELECT count(*) FROM webhooks WHERE id = ?", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.mutate(userContext(owner.ID), "missing"); err == nil || err.Error() != MsgNotFound {
+				t.Errorf("got error %v for the row missing, want %s", err, MsgNotFound)
+			}
+
+			id := test.create(t)
+			if err := test.mutate(userContext(other.ID), id); err == nil || err.Error() != MsgNotFound {
+				t.Errorf("got error %v for the row of another, want %s", err, MsgNotFound)
+			}
+			count := 0
+			db.Raw(test.unchanged, id).Row().Scan(&count)
+			if count != 1 {
+				t.Errorf("got the row of the owner changed by another")
+			}
+
+			if err := test.mutate(userContext(owner.ID), id); err != nil {
+				t.Fatalf("got error %s for the row of the owner", err)
+			}
+			if err := test.mutate(userContext(owner.ID), id); !test.repeated && (err == nil || err.Error() != MsgNotFound) {
+				t.Errorf("got error %v for the row already gone, want %s", err, MsgNotFound)
+			}
+		})
+	}
+}
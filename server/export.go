@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExportVersion is the version of the export format, bumped on the incompatible changes
+const ExportVersion int = 1
+
+// exportBatchSize is the number of todos loaded at a time, while streaming the export
+const exportBatchSize int = 100
+
+// ExportUser is the profile of the user in the export
+type ExportUser struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	ListMode bool   `json:"listMode"`
+	DarkMode bool   `json:"darkMode"`
+}
+
+// ExportLabel is a label of the user in the export
+type ExportLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// ExportNote is a note of a todo in the export
+type ExportNote struct {
+	Text        string `json:"text"`
+	IsCompleted bool   `json:"isCompleted"`
+	IsIndented  bool   `json:"isIndented,omitempty"`
+}
+
+// ExportAttachment describes an attachment of a todo in the export. The content is not exported
+type ExportAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+}
+
+// ExportCollaborator is a user, with whom a todo is shared
+type ExportCollaborator struct {
+	Email      string     `json:"email"`
+	Permission Permission `json:"permission"`
+}
+
+// ExportTemplate is a template of the user in the export, whose labels are referred to by their names too
+type ExportTemplate struct {
+	Name           string        `json:"name"`
+	Title          string        `json:"title"`
+	Notes          []*ExportNote `json:"notes"`
+	Labels         []string      `json:"labels"`
+	Color          string        `json:"color"`
+	IsCheckboxMode bool          `json:"isCheckboxMode"`
+}
+
+// ExportTodo is a todo owned by the user in the export. Labels are referred to by their names,
+// which are unique per user
+type ExportTodo struct {
+	Title          string                `json:"title"`
+	Notes          []*ExportNote         `json:"notes"`
+	Labels         []string              `json:"labels"`
+	Color          string                `json:"color"`
+	Background     string                `json:"background"`
+	IsCheckboxMode bool                  `json:"isCheckboxMode"`
+	IsPinned       bool                  `json:"isPinned"`
+	IsArchived     bool                  `json:"isArchived"`
+	IsTrashed      bool                  `json:"isTrashed"`
+	RemindAt       *time.Time            `json:"remindAt"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	Attachments    []*ExportAttachment   `json:"attachments"`
+	Collaborators  []*ExportCollaborator `json:"collaborators"`
+}
+
+// exportEncoder writes the export document piece by piece, remembering the first error
+type exportEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *exportEncoder) raw(format string, args ...interface{}) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.w, format, args...)
+	}
+}
+
+func (e *exportEncoder) value(v interface{}) {
+	if e.err == nil {
+		e.err = json.NewEncoder(e.w).Encode(v)
+	}
+}
+
+// WriteExport streams all the data owned by the user as a JSON document with 'version', 'exportedAt',
+// 'user', 'labels', 'templates' & 'todos', in the format of the Export types. The todos are loaded in batches,
+// so that large accounts aren't held in memory all at once
+func WriteExport(db *gorm.DB, userID string, w io.Writer) error {
+	user := User{ID: userID}
+	if err := db.First(&user).Error; err != nil {
+		return err
+	}
+	labels := []*Label{}
+	if err := db.Where("user_id = ?", userID).Order("name").Find(&labels).Error; err != nil {
+		return err
+	}
+	exportLabels := make([]*ExportLabel, len(labels))
+	for index, label := range labels {
+		exportLabels[index] = &ExportLabel{Name: label.Name, Color: label.Color}
+	}
+	templates := []*TodoTemplate{}
+	if err := db.Where("user_id = ?", userID).Order("name").Order("id").Preload("Labels").Find(&templates).Error; err != nil {
+		return err
+	}
+	exportTemplates := make([]*ExportTemplate, len(templates))
+	for index, template := range templates {
+		exportTemplates[index] = newExportTemplate(template)
+	}
+
+	encoder := &exportEncoder{w: w}
+	encoder.raw(`{"version":%d,"exportedAt":"%s","user":`, ExportVersion, time.Now().UTC().Format(time.RFC3339))
+	encoder.value(&ExportUser{Name: user.Name, Email: user.Email, ListMode: user.ListMode, DarkMode: user.DarkMode})
+	encoder.raw(`,"labels":`)
+	encoder.value(exportLabels)
+	encoder.raw(`,"templates":`)
+	encoder.value(exportTemplates)
+	encoder.raw(`,"todos":[`)
+	first := true
+	var last *Todo
+	for encoder.err == nil {
+		query := db.Unscoped().Where("user_id = ?", userID) // trashed todos are the user's data too
+		if last != nil {
+			query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		todos := []*Todo{}
+		if err := query.Order("created_at").Order("id").Limit(exportBatchSize).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+			return err
+		}
+		if len(todos) == 0 {
+			break
+		}
+		collaborators, err := exportCollaborators(db, todos)
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			if !first {
+				encoder.raw(",")
+			}
+			first = false
+			encoder.value(newExportTodo(todo, collaborators[todo.ID]))
+		}
+		last = todos[len(todos)-1]
+	}
+	encoder.raw("]}\n")
+	return encoder.err
+}
+
+// exportCollaborators finds the collaborators of the todos, by todo ID
+func exportCollaborators(db *gorm.DB, todos []*Todo) (map[string][]*ExportCollaborator, error) {
+	todoIDs := make([]string, len(todos))
+	for index, todo := range todos {
+		todoIDs[index] = todo.ID
+	}
+	rows := []struct {
+		TodoID     string
+		Email      string
+		Permission Permission
+	}{}
+	if err := db.Table("todo_collaborators").Select("todo_collaborators.todo_id, users.email, todo_collaborators.permission").Joins("JOIN users ON users.id = todo_collaborators.user_id").Where("todo_collaborators.todo_id IN (?)", todoIDs).Order("users.email").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	collaborators := map[string][]*ExportCollaborator{}
+	for _, row := range rows {
+		collaborators[row.TodoID] = append(collaborators[row.TodoID], &ExportCollaborator{Email: row.Email, Permission: row.Permission})
+	}
+	return collaborators, nil
+}
+
+func newExportTodo(todo *Todo, collaborators []*ExportCollaborator) *ExportTodo {
+	exportTodo := &ExportTodo{
+		Title:          todo.Title,
+		Notes:          make([]*ExportNote, len(todo.Notes)),
+		Labels:         make([]string, len(todo.Labels)),
+		Color:          todo.Color,
+		Background:     todo.Background,
+		IsCheckboxMode: todo.IsCheckboxMode,
+		IsPinned:       todo.IsPinned,
+		IsArchived:     todo.IsArchived,
+		IsTrashed:      todo.DeletedAt != nil,
+		RemindAt:       todo.RemindAt,
+		CreatedAt:      todo.CreatedAt,
+		Attachments:    make([]*ExportAttachment, len(todo.Attachments)),
+		Collaborators:  collaborators,
+	}
+	for index, note := range todo.Notes {
+		exportTodo.Notes[index] = &ExportNote{Text: note.Text, IsCompleted: note.IsCompleted, IsIndented: note.ParentID != nil}
+	}
+	for index, label := range todo.Labels {
+		exportTodo.Labels[index] = label.Name
+	}
+	for index, attachment := range todo.Attachments {
+		exportTodo.Attachments[index] = &ExportAttachment{Filename: attachment.Filename, ContentType: attachment.ContentType, Size: attachment.Size}
+	}
+	if exportTodo.Collaborators == nil {
+		exportTodo.Collaborators = []*ExportCollaborator{}
+	}
+	return exportTodo
+}
+
+func newExportTemplate(template *TodoTemplate) *ExportTemplate {
+	notes := template.Notes()
+	exportTemplate := &ExportTemplate{
+		Name:           template.Name,
+		Title:          template.Title,
+		Notes:          make([]*ExportNote, len(notes)),
+		Labels:         make([]string, len(template.Labels)),
+		Color:          template.Color,
+		IsCheckboxMode: template.IsCheckboxMode,
+	}
+	for index, note := range notes {
+		exportTemplate.Notes[index] = &ExportNote{Text: note.Text, IsCompleted: note.IsCompleted, IsIndented: note.ParentID != nil}
+	}
+	for index, label := range template.Labels {
+		exportTemplate.Labels[index] = label.Name
+	}
+	return exportTemplate
+}
+
+// NewExportHandler serves the export of all the data of the user at '/export', as a file to download
+func NewExportHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(CtxUserIDKey).(string)
+		if userID == "" {
+			http.Error(w, MsgNotAuthenticated, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="keepclone-export.json"`)
+		if err := WriteExport(db, userID, w); err != nil {
+			panic(http.ErrAbortHandler) // The response is already on its way, aborting tells the client that it's incomplete
+		}
+	}
+}
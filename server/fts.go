@@ -0,0 +1,125 @@
+package server
+
+import (
+	"html"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// snippetStart & snippetEnd surround the matches in the snippets of SQLite, to be replaced by the HTML tags
+// once the rest of the text is escaped
+const (
+	snippetStart string = "\x02"
+	snippetEnd   string = "\x03"
+)
+
+// searchIndexSchema is the FTS5 table with a row for each todo, and the triggers refreshing the row on changing
+// the todo or any of its notes. The trashed todos stay in the index, but are left out of the results
+var searchIndexSchema = []string{
+	`CREATE VIRTUAL TABLE todos_fts USING fts5(todo_id UNINDEXED, user_id UNINDEXED, title, notes, tokenize = 'unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER todos_fts_todo_insert AFTER INSERT ON todos BEGIN ` + refreshSearchRow("new.id") + ` END`,
+	`CREATE TRIGGER todos_fts_todo_update AFTER UPDATE OF title, user_id ON todos BEGIN ` + refreshSearchRow("new.id") + ` END`,
+	`CREATE TRIGGER todos_fts_todo_delete AFTER DELETE ON todos BEGIN DELETE FROM todos_fts WHERE todo_id = old.id; END`,
+	`CREATE TRIGGER todos_fts_note_insert AFTER INSERT ON notes BEGIN ` + refreshSearchRow("new.todo_id") + ` END`,
+	`CREATE TRIGGER todos_fts_note_update AFTER UPDATE OF text, todo_id ON notes BEGIN ` + refreshSearchRow("old.todo_id") + refreshSearchRow("new.todo_id") + ` END`,
+	`CREATE TRIGGER todos_fts_note_delete AFTER DELETE ON notes BEGIN ` + refreshSearchRow("old.todo_id") + ` END`,
+}
+
+// refreshSearchRow are the statements, which index the todo again along with the text of its notes
+func refreshSearchRow(todoID string) string {
+	return `DELETE FROM todos_fts WHERE todo_id = ` + todoID + `; ` +
+		`INSERT INTO todos_fts (todo_id, user_id, title, notes) ` +
+		`SELECT id, user_id, title, COALESCE((SELECT GROUP_CONCAT(text, CHAR(10)) FROM notes WHERE notes.todo_id = todos.id), '') ` +
+		`FROM todos WHERE id = ` + todoID + `; `
+}
+
+// SearchIndex ranks the todos matching a search with the full-text index of SQLite, on the builds with FTS5
+type SearchIndex struct {
+	db *gorm.DB
+}
+
+// NewSearchIndex creates the full-text index in the SQLite DB, unless it exists already. It fails, when SQLite
+// is built without FTS5 (the 'sqlite_fts5' build tag)
+func NewSearchIndex(db *gorm.DB) (*SearchIndex, error) {
+	index := &SearchIndex{db: db}
+	if db.HasTable("todos_fts") {
+		return index, nil
+	}
+	err := transaction(db, func(tx *gorm.DB) error {
+		for _, statement := range searchIndexSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, index.Rebuild()
+}
+
+// Rebuild indexes all the todos again, as after bulk changes bypassing the triggers
+func (i *SearchIndex) Rebuild() error {
+	return transaction(i.db, func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM todos_fts").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO todos_fts (todo_id, user_id, title, notes) ` +
+			`SELECT id, user_id, title, COALESCE((SELECT GROUP_CONCAT(text, CHAR(10)) FROM notes WHERE notes.todo_id = todos.id), '') ` +
+			`FROM todos`).Error
+	})
+}
+
+// search returns the hits of the user's todos (excluding trashed ones), the best ranked by bm25 first. The
+// matches in the title weigh more than those in the notes
+func (i *SearchIndex) search(userID string, query string) ([]*SearchHit, error) {
+	match := matchExpression(query)
+	if match == "" {
+		return []*SearchHit{}, nil
+	}
+	rows, err := i.db.Raw(`SELECT todos_fts.todo_id, `+
+		`snippet(todos_fts, 2, ?, ?, '…', 12), snippet(todos_fts, 3, ?, ?, '…', 24), bm25(todos_fts, 0, 0, 10.0, 1.0) AS score `+
+		`FROM todos_fts JOIN todos ON todos.id = todos_fts.todo_id `+
+		`WHERE todos_fts MATCH ? AND todos_fts.user_id = ? AND todos.deleted_at IS NULL `+
+		`ORDER BY score`, snippetStart, snippetEnd, snippetStart, snippetEnd, match, userID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hits := []*SearchHit{}
+	for rows.Next() {
+		var todoID, titleSnippet, notesSnippet string
+		var score float64
+		if err := rows.Scan(&todoID, &titleSnippet, &notesSnippet, &score); err != nil {
+			return nil, err
+		}
+		hits = append(hits, &SearchHit{
+			Todo:         &Todo{ID: todoID},
+			TitleSnippet: highlightSnippet(titleSnippet),
+			NotesSnippet: highlightSnippet(notesSnippet),
+			Rank:         -score, // bm25 is lower for the better matches
+		})
+	}
+	return hits, rows.Err()
+}
+
+// matchExpression turns the words of the query into prefixes, all of which have to match. Quoting each
+// word keeps the FTS5 syntax of the query from being interpreted
+func matchExpression(query string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlightSnippet escapes the snippet as HTML, marking the matches with <mark>
+func highlightSnippet(snippet string) *string {
+	if snippet == "" {
+		return nil
+	}
+	highlighted := strings.NewReplacer(snippetStart, "<mark>", snippetEnd, "</mark>").Replace(html.EscapeString(snippet))
+	return &highlighted
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MsgInvalidIdempotencyKey is the constant for Invalid Idempotency Key message
+const MsgInvalidIdempotencyKey string = "InvalidIdempotencyKey"
+
+// idempotencyKeyMaxLength is the longest key taken, ample for a UUID or a nanoid
+const idempotencyKeyMaxLength int = 128
+
+// idempotentCreation is the todo created with a key. It's pending until the creation is done, and the retries
+// racing it wait meanwhile
+type idempotentCreation struct {
+	todoID    string // empty while pending
+	done      chan struct{}
+	expiresAt time.Time
+}
+
+// IdempotencyLog keeps in memory the keys sent along with the todos created, so that a retry with the same key
+// gets the todo created already rather than a duplicate. The keys are of each user, and are forgotten after the
+// window
+type IdempotencyLog struct {
+	mu        sync.Mutex
+	window    time.Duration
+	creations map[string]*idempotentCreation // by userID & key
+}
+
+// NewIdempotencyLog creates an instance of IdempotencyLog, whose keys expire after the window
+func NewIdempotencyLog(window time.Duration) *IdempotencyLog {
+	return &IdempotencyLog{
+		window:    window,
+		creations: make(map[string]*idempotentCreation),
+	}
+}
+
+// begin gives the todo created with the key, if any. Otherwise the key is taken for the caller, who creates the
+// todo & tells its ID with finish, or an empty one when the creation failed, freeing the key for a retry. The
+// expired keys are dropped meanwhile. A retry stops waiting for the pending creation once its context is done
+func (l *IdempotencyLog) begin(ctx context.Context, userID string, key string) (todoID string, finish func(todoID string), err error) {
+	if key == "" || len(key) > idempotencyKeyMaxLength {
+		return "", nil, errors.New(MsgInvalidIdempotencyKey)
+	}
+	id := userID + "/" + key
+	for {
+		now := time.Now()
+		l.mu.Lock()
+		for id, creation := range l.creations {
+			if creation.todoID != "" && now.After(creation.expiresAt) {
+				delete(l.creations, id)
+			}
+		}
+		creation := l.creations[id]
+		if creation == nil {
+			creation = &idempotentCreation{done: make(chan struct{})}
+			l.creations[id] = creation
+			l.mu.Unlock()
+			return "", func(todoID string) { l.finish(id, creation, todoID) }, nil
+		}
+		l.mu.Unlock()
+		select {
+		case <-creation.done:
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+		if creation.todoID != "" {
+			return creation.todoID, nil, nil
+		}
+		// The creation failed, so the retry takes the key over
+	}
+}
+
+func (l *IdempotencyLog) finish(id string, creation *idempotentCreation, todoID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	creation.todoID = todoID
+	creation.expiresAt = time.Now().Add(l.window)
+	if todoID == "" {
+		delete(l.creations, id)
+	}
+	close(creation.done)
+}
+
+// replay gives the todo created already with the key, or else the finish for the caller to tell the todo it
+// creates. No key makes no replay, as the clients not retrying need none
+func (l *IdempotencyLog) replay(ctx context.Context, db *gorm.DB, userID string, key *string) (*Todo, func(todoID string), error) {
+	if key == nil {
+		return nil, func(string) {}, nil
+	}
+	todoID, finish, err := l.begin(ctx, userID, *key)
+	if err != nil || finish != nil {
+		return nil, finish, err
+	}
+	todo := Todo{}
+	if err := db.Where("id = ? AND user_id = ?", todoID, userID).Preload("Notes", orderedNotes).Preload("Labels").First(&todo).Error; err != nil { // Trashed since, it's not brought back
+		return nil, nil, notFound(err)
+	}
+	return &todo, nil, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyLogBegin(t *testing.T) {
+	log := NewIdempotencyLog(time.Minute)
+	_, finish, err := log.begin(context.Background(), "user", "key")
+	if err != nil || finish == nil {
+		t.Fatalf("got finish %v & error %v, want the key taken", finish != nil, err)
+	}
+
+	// The retry waiting for the pending creation gives up with its request
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	returned := make(chan error, 1)
+	go func() {
+		_, _, err := log.begin(ctx, "user", "key")
+		returned <- err
+	}()
+	select {
+	case err := <-returned:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the retry still waits for the pending creation, its context being done")
+	}
+
+	// The creation is still told of to the retries after
+	finish("todo")
+	todoID, finish, err := log.begin(context.Background(), "user", "key")
+	if err != nil || finish != nil || todoID != "todo" {
+		t.Fatalf("got todo %q, finish %v & error %v, want the todo created", todoID, finish != nil, err)
+	}
+}
+
+func TestIdempotencyLogBeginRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		created string
+		want    string // todo given to the retry, which takes the key over when empty
+	}{
+		{"created", "todo", "todo"},
+		{"failed", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := NewIdempotencyLog(time.Minute)
+			_, finish, _ := log.begin(context.Background(), "user", "key")
+			type result struct {
+				todoID string
+				taken  bool
+				err    error
+			}
+			results := make(chan result, 1)
+			go func() {
+				todoID, finish, err := log.begin(context.Background(), "user", "key")
+				results <- result{todoID, finish != nil, err}
+			}()
+			time.Sleep(20 * time.Millisecond) // for the retry to wait
+			finish(test.created)
+			got := <-results
+			if got.err != nil || got.todoID != test.want || got.taken != (test.want == "") {
+				t.Errorf("got todo %q, key taken %v & error %v, want todo %q", got.todoID, got.taken, got.err, test.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyLogBeginInvalidKey(t *testing.T) {
+	log := NewIdempotencyLog(time.Minute)
+	for _, key := range []string{"", string(make([]byte, idempotencyKeyMaxLength+1))} {
+		if _, _, err := log.begin(context.Background(), "user", key); err == nil || err.Error() != MsgInvalidIdempotencyKey {
+			t.Errorf("got error %v for a key of %d bytes, want %s", err, len(key), MsgInvalidIdempotencyKey)
+		}
+	}
+}
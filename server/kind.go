@@ -0,0 +1,34 @@
+package server
+
+import (
+	"strings"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// convertNotes turns the notes into those of the other kind of todo. The lines of a text become the items of
+// a checklist, leaving out the blank ones, while the items become the lines, no longer completed
+func convertNotes(notes []*Note, kind TodoKind) []*Note {
+	texts := []string{}
+	for _, note := range notes {
+		if kind == TodoKindText {
+			texts = append(texts, note.Text)
+			continue
+		}
+		for _, line := range strings.Split(note.Text, "\n") {
+			if strings.TrimSpace(line) != "" {
+				texts = append(texts, line)
+			}
+		}
+	}
+	converted := make([]*Note, len(texts))
+	for index, text := range texts {
+		newNoteID, _ := gonanoid.New(IDSize)
+		converted[index] = &Note{
+			ID:       newNoteID,
+			Text:     text,
+			Position: index,
+		}
+	}
+	return converted
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// labelStreamBufferSize is the number of the label events waiting for a label stream, before it's dropped
+const labelStreamBufferSize = 100
+
+// LabelHub delivers the changes of the labels to the label streams of their users. A stream, whose client falls
+// behind by the whole buffer, is dropped rather than waited on, for the client to subscribe & fetch the labels again
+type LabelHub struct {
+	mu      sync.Mutex
+	streams map[string]map[chan *LabelAction]struct{} // by userID
+}
+
+// NewLabelHub creates an instance of LabelHub, which looks out for the changes of the labels in the DB
+func NewLabelHub(db *gorm.DB) *LabelHub {
+	hub := &LabelHub{streams: make(map[string]map[chan *LabelAction]struct{})}
+	registerCallbacks(db, func(callback *gorm.Callback) {
+		callback.Create().Register("labelhub:create", func(scope *gorm.Scope) {
+			if createdLabel, ok := scope.Value.(*Label); ok && !scope.HasError() && scope.TableName() == "labels" {
+				afterCommit(scope, func() { hub.publish(ActionCreated, createdLabel) })
+			}
+		})
+		callback.Update().Register("labelhub:update", func(scope *gorm.Scope) {
+			if updatedLabel, ok := scope.Value.(*Label); ok && !scope.HasError() && scope.TableName() == "labels" {
+				afterCommit(scope, func() { hub.publish(ActionUpdated, updatedLabel) })
+			}
+		})
+	})
+	return hub
+}
+
+// subscribe streams the events of the labels of the user, till done
+func (h *LabelHub) subscribe(userID string, done <-chan struct{}) <-chan *LabelAction {
+	stream := make(chan *LabelAction, labelStreamBufferSize)
+	h.mu.Lock()
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[chan *LabelAction]struct{})
+	}
+	h.streams[userID][stream] = struct{}{}
+	h.mu.Unlock()
+	go func() {
+		<-done
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.drop(userID, stream)
+	}()
+	return stream
+}
+
+// drop closes the stream, unless dropped already. The hub is locked
+func (h *LabelHub) drop(userID string, stream chan *LabelAction) {
+	if _, ok := h.streams[userID][stream]; !ok {
+		return
+	}
+	delete(h.streams[userID], stream)
+	if len(h.streams[userID]) == 0 {
+		delete(h.streams, userID)
+	}
+	close(stream)
+}
+
+// publish sends the event of the label to the streams of its user, dropping those which are full
+func (h *LabelHub) publish(action Action, label *Label) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for stream := range h.streams[label.UserID] {
+		select {
+		case stream <- &LabelAction{Action: action, Label: label}:
+		default:
+			h.drop(label.UserID, stream)
+		}
+	}
+}
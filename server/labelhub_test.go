@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLabelStreamOfOwnLabels(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	resolver.LabelEvents = NewLabelHub(db)
+	alice := newTestUser(t, db, "alice@example.com")
+	bob := newTestUser(t, db, "bob@example.com")
+	subscribe := func(userID string) <-chan *LabelAction {
+		ctx, cancel := context.WithCancel(userContext(userID))
+		t.Cleanup(cancel)
+		stream, err := resolver.Subscription().LabelStream(ctx)
+		if err != nil {
+			t.Fatalf("LabelStream() error = %v", err)
+		}
+		return stream
+	}
+	aliceStream, bobStream := subscribe(alice.ID), subscribe(bob.ID)
+
+	label, err := resolver.Mutation().CreateLabel(userContext(alice.ID), "Work")
+	if err != nil {
+		t.Fatalf("CreateLabel() error = %v", err)
+	}
+	if _, err := resolver.Mutation().RenameLabel(userContext(alice.ID), label.ID, "Office"); err != nil {
+		t.Fatalf("RenameLabel() error = %v", err)
+	}
+	if _, err := resolver.Mutation().CreateLabel(userContext(bob.ID), "Home"); err != nil {
+		t.Fatalf("CreateLabel() error = %v", err)
+	}
+
+	tests := []struct {
+		stream <-chan *LabelAction
+		want   []LabelAction
+	}{
+		{aliceStream, []LabelAction{{Action: ActionCreated, Label: &Label{Name: "Work"}}, {Action: ActionUpdated, Label: &Label{Name: "Office"}}}},
+		{bobStream, []LabelAction{{Action: ActionCreated, Label: &Label{Name: "Home"}}}},
+	}
+	for index, test := range tests {
+		for _, want := range test.want {
+			select {
+			case event := <-test.stream:
+				if event.Action != want.Action || event.Label.Name != want.Label.Name {
+					t.Errorf("stream #%d event = %s of '%s', want %s of '%s'", index+1, event.Action, event.Label.Name, want.Action, want.Label.Name)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("stream #%d has no event %s of '%s'", index+1, want.Action, want.Label.Name)
+			}
+		}
+		select {
+		case event := <-test.stream:
+			t.Errorf("stream #%d has the unexpected event %s of '%s'", index+1, event.Action, event.Label.Name)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestLabelHubDropsSlowStream(t *testing.T) {
+	hub := NewLabelHub(newTestDB(t))
+	done := make(chan struct{})
+	defer close(done)
+	stream := hub.subscribe("slow", done)
+	other := hub.subscribe("other", done)
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i <= labelStreamBufferSize; i++ {
+			hub.publish(ActionUpdated, &Label{UserID: "slow"})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing waits on the stream, which isn't read")
+	}
+
+	received := 0
+	for range stream {
+		received++
+	}
+	if received != labelStreamBufferSize {
+		t.Errorf("received %d events before dropping, want %d", received, labelStreamBufferSize)
+	}
+	hub.publish(ActionCreated, &Label{UserID: "other"})
+	if event := <-other; event.Action != ActionCreated {
+		t.Errorf("event of the other = %s, want %s", event.Action, ActionCreated)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// DefaultLabelSuggestions is the number of labels suggested, when 'limit' is not given
+	DefaultLabelSuggestions int = 10
+	// MaxLabelSuggestions is the maximum number of labels that can be suggested at once
+	MaxLabelSuggestions int = 50
+)
+
+// suggestionLimit bounds the number of suggestions asked for
+func suggestionLimit(limit *int) int {
+	if limit == nil || *limit <= 0 {
+		return DefaultLabelSuggestions
+	}
+	if *limit > MaxLabelSuggestions {
+		return MaxLabelSuggestions
+	}
+	return *limit
+}
+
+// suggestLabels returns the user's labels whose name contains the prefix case-insensitively. Those starting with
+// the prefix come first, then the ones on the most todos (excluding trashed ones), and the rest by name
+func suggestLabels(db *gorm.DB, userID string, prefix string, limit int) ([]*Label, error) {
+	escaped := likeEscaper.Replace(strings.ToLower(prefix))
+	labels := []*Label{}
+	err := db.Table("labels").Select("labels.*").
+		Joins("LEFT JOIN todos_labels ON todos_labels.label_id = labels.id").
+		Joins("LEFT JOIN todos ON todos.id = todos_labels.todo_id AND todos.deleted_at IS NULL").
+		Where("labels.user_id = ? AND LOWER(labels.name) LIKE ? ESCAPE '!'", userID, "%"+escaped+"%").
+		Group("labels.id").
+		Order(gorm.Expr("CASE WHEN LOWER(labels.name) LIKE ? ESCAPE '!' THEN 0 ELSE 1 END", escaped+"%")).
+		Order("COUNT(todos.id) desc").Order("labels.name").
+		Limit(limit).
+		Find(&labels).Error
+	return labels, err
+}
+
+// findLabelByName loads the user's label of the name, ignoring the case
+func findLabelByName(db *gorm.DB, userID string, name string) (*Label, error) {
+	label := &Label{}
+	if err := db.Where("user_id = ? AND LOWER(name) = ?", userID, strings.ToLower(name)).First(label).Error; err != nil {
+		return nil, err
+	}
+	return label, nil
+}
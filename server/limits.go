@@ -0,0 +1,76 @@
+package server
+
+import (
+	"unicode/utf8"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// MsgLimitExceeded is the constant for Limit Exceeded message
+const MsgLimitExceeded string = "LimitExceeded"
+
+// newLimitError tells the client, which of the limits is exceeded, in 'extensions'
+func newLimitError(field string, max int) error {
+	return &gqlerror.Error{
+		Message: MsgLimitExceeded,
+		Extensions: map[string]interface{}{
+			"code":  "LIMIT_EXCEEDED",
+			"field": field,
+			"max":   max,
+		},
+	}
+}
+
+// checkTitle tells whether the title of a todo is within the limit, counted in characters
+func (l *Limits) checkTitle(title string) error {
+	if utf8.RuneCountInString(title) > l.MaxTitleLength {
+		return newLimitError("title", l.MaxTitleLength)
+	}
+	return nil
+}
+
+// checkNotes tells whether the number of the notes of a todo, as well as each of their texts, are within the limits
+func (l *Limits) checkNotes(texts []string) error {
+	if len(texts) > l.MaxNotes {
+		return newLimitError("notes", l.MaxNotes)
+	}
+	for _, text := range texts {
+		if utf8.RuneCountInString(text) > l.MaxNoteLength {
+			return newLimitError("text", l.MaxNoteLength)
+		}
+	}
+	return nil
+}
+
+// checkLabels tells whether the number of the labels of a todo is within the limit
+func (l *Limits) checkLabels(count int) error {
+	if count > l.MaxLabels {
+		return newLimitError("labels", l.MaxLabels)
+	}
+	return nil
+}
+
+// checkTodoInput tells whether the todo to create is within the limits
+func (l *Limits) checkTodoInput(title string, texts []string, labels int) error {
+	if err := l.checkTitle(title); err != nil {
+		return err
+	}
+	if err := l.checkNotes(texts); err != nil {
+		return err
+	}
+	return l.checkLabels(labels)
+}
+
+// checkTodo tells whether the whole todo is within the limits
+func (l *Limits) checkTodo(todo *Todo) error {
+	return l.checkTodoInput(todo.Title, noteTexts(todo.Notes), len(todo.Labels))
+}
+
+// noteTexts is the text of each of the notes
+func noteTexts(notes []*Note) []string {
+	texts := make([]string, len(notes))
+	for index, note := range notes {
+		texts[index] = note.Text
+	}
+	return texts
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// MsgTodoLocked is the constant for Todo Locked message
+	MsgTodoLocked string = "TodoLocked"
+	// MsgTodoNotLocked is the constant for Todo Not Locked message
+	MsgTodoNotLocked string = "TodoNotLocked"
+	// MsgInvalidPassphrase is the constant for Invalid Passphrase message
+	MsgInvalidPassphrase string = "InvalidPassphrase"
+	// MsgWrongPassphrase is the constant for Wrong Passphrase message
+	MsgWrongPassphrase string = "WrongPassphrase"
+)
+
+// The passphrases are long enough not to be guessed offline in a hurry, even at the cost of the key derivation
+const (
+	passphraseMinLength int = 8
+	passphraseMaxLength int = 1024
+)
+
+// The key of each locked todo is derived from the passphrase & a salt of the todo with Argon2id, of the parameters
+// recommended by RFC 9106 for the memory constrained. They are kept along with the content, so that the todos
+// locked before stay readable, when they're raised
+const (
+	lockKDFTime    uint32 = 3
+	lockKDFMemory  uint32 = 64 * 1024 // in KiB
+	lockKDFThreads uint8  = 4
+	lockSaltSize   int    = 16
+	lockKeySize    uint32 = 32 // for AES-256
+)
+
+// keyDerivations caps the key derivations at once, as each takes the memory of lockKDFMemory
+var keyDerivations = make(chan struct{}, 2)
+
+// checkPassphrase tells whether the passphrase may lock a todo
+func checkPassphrase(passphrase string) error {
+	if length := utf8.RuneCountInString(passphrase); length < passphraseMinLength || length > passphraseMaxLength {
+		return errors.New(MsgInvalidPassphrase)
+	}
+	return nil
+}
+
+// checkUnlocked tells whether the notes of the todo may be changed, which they can't be while they're locked
+func checkUnlocked(todo *Todo) error {
+	if todo.IsLocked {
+		return errors.New(MsgTodoLocked)
+	}
+	return nil
+}
+
+func deriveLockKey(passphrase string, salt []byte, time uint32, memory uint32, threads uint8) []byte {
+	keyDerivations <- struct{}{}
+	defer func() { <-keyDerivations }()
+	return argon2.IDKey([]byte(passphrase), salt, time, memory, threads, lockKeySize)
+}
+
+// newLockCipher is AES-256 in GCM of the key derived from the passphrase
+func newLockCipher(passphrase string, salt []byte, time uint32, memory uint32, threads uint8) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveLockKey(passphrase, salt, time, memory, threads))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealNotes encrypts the notes of the todo with the passphrase, into the content kept while it's locked. The
+// content is '$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<nonce & ciphertext>', in base64 without
+// padding like the PHC strings of the password hashes. The ID of the todo is authenticated along, so that the
+// content can't be moved to another todo
+func sealNotes(todo *Todo, passphrase string) (string, error) {
+	plaintext, err := json.Marshal(todo.Notes)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, lockSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := newLockCipher(passphrase, salt, lockKDFTime, lockKDFMemory, lockKDFThreads)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(todo.ID))
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, lockKDFMemory, lockKDFTime, lockKDFThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(sealed)), nil
+}
+
+// openNotes decrypts the notes of the locked todo with the passphrase. A wrong passphrase fails alike a tampered
+// content, as GCM tells them not apart
+func openNotes(todo *Todo, passphrase string) ([]*Note, error) {
+	if !todo.IsLocked || todo.LockedContent == nil {
+		return nil, errors.New(MsgTodoNotLocked)
+	}
+	parts := strings.Split(*todo.LockedContent, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("the locked content of todo %s is malformed", todo.ID)
+	}
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("the locked content of todo %s is of an unknown Argon2 version", todo.ID)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return nil, fmt.Errorf("the locked content of todo %s is malformed -> %s", todo.ID, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newLockCipher(passphrase, salt, time, memory, threads)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("the locked content of todo %s is truncated", todo.ID)
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(todo.ID))
+	if err != nil {
+		return nil, errors.New(MsgWrongPassphrase)
+	}
+	notes := []*Note{}
+	if err := json.Unmarshal(plaintext, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCheckPassphrase(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase string
+		wantValid  bool
+	}{
+		{"empty", "", false},
+		{"too short", "1234567", false},
+		{"shortest", "12345678", true},
+		{"shortest of runes", "ßßßßßßßß", true}, // of 16 bytes
+		{"too short of runes", "ßßßßßßß", false},
+		{"longest", strings.Repeat("a", passphraseMaxLength), true},
+		{"too long", strings.Repeat("a", passphraseMaxLength+1), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := checkPassphrase(test.passphrase); (err == nil) != test.wantValid || (err != nil && err.Error() != MsgInvalidPassphrase) {
+				t.Errorf("got error %v, want valid %v", err, test.wantValid)
+			}
+		})
+	}
+}
+
+func TestOpenNotes(t *testing.T) {
+	parentID := "first"
+	todo := &Todo{ID: "todo", Notes: []*Note{{ID: "first", Text: "password: hunter2"}, {ID: "second", Text: "PIN: 1234", IsCompleted: true, Position: 1, ParentID: &parentID}}}
+	content, err := sealNotes(todo, "correct horse")
+	if err != nil {
+		t.Fatalf("Error while sealing the notes -> %s", err)
+	}
+	if strings.Contains(content, "hunter2") || strings.Contains(content, "1234") {
+		t.Errorf("got the notes readable in the content sealed %s", content)
+	}
+	other, err := sealNotes(todo, "correct horse")
+	if err != nil || other == content {
+		t.Errorf("got the content sealed again alike & error %v, want of another salt & nonce", err)
+	}
+	parts := strings.Split(content, "$")
+	with := func(index int, part string) string {
+		changed := append([]string{}, parts...)
+		changed[index] = part
+		return strings.Join(changed, "$")
+	}
+	tampered, _ := base64.RawStdEncoding.DecodeString(parts[5]) // a bit of the text flipped might be no base64
+	tampered[len(tampered)/2] ^= 1
+	tests := []struct {
+		name       string
+		id         string
+		locked     bool
+		content    string
+		passphrase string
+		wantError  string // empty when opened, any when '*'
+	}{
+		{"right passphrase", "todo", true, content, "correct horse", ""},
+		{"wrong passphrase", "todo", true, content, "correct horsE", MsgWrongPassphrase},
+		{"moved to another todo", "other", true, content, "correct horse", MsgWrongPassphrase},
+		{"ciphertext tampered", "todo", true, with(5, base64.RawStdEncoding.EncodeToString(tampered)), "correct horse", MsgWrongPassphrase},
+		{"salt of another", "todo", true, with(4, strings.Split(other, "$")[4]), "correct horse", MsgWrongPassphrase},
+		{"time lowered", "todo", true, with(3, strings.Replace(parts[3], "t=3", "t=1", 1)), "correct horse", MsgWrongPassphrase},
+		{"truncated", "todo", true, with(5, parts[5][:8]), "correct horse", "*"},
+		{"other version", "todo", true, with(2, "v=16"), "correct horse", "*"},
+		{"other algorithm", "todo", true, with(1, "scrypt"), "correct horse", "*"},
+		{"missing part", "todo", true, strings.Join(parts[:5], "$"), "correct horse", "*"},
+		{"not base64", "todo", true, with(5, "not base64!"), "correct horse", "*"},
+		{"not locked", "todo", false, content, "correct horse", MsgTodoNotLocked},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := test.content
+			notes, err := openNotes(&Todo{ID: test.id, IsLocked: test.locked, LockedContent: &content}, test.passphrase)
+			if test.wantError != "" {
+				if err == nil || (test.wantError != "*" && err.Error() != test.wantError) {
+					t.Errorf("got error %v, want %s", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if len(notes) != 2 || notes[0].Text != "password: hunter2" || notes[1].Text != "PIN: 1234" || !notes[1].IsCompleted || notes[1].ParentID == nil || *notes[1].ParentID != "first" {
+				t.Errorf("got notes %+v, want those sealed", notes)
+			}
+		})
+	}
+}
+
+// TestLockTodo locks the notes of the todo, which are stored sealed only, and opened by the passphrase of that todo
+func TestLockTodo(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "lock@example.com")
+	ctx := userContext(user.ID)
+	locked := newTestTodo(t, db, user.ID, "Passwords")
+	if _, err := resolver.Mutation().PatchTodo(ctx, locked.ID, TodoPatch{Notes: []*NotesInput{{Text: "hunter2"}}}); err != nil {
+		t.Fatalf("Error while adding the note -> %s", err)
+	}
+	if _, err := resolver.Mutation().LockTodo(ctx, locked.ID, "short"); err == nil || err.Error() != MsgInvalidPassphrase {
+		t.Errorf("got error %v locking with a short passphrase, want %s", err, MsgInvalidPassphrase)
+	}
+	if _, err := resolver.Mutation().LockTodo(ctx, locked.ID, "correct horse"); err != nil {
+		t.Fatalf("Error while locking the todo -> %s", err)
+	}
+	if _, err := resolver.Mutation().LockTodo(ctx, locked.ID, "correct horse"); err == nil || err.Error() != MsgTodoLocked {
+		t.Errorf("got error %v locking again, want %s", err, MsgTodoLocked)
+	}
+	stored := Todo{}
+	db.Where("id = ?", locked.ID).First(&stored)
+	notes, revisions := 0, 0
+	db.Model(&Note{}).Where("todo_id = ?", locked.ID).Count(&notes)
+	db.Model(&TodoRevision{}).Where("todo_id = ?", locked.ID).Count(&revisions)
+	if !stored.IsLocked || stored.LockedContent == nil || strings.Contains(*stored.LockedContent, "hunter2") || notes != 0 || revisions != 0 {
+		t.Fatalf("got the todo stored locked %v with %d notes & %d revisions, want only the sealed content", stored.IsLocked, notes, revisions)
+	}
+	// The content sealed for the todo, moved to another locked todo, isn't opened there
+	moved := newTestTodo(t, db, user.ID, "Moved")
+	db.Model(moved).UpdateColumns(map[string]interface{}{"is_locked": true, "locked_content": *stored.LockedContent})
+
+	tests := []struct {
+		name       string
+		id         string
+		passphrase string
+		wantError  string // empty when unlocked
+	}{
+		{"right passphrase", locked.ID, "correct horse", ""},
+		{"wrong passphrase", locked.ID, "wrong horse", MsgWrongPassphrase},
+		{"moved content", moved.ID, "correct horse", MsgWrongPassphrase},
+		{"not locked", newTestTodo(t, db, user.ID, "Plain").ID, "correct horse", MsgTodoNotLocked},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todo, err := resolver.Mutation().UnlockTodo(ctx, test.id, test.passphrase)
+			if test.wantError != "" {
+				if err == nil || err.Error() != test.wantError {
+					t.Errorf("got error %v, want %s", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if len(todo.Notes) != 1 || todo.Notes[0].Text != "hunter2" || !todo.IsLocked {
+				t.Errorf("got notes %+v locked %v, want the note opened & the todo still locked", todo.Notes, todo.IsLocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/volatiletech/authboss/v3"
+	"github.com/volatiletech/authboss/v3/lock"
+)
+
+// ignoringRedirector redirects nowhere, the test telling the logins refused by the users stored
+type ignoringRedirector struct{}
+
+func (ignoringRedirector) Redirect(w http.ResponseWriter, r *http.Request, ro authboss.RedirectOptions) error {
+	return nil
+}
+
+func TestLockout(t *testing.T) {
+	const (
+		lockAfter    = 3
+		lockWindow   = 5 * time.Minute
+		lockDuration = 15 * time.Minute
+	)
+	tests := []struct {
+		name         string
+		attempts     int
+		lastAttempt  time.Duration // ago
+		lockedFor    time.Duration // from now, unlocked when not after
+		logins       string        // 'x' failing, 'o' succeeding
+		wantLocked   bool
+		wantAttempts int
+		wantRefused  int // of the succeeding logins
+	}{
+		{"failing under the limit", 0, 0, 0, "xx", false, 2, 0},
+		{"failing up to the limit", 0, 0, 0, "xxx", true, 3, 0},
+		{"refused once locked", 0, 0, 0, "xxxo", true, 3, 1},
+		{"succeeding resets", 0, 0, 0, "xxoxx", false, 2, 0},
+		{"failing after the window starts over", 2, lockWindow + time.Minute, 0, "x", false, 1, 0},
+		{"failing within the window adds up", 2, lockWindow - time.Minute, 0, "x", true, 3, 0},
+		{"locked still", 3, time.Minute, lockDuration - 2*time.Minute, "o", true, 3, 1},
+		{"lock expired", 3, lockDuration + time.Minute, -time.Minute, "o", false, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			user := newTestUser(t, db, "lockout@example.com")
+			now := time.Now().UTC()
+			if err := db.Model(user).Updates(map[string]interface{}{"attempt_count": test.attempts, "last_attempt": now.Add(-test.lastAttempt), "locked": now.Add(test.lockedFor)}).Error; err != nil {
+				t.Fatalf("Error while setting the attempts -> %s", err)
+			}
+			storer := NewDBStorer(db, nil)
+			ab := authboss.New()
+			ab.Config.Storage.Server = storer
+			ab.Config.Core.Redirector = ignoringRedirector{}
+			ab.Config.Modules.LockAfter = lockAfter
+			ab.Config.Modules.LockWindow = lockWindow
+			ab.Config.Modules.LockDuration = lockDuration
+			locker := &lock.Lock{}
+			if err := locker.Init(ab); err != nil {
+				t.Fatalf("Error while initialising the lock -> %s", err)
+			}
+
+			refused := 0
+			for _, login := range test.logins {
+				loaded, err := storer.Load(context.Background(), user.Email)
+				if err != nil {
+					t.Fatalf("Error while loading the user -> %s", err)
+				}
+				r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+				r = r.WithContext(context.WithValue(r.Context(), authboss.CTXKeyUser, loaded))
+				w := httptest.NewRecorder()
+				if login == 'x' {
+					if _, err := locker.AfterAuthFail(w, r, false); err != nil {
+						t.Fatalf("Error while failing the login -> %s", err)
+					}
+					continue
+				}
+				handled, err := locker.BeforeAuth(w, r, false)
+				if err != nil {
+					t.Fatalf("Error before the login -> %s", err)
+				}
+				if handled {
+					refused++
+					continue
+				}
+				if _, err := locker.AfterAuthSuccess(w, r, false); err != nil {
+					t.Fatalf("Error after the login -> %s", err)
+				}
+			}
+
+			stored := User{ID: user.ID}
+			if err := db.First(&stored).Error; err != nil {
+				t.Fatalf("Error while reading the user -> %s", err)
+			}
+			if lock.IsLocked(&stored) != test.wantLocked || stored.AttemptCount != test.wantAttempts || refused != test.wantRefused {
+				t.Errorf("got locked %v, %d attempts & %d refused, want locked %v, %d attempts & %d refused", lock.IsLocked(&stored), stored.AttemptCount, refused, test.wantLocked, test.wantAttempts, test.wantRefused)
+			}
+		})
+	}
+}
+
+func TestLockUser(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	admin := newTestUser(t, db, "admin@example.com")
+	user := newTestUser(t, db, "locked@example.com")
+	ctx := userContext(admin.ID)
+	if _, err := resolver.Mutation().LockUser(ctx, admin.ID); err == nil || err.Error() != MsgNotAuthorized {
+		t.Errorf("got error %v locking oneself, want %s", err, MsgNotAuthorized)
+	}
+	if _, err := resolver.Mutation().LockUser(ctx, user.ID); err != nil {
+		t.Fatalf("Error while locking the user -> %s", err)
+	}
+	stored := User{ID: user.ID}
+	db.First(&stored)
+	if !lock.IsLocked(&stored) || stored.Locked.Before(time.Now().Add(adminLockDuration-time.Hour)) {
+		t.Errorf("got the user locked until %s, want until far off", stored.Locked)
+	}
+	db.Model(&stored).UpdateColumn("attempt_count", 5)
+	if _, err := resolver.Mutation().UnlockUser(ctx, user.ID); err != nil {
+		t.Fatalf("Error while unlocking the user -> %s", err)
+	}
+	stored = User{ID: user.ID}
+	db.First(&stored)
+	if lock.IsLocked(&stored) || stored.AttemptCount != 0 {
+		t.Errorf("got the user locked %v with %d attempts, want unlocked with none", lock.IsLocked(&stored), stored.AttemptCount)
+	}
+}
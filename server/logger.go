@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/volatiletech/authboss/v3"
+)
+
+// LogLevel is the verbosity of the Logger
+type LogLevel int
+
+// Log levels in the increasing order of severity
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "DEBUG",
+	LogLevelInfo:  "INFO",
+	LogLevelWarn:  "WARN",
+	LogLevelError: "ERROR",
+}
+
+// ParseLogLevel parses the level names 'debug', 'info', 'warn' & 'error'
+func ParseLogLevel(level string) (LogLevel, error) {
+	for logLevel, name := range logLevelNames {
+		if strings.EqualFold(level, name) {
+			return logLevel, nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level '%s'", level)
+}
+
+// Logger is a levelled logger, writing 'key=value' fields along with the message
+type Logger struct {
+	level  LogLevel
+	fields string
+	out    *log.Logger
+}
+
+// NewLogger creates a Logger writing to stderr the messages of the given level & above
+func NewLogger(level LogLevel) *Logger {
+	return &Logger{
+		level: level,
+		out:   log.New(os.Stderr, "", log.LstdFlags),
+	}
+}
+
+// With returns a copy of the Logger, which adds the field to every message
+func (l *Logger) With(key string, value interface{}) *Logger {
+	return &Logger{
+		level:  l.level,
+		fields: fmt.Sprintf("%s %s=%v", l.fields, key, value),
+		out:    l.out,
+	}
+}
+
+// WithContext returns a copy of the Logger with the request ID & the user of the context
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	if requestID, _ := ctx.Value(CtxRequestIDKey).(string); requestID != "" {
+		l = l.With("request", requestID)
+	}
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		l = l.With("user", userID)
+	}
+	return l
+}
+
+func (l *Logger) logf(level LogLevel, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+	l.out.Printf("%-5s %s%s", logLevelNames[level], fmt.Sprintf(format, args...), l.fields)
+}
+
+// Debugf logs at debug level
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LogLevelDebug, format, args...)
+}
+
+// Infof logs at info level
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LogLevelInfo, format, args...)
+}
+
+// Warnf logs at warn level
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LogLevelWarn, format, args...)
+}
+
+// Errorf logs at error level
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LogLevelError, format, args...)
+}
+
+// Fatalf logs at error level regardless of the verbosity & exits with non-zero status
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.out.Printf("%-5s %s%s", "FATAL", fmt.Sprintf(format, args...), l.fields)
+	os.Exit(1)
+}
+
+// Info implements authboss.Logger
+func (l *Logger) Info(message string) {
+	l.Infof("%s", message)
+}
+
+// Error implements authboss.Logger
+func (l *Logger) Error(message string) {
+	l.Errorf("%s", message)
+}
+
+// FromRequest implements authboss.RequestLogger, so that authboss logs have the user of the request
+func (l *Logger) FromRequest(r *http.Request) authboss.Logger {
+	return l.WithContext(r.Context())
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"net/smtp"
+	"os"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/volatiletech/authboss/v3"
+	"github.com/volatiletech/authboss/v3/defaults"
+)
+
+// mailTemplates holds the e-mail templates of authboss modules, keyed by the template name
+var mailTemplates = map[string]string{
+	"confirm_html": `<p>Welcome to Google Keep Clone!</p><p>Please <a href="{{.url}}">confirm your account</a> to start taking notes.</p>`,
+	"confirm_txt":  "Welcome to Google Keep Clone!\n\nPlease confirm your account by visiting the link below to start taking notes.\n\n{{.url}}\n",
+	"recover_html": `<p>A password reset was requested for your account.</p><p>Please <a href="{{.url}}">choose a new password</a>. If it wasn't you, just ignore this e-mail.</p>`,
+	"recover_txt":  "A password reset was requested for your account.\n\nPlease choose a new password by visiting the link below. If it wasn't you, just ignore this e-mail.\n\n{{.url}}\n",
+}
+
+// MailRenderer renders the e-mails sent by authboss, as the JSON renderer used for the views can't
+type MailRenderer struct {
+	htmlTemplates map[string]*htmltemplate.Template
+	textTemplates map[string]*texttemplate.Template
+}
+
+// Load parses the given e-mail templates
+func (m *MailRenderer) Load(names ...string) error {
+	for _, name := range names {
+		tmpl, ok := mailTemplates[name]
+		if !ok {
+			return fmt.Errorf("mail template %s doesn't exist", name)
+		}
+		var err error
+		if strings.HasSuffix(name, "_html") {
+			m.htmlTemplates[name], err = htmltemplate.New(name).Parse(tmpl)
+		} else {
+			m.textTemplates[name], err = texttemplate.New(name).Parse(tmpl)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render executes the e-mail template with the given data
+func (m *MailRenderer) Render(ctx context.Context, name string, data authboss.HTMLData) ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	if tmpl, ok := m.htmlTemplates[name]; ok {
+		err := tmpl.Execute(buf, data)
+		return buf.Bytes(), "text/html", err
+	}
+	if tmpl, ok := m.textTemplates[name]; ok {
+		err := tmpl.Execute(buf, data)
+		return buf.Bytes(), "text/plain", err
+	}
+	return nil, "", fmt.Errorf("mail template %s is not loaded", name)
+}
+
+////////////////////////////////////////////////////////////
+// Factory Methods
+
+func NewMailRenderer() *MailRenderer {
+	return &MailRenderer{
+		htmlTemplates: map[string]*htmltemplate.Template{},
+		textTemplates: map[string]*texttemplate.Template{},
+	}
+}
+
+// NewMailer creates a mailer sending via the SMTP server, or logging the e-mails to stdout when no server is given
+func NewMailer(smtpHost string, smtpPort string, smtpUsername string, smtpPassword string) authboss.Mailer {
+	if smtpHost == "" {
+		return defaults.NewLogMailer(os.Stdout)
+	}
+	var auth smtp.Auth
+	if smtpUsername != "" {
+		auth = smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
+	}
+	return defaults.NewSMTPMailer(fmt.Sprintf("%s:%s", smtpHost, smtpPort), auth)
+}
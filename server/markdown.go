@@ -0,0 +1,17 @@
+package server
+
+import (
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// markdownPolicy keeps the rendered HTML to the formatting. The scripts, the styles, the event handlers & the
+// links other than of 'http', 'https' & 'mailto' are stripped, so that no note carries script to its viewers
+var markdownPolicy = bluemonday.UGCPolicy()
+
+// renderMarkdown renders the markdown as HTML, the line breaks kept as they are in the notes
+func renderMarkdown(markdown string) string {
+	extensions := blackfriday.CommonExtensions | blackfriday.HardLineBreak
+	html := blackfriday.Run([]byte(markdown), blackfriday.WithExtensions(extensions))
+	return string(markdownPolicy.SanitizeBytes(html))
+}
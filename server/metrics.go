@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gkc_http_requests_total",
+		Help: "Number of the HTTP requests served, by route, method & status code",
+	}, []string{"route", "method", "code"})
+	metricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gkc_http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests, by route & method",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	metricResolverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gkc_graphql_resolver_duration_seconds",
+		Help:    "Duration of the GraphQL field resolvers, by object & field",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"object", "field"})
+	metricSubscriptions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gkc_graphql_active_subscriptions",
+		Help: "Number of the active GraphQL subscriptions, by subscription",
+	}, []string{"subscription"})
+	metricDBQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gkc_db_queries_total",
+		Help: "Number of the DB queries, by operation",
+	}, []string{"operation"})
+)
+
+// ObserveRequest records the served HTTP request
+func ObserveRequest(route string, method string, code int, duration time.Duration) {
+	metricRequests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	metricRequestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveResolver records the duration of the GraphQL field resolver
+func ObserveResolver(object string, field string, duration time.Duration) {
+	metricResolverDuration.WithLabelValues(object, field).Observe(duration.Seconds())
+}
+
+// RegisterDBMetrics counts the queries run through the DB
+func RegisterDBMetrics(db *gorm.DB) {
+	counter := func(operation string) func(*gorm.Scope) {
+		return func(*gorm.Scope) {
+			metricDBQueries.WithLabelValues(operation).Inc()
+		}
+	}
+	registerCallbacks(db, func(callback *gorm.Callback) {
+		callback.Create().Register("metrics:create", counter("create"))
+		callback.Query().Register("metrics:query", counter("query"))
+		callback.RowQuery().Register("metrics:row_query", counter("row_query"))
+		callback.Update().Register("metrics:update", counter("update"))
+		callback.Delete().Register("metrics:delete", counter("delete"))
+	})
+}
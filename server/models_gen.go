@@ -5,16 +5,46 @@ package server
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/volatiletech/authboss/v3"
 )
 
+type Attachment struct {
+	ID          string `json:"id" gorm:"primary_key"`
+	TodoID      string `sql:"type:VARCHAR(255) REFERENCES todos(id) ON DELETE CASCADE"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	Path        string // the key in the blob store, or the path of the file stored before the blob stores existed
+	CreatedAt   time.Time
+}
+
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+type AuthEvent struct {
+	ID        string        `json:"id"`
+	UserID    *string       `json:"userId" gorm:"index"` // null for the unknown emails of failed logins, kept after deleting the user
+	Email     string        `json:"email"`               // as entered
+	Type      AuthEventType `json:"type"`
+	IP        string        `json:"ip"`
+	UserAgent string        `json:"userAgent"`
+	CreatedAt time.Time     `json:"createdAt" gorm:"index"`
+}
+
 type Label struct {
-	ID     string  `json:"id"`
-	Name   string  `json:"name"`
-	Todos  []*Todo `gorm:"many2many:todos_labels"` // many-to-many
-	UserID string  `sql:"type:TEXT REFERENCES users(id) ON DELETE CASCADE"`
+	ID        string  `json:"id"`
+	Name      string  `json:"name" gorm:"unique_index:idx_labels_user_name"`
+	Color     string  `json:"color" gorm:"default:'default'"`
+	Todos     []*Todo `gorm:"many2many:todos_labels"` // many-to-many
+	UserID    string  `sql:"type:VARCHAR(255) REFERENCES users(id) ON DELETE CASCADE" gorm:"unique_index:idx_labels_user_name"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type LabelAction struct {
@@ -22,31 +52,226 @@ type LabelAction struct {
 	Label  *Label `json:"label"`
 }
 
+type LabelConnection struct {
+	Edges      []*LabelEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type LabelEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Label `json:"node"`
+}
+
+type LabelStats struct {
+	Label *Label `json:"label"`
+	Todos int    `json:"todos"`
+}
+
+type Limits struct {
+	MaxTitleLength int `json:"maxTitleLength"`
+	MaxNoteLength  int `json:"maxNoteLength"`
+	MaxNotes       int `json:"maxNotes"`
+	MaxLabels      int `json:"maxLabels"`
+}
+
 type Note struct {
-	ID          string `gorm:"primary_key"`
-	TodoID      string `sql:"type:TEXT REFERENCES todos(id) ON DELETE CASCADE"`
-	Text        string `json:"text"`
-	IsCompleted bool   `json:"isCompleted"`
+	ID          string  `gorm:"primary_key"`
+	TodoID      string  `sql:"type:VARCHAR(255) REFERENCES todos(id) ON DELETE CASCADE"`
+	Text        string  `json:"text"`
+	IsCompleted bool    `json:"isCompleted"`
+	Position    int     `json:"position" gorm:"default:0"`
+	ParentID    *string `json:"parentId"` // of the note above, which it's nested under
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TextHTML is the text of the note rendered from markdown as sanitized HTML. It isn't stored, the text stays the
+// source, and it's rendered only when asked for
+func (n *Note) TextHTML() string {
+	return renderMarkdown(n.Text)
 }
 
 type NotesInput struct {
 	Text        string `json:"text"`
 	IsCompleted bool   `json:"isCompleted"`
+	IsIndented  *bool  `json:"isIndented,omitempty"`
+}
+
+type PageInfo struct {
+	EndCursor   *string `json:"endCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+type PresenceEvent struct {
+	Action  PresenceAction `json:"action"`
+	Viewer  *Viewer        `json:"viewer"`
+	Viewers []*Viewer      `json:"viewers"`
+}
+
+type ReminderEvent struct {
+	TodoID   string    `json:"todoId"`
+	Title    string    `json:"title"`
+	RemindAt time.Time `json:"remindAt"`
+}
+
+type SearchHit struct {
+	Todo         *Todo   `json:"todo"`
+	TitleSnippet *string `json:"titleSnippet"`
+	NotesSnippet *string `json:"notesSnippet"`
+	Rank         float64 `json:"rank"`
+}
+
+type Stats struct {
+	Todos          int           `json:"todos"`
+	Archived       int           `json:"archived"`
+	WithReminder   int           `json:"withReminder"`
+	CompletedNotes int           `json:"completedNotes"`
+	PendingNotes   int           `json:"pendingNotes"`
+	Labels         []*LabelStats `json:"labels"`
 }
 
 type Todo struct {
-	ID             string   `json:"id"`
-	Title          string   `json:"title"`
-	Notes          []*Note  `json:"notes" gorm:"foreignkey:TodoID"`       // has-many
-	Labels         []*Label `json:"labels" gorm:"many2many:todos_labels"` // many-to-many
-	Color          string   `json:"color"`
-	IsCheckboxMode bool     `json:"isCheckboxMode"`
-	UserID         string   `sql:"type:TEXT REFERENCES users(id) ON DELETE CASCADE"`
+	ID             string        `json:"id"`
+	Title          string        `json:"title"`
+	Notes          []*Note       `json:"notes" gorm:"foreignkey:TodoID"`       // has-many
+	Labels         []*Label      `json:"labels" gorm:"many2many:todos_labels"` // many-to-many
+	Color          string        `json:"color"`
+	IsCheckboxMode bool          `json:"isCheckboxMode"`
+	IsPinned       bool          `json:"isPinned" gorm:"default:false"`
+	IsOngoing      bool          `json:"isOngoing" gorm:"default:false"`
+	IsArchived     bool          `json:"isArchived" gorm:"default:false"`
+	Attachments    []*Attachment `json:"attachments" gorm:"foreignkey:TodoID"` // has-many
+	RemindAt       *time.Time    `json:"remindAt" gorm:"index"`                // in UTC, so that it compares right as text in SQLite
+	Version        int           `json:"version" gorm:"default:0"`             // incremented on every update
+	OrderIndex     float64       `json:"orderIndex" gorm:"index"`              // fractional, so that a todo moves in between others alone
+	SourceDevice   string        `json:"sourceDevice" gorm:"default:'unknown'"`
+	Background     string        `json:"background" gorm:"default:'none'"`
+	RemindedAt     *time.Time    // when the reminder was delivered, so that it's delivered once
+	IsLocked       bool          `json:"isLocked" gorm:"default:false"`
+	LockedContent  *string       `gorm:"type:text"` // the notes sealed with the passphrase, while locked
+	UndoToken      *string       `json:"undoToken" gorm:"-"`
+	UserID         string        `sql:"type:VARCHAR(255) REFERENCES users(id) ON DELETE CASCADE"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      *time.Time `sql:"index"` // soft-delete, todo is in trash when set
+}
+
+// BeforeUpdate increments the version of the todo, so that the stale updates can be detected
+func (t *Todo) BeforeUpdate() error {
+	t.Version++
+	return nil
+}
+
+// Progress is the ratio of the completed notes of the todo
+func (t *Todo) Progress() float64 {
+	if len(t.Notes) == 0 {
+		return 0
+	}
+	completed := 0
+	for _, note := range t.Notes {
+		if note.IsCompleted {
+			completed++
+		}
+	}
+	return float64(completed) / float64(len(t.Notes))
+}
+
+// IsReminderDue tells whether the reminder of the todo has fallen due, whether it's delivered or not
+func (t *Todo) IsReminderDue() bool {
+	return t.RemindAt != nil && !t.RemindAt.After(time.Now())
+}
+
+// Kind tells whether the notes of the todo are the items of a checklist, or the lines of a text
+func (t *Todo) Kind() TodoKind {
+	if t.IsCheckboxMode {
+		return TodoKindList
+	}
+	return TodoKindText
 }
 
 type TodoAction struct {
-	Action Action `json:"action"`
-	Todo   *Todo  `json:"todo"`
+	Action   Action `json:"action"`
+	Todo     *Todo  `json:"todo"`
+	Sequence *int   `json:"sequence"` // of the events of the user, none for the reminders
+}
+
+type TodoConnection struct {
+	Edges    []*TodoEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type TodoEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Todo  `json:"node"`
+}
+
+type TodoFilter struct {
+	Archived      *bool         `json:"archived"`
+	CompletedLast *bool         `json:"completedLast"`
+	LabelIds      []string      `json:"labelIds"`
+	AnyLabelIds   []string      `json:"anyLabelIds"`
+	SourceDevice  *SourceDevice `json:"sourceDevice"`
+	Search        *string       `json:"search"`
+	Colors        []TodoColor   `json:"colors"`
+	HasReminder   *bool         `json:"hasReminder"`
+}
+
+type TodoInput struct {
+	Title          string        `json:"title"`
+	Notes          []*NotesInput `json:"notes"`
+	Labels         []string      `json:"labels"`
+	Color          *TodoColor    `json:"color"`
+	IsCheckboxMode *bool         `json:"isCheckboxMode"`
+	SourceDevice   *SourceDevice `json:"sourceDevice"`
+	IdempotencyKey *string       `json:"idempotencyKey"`
+}
+
+type TodoPatch struct {
+	Title           *string       `json:"title"`
+	Notes           []*NotesInput `json:"notes"`
+	Color           *TodoColor    `json:"color"`
+	Pinned          *bool         `json:"pinned"`
+	Archived        *bool         `json:"archived"`
+	ExpectedVersion *int          `json:"expectedVersion"`
+}
+
+type TodoRevision struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	TodoID    string    `sql:"type:VARCHAR(255) REFERENCES todos(id) ON DELETE CASCADE" gorm:"index"`
+	Title     string    `json:"title"`
+	Content   string    // notes of the todo as JSON
+	EditorID  string    // user, whose edit replaced the revision
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Notes are the notes of the todo at the revision
+func (r *TodoRevision) Notes() []*Note {
+	return unmarshalNotes(r.Content, r.ID, r.TodoID)
+}
+
+// Editor is the email of the user, whose edit replaced the revision
+func (r *TodoRevision) Editor() string {
+	editor, _ := url.QueryUnescape(r.EditorID) // The PID (email) is stored encoded as userID
+	return editor
+}
+
+type TodoTemplate struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Title          string    `json:"title"`
+	Content        string    `gorm:"type:text"`                                     // notes of the template as JSON, like those of the revisions
+	Labels         []*Label  `json:"labels" gorm:"many2many:todo_templates_labels"` // many-to-many
+	Color          string    `json:"color"`
+	IsCheckboxMode bool      `json:"isCheckboxMode"`
+	UserID         string    `sql:"type:VARCHAR(255) REFERENCES users(id) ON DELETE CASCADE" gorm:"index"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Notes are the notes, which the todos created from the template start with
+func (t *TodoTemplate) Notes() []*Note {
+	return unmarshalNotes(t.Content, t.ID, "")
 }
 
 type User struct {
@@ -57,12 +282,71 @@ type User struct {
 	Password string   `json:"password"`
 	ListMode bool     `json:"listMode"`
 	DarkMode bool     `json:"darkMode"`
+	IsAdmin  bool     `json:"isAdmin" gorm:"default:false"`
 	Todos    []*Todo  `gorm:"foreignkey:UserID"` // has-many
 	Labels   []*Label `gorm:"foreignkey:UserID"` // has-many
+
+	Confirmed       bool
+	ConfirmSelector string `gorm:"index"`
+	ConfirmVerifier string
+
+	RecoverSelector string `gorm:"index"`
+	RecoverVerifier string
+	RecoverExpiry   time.Time
+
+	OAuth2UID          string    `gorm:"column:oauth2_uid;index:idx_users_oauth2"`
+	OAuth2Provider     string    `gorm:"column:oauth2_provider;index:idx_users_oauth2"`
+	OAuth2AccessToken  string    `gorm:"column:oauth2_access_token"`
+	OAuth2RefreshToken string    `gorm:"column:oauth2_refresh_token"`
+	OAuth2Expiry       time.Time `gorm:"column:oauth2_expiry"`
+
+	AttemptCount int
+	LastAttempt  time.Time
+	Locked       time.Time // locked until
+
+	SessionEpoch int // incremented to log out all the sessions
+
+	CanonicalPID *string `gorm:"column:canonical_pid;unique_index"` // null for those registered before, whose PIDs differ only in the casing
+}
+
+type Usage struct {
+	Todos           int `json:"todos"`
+	AttachmentBytes int `json:"attachmentBytes"`
+}
+
+type Viewer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	EventMask int       // the bit of each event's index in AllWebhookEvent, so the events are only ever appended
+	Secret    string    `json:"secret"`
+	UserID    string    `gorm:"index" sql:"type:VARCHAR(255) REFERENCES users(id) ON DELETE CASCADE"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Events are the events of the todos, which the webhook is told of
+func (w *Webhook) Events() []WebhookEvent {
+	events := []WebhookEvent{}
+	for index, event := range AllWebhookEvent {
+		if w.EventMask&(1<<index) != 0 {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// IsLocked tells whether the user is locked out, by the failed logins or by an admin
+func (u *User) IsLocked() bool {
+	return u.Locked.After(time.Now())
 }
 
 func (u *User) GetPID() string {
-	return u.ID
+	pid, _ := url.QueryUnescape(u.ID) // The PID (email) is stored encoded as userID
+	return pid
 }
 
 func (u *User) PutPID(pid string) {
@@ -93,6 +377,130 @@ func (u *User) PutArbitrary(values map[string]string) {
 	}
 }
 
+func (u *User) GetEmail() string {
+	return u.Email
+}
+
+func (u *User) PutEmail(email string) {
+	u.Email = email
+}
+
+func (u *User) GetConfirmed() bool {
+	return u.Confirmed
+}
+
+func (u *User) GetConfirmSelector() string {
+	return u.ConfirmSelector
+}
+
+func (u *User) GetConfirmVerifier() string {
+	return u.ConfirmVerifier
+}
+
+func (u *User) PutConfirmed(confirmed bool) {
+	u.Confirmed = confirmed
+}
+
+func (u *User) PutConfirmSelector(selector string) {
+	u.ConfirmSelector = selector
+}
+
+func (u *User) PutConfirmVerifier(verifier string) {
+	u.ConfirmVerifier = verifier
+}
+
+func (u *User) GetRecoverSelector() string {
+	return u.RecoverSelector
+}
+
+func (u *User) GetRecoverVerifier() string {
+	return u.RecoverVerifier
+}
+
+func (u *User) GetRecoverExpiry() time.Time {
+	return u.RecoverExpiry
+}
+
+func (u *User) PutRecoverSelector(selector string) {
+	u.RecoverSelector = selector
+}
+
+func (u *User) PutRecoverVerifier(verifier string) {
+	u.RecoverVerifier = verifier
+}
+
+func (u *User) PutRecoverExpiry(expiry time.Time) {
+	u.RecoverExpiry = expiry
+}
+
+func (u *User) IsOAuth2User() bool {
+	return u.OAuth2UID != ""
+}
+
+func (u *User) GetOAuth2UID() string {
+	return u.OAuth2UID
+}
+
+func (u *User) GetOAuth2Provider() string {
+	return u.OAuth2Provider
+}
+
+func (u *User) GetOAuth2AccessToken() string {
+	return u.OAuth2AccessToken
+}
+
+func (u *User) GetOAuth2RefreshToken() string {
+	return u.OAuth2RefreshToken
+}
+
+func (u *User) GetOAuth2Expiry() time.Time {
+	return u.OAuth2Expiry
+}
+
+func (u *User) PutOAuth2UID(uid string) {
+	u.OAuth2UID = uid
+}
+
+func (u *User) PutOAuth2Provider(provider string) {
+	u.OAuth2Provider = provider
+}
+
+func (u *User) PutOAuth2AccessToken(token string) {
+	u.OAuth2AccessToken = token
+}
+
+func (u *User) PutOAuth2RefreshToken(refreshToken string) {
+	u.OAuth2RefreshToken = refreshToken
+}
+
+func (u *User) PutOAuth2Expiry(expiry time.Time) {
+	u.OAuth2Expiry = expiry
+}
+
+func (u *User) GetAttemptCount() int {
+	return u.AttemptCount
+}
+
+func (u *User) GetLastAttempt() time.Time {
+	return u.LastAttempt
+}
+
+func (u *User) GetLocked() time.Time {
+	return u.Locked
+}
+
+func (u *User) PutAttemptCount(attempts int) {
+	u.AttemptCount = attempts
+}
+
+func (u *User) PutLastAttempt(last time.Time) {
+	u.LastAttempt = last
+}
+
+func (u *User) PutLocked(locked time.Time) {
+	u.Locked = locked
+}
+
 func (u *User) Validate() []error {
 	return nil
 }
@@ -103,17 +511,19 @@ const (
 	ActionCreated Action = "CREATED"
 	ActionDeleted Action = "DELETED"
 	ActionUpdated Action = "UPDATED"
+	ActionResync  Action = "RESYNC"
 )
 
 var AllAction = []Action{
 	ActionCreated,
 	ActionDeleted,
 	ActionUpdated,
+	ActionResync,
 }
 
 func (e Action) IsValid() bool {
 	switch e {
-	case ActionCreated, ActionDeleted, ActionUpdated:
+	case ActionCreated, ActionDeleted, ActionUpdated, ActionResync:
 		return true
 	}
 	return false
@@ -139,3 +549,581 @@ func (e *Action) UnmarshalGQL(v interface{}) error {
 func (e Action) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type AuthEventType string
+
+const (
+	AuthEventTypeLogin           AuthEventType = "LOGIN"
+	AuthEventTypeLoginFailed     AuthEventType = "LOGIN_FAILED"
+	AuthEventTypeLogout          AuthEventType = "LOGOUT"
+	AuthEventTypeLogoutAll       AuthEventType = "LOGOUT_ALL"
+	AuthEventTypePasswordChanged AuthEventType = "PASSWORD_CHANGED"
+)
+
+var AllAuthEventType = []AuthEventType{
+	AuthEventTypeLogin,
+	AuthEventTypeLoginFailed,
+	AuthEventTypeLogout,
+	AuthEventTypeLogoutAll,
+	AuthEventTypePasswordChanged,
+}
+
+func (e AuthEventType) IsValid() bool {
+	switch e {
+	case AuthEventTypeLogin, AuthEventTypeLoginFailed, AuthEventTypeLogout, AuthEventTypeLogoutAll, AuthEventTypePasswordChanged:
+		return true
+	}
+	return false
+}
+
+func (e AuthEventType) String() string {
+	return string(e)
+}
+
+func (e *AuthEventType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AuthEventType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AuthEventType", str)
+	}
+	return nil
+}
+
+func (e AuthEventType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ExportFormat string
+
+const (
+	ExportFormatMarkdown ExportFormat = "MARKDOWN"
+	ExportFormatText     ExportFormat = "TEXT"
+)
+
+var AllExportFormat = []ExportFormat{
+	ExportFormatMarkdown,
+	ExportFormatText,
+}
+
+func (e ExportFormat) IsValid() bool {
+	switch e {
+	case ExportFormatMarkdown, ExportFormatText:
+		return true
+	}
+	return false
+}
+
+func (e ExportFormat) String() string {
+	return string(e)
+}
+
+func (e *ExportFormat) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ExportFormat(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ExportFormat", str)
+	}
+	return nil
+}
+
+func (e ExportFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LabelColor string
+
+const (
+	LabelColorDefault   LabelColor = "DEFAULT"
+	LabelColorRed       LabelColor = "RED"
+	LabelColorOrange    LabelColor = "ORANGE"
+	LabelColorYellow    LabelColor = "YELLOW"
+	LabelColorGreen     LabelColor = "GREEN"
+	LabelColorCyan      LabelColor = "CYAN"
+	LabelColorLightblue LabelColor = "LIGHTBLUE"
+	LabelColorDarkblue  LabelColor = "DARKBLUE"
+	LabelColorPurple    LabelColor = "PURPLE"
+	LabelColorPink      LabelColor = "PINK"
+	LabelColorBrown     LabelColor = "BROWN"
+	LabelColorGrey      LabelColor = "GREY"
+)
+
+var AllLabelColor = []LabelColor{
+	LabelColorDefault,
+	LabelColorRed,
+	LabelColorOrange,
+	LabelColorYellow,
+	LabelColorGreen,
+	LabelColorCyan,
+	LabelColorLightblue,
+	LabelColorDarkblue,
+	LabelColorPurple,
+	LabelColorPink,
+	LabelColorBrown,
+	LabelColorGrey,
+}
+
+func (e LabelColor) IsValid() bool {
+	switch e {
+	case LabelColorDefault, LabelColorRed, LabelColorOrange, LabelColorYellow, LabelColorGreen, LabelColorCyan, LabelColorLightblue, LabelColorDarkblue, LabelColorPurple, LabelColorPink, LabelColorBrown, LabelColorGrey:
+		return true
+	}
+	return false
+}
+
+func (e LabelColor) String() string {
+	return string(e)
+}
+
+func (e *LabelColor) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LabelColor(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LabelColor", str)
+	}
+	return nil
+}
+
+func (e LabelColor) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OwnedResource string
+
+const (
+	OwnedResourceTodo     OwnedResource = "TODO"
+	OwnedResourceNote     OwnedResource = "NOTE"
+	OwnedResourceLabel    OwnedResource = "LABEL"
+	OwnedResourceRevision OwnedResource = "REVISION"
+	OwnedResourceTemplate OwnedResource = "TEMPLATE"
+	OwnedResourceWebhook  OwnedResource = "WEBHOOK"
+)
+
+var AllOwnedResource = []OwnedResource{
+	OwnedResourceTodo,
+	OwnedResourceNote,
+	OwnedResourceLabel,
+	OwnedResourceRevision,
+	OwnedResourceTemplate,
+	OwnedResourceWebhook,
+}
+
+func (e OwnedResource) IsValid() bool {
+	switch e {
+	case OwnedResourceTodo, OwnedResourceNote, OwnedResourceLabel, OwnedResourceRevision, OwnedResourceTemplate, OwnedResourceWebhook:
+		return true
+	}
+	return false
+}
+
+func (e OwnedResource) String() string {
+	return string(e)
+}
+
+func (e *OwnedResource) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OwnedResource(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OwnedResource", str)
+	}
+	return nil
+}
+
+func (e OwnedResource) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Permission string
+
+const (
+	PermissionRead  Permission = "READ"
+	PermissionWrite Permission = "WRITE"
+)
+
+var AllPermission = []Permission{
+	PermissionRead,
+	PermissionWrite,
+}
+
+func (e Permission) IsValid() bool {
+	switch e {
+	case PermissionRead, PermissionWrite:
+		return true
+	}
+	return false
+}
+
+func (e Permission) String() string {
+	return string(e)
+}
+
+func (e *Permission) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Permission(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Permission", str)
+	}
+	return nil
+}
+
+func (e Permission) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PresenceAction string
+
+const (
+	PresenceActionJoined PresenceAction = "JOINED"
+	PresenceActionLeft   PresenceAction = "LEFT"
+)
+
+var AllPresenceAction = []PresenceAction{
+	PresenceActionJoined,
+	PresenceActionLeft,
+}
+
+func (e PresenceAction) IsValid() bool {
+	switch e {
+	case PresenceActionJoined, PresenceActionLeft:
+		return true
+	}
+	return false
+}
+
+func (e PresenceAction) String() string {
+	return string(e)
+}
+
+func (e *PresenceAction) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PresenceAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PresenceAction", str)
+	}
+	return nil
+}
+
+func (e PresenceAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SourceDevice string
+
+const (
+	SourceDeviceUnknown SourceDevice = "UNKNOWN"
+	SourceDeviceWeb     SourceDevice = "WEB"
+	SourceDeviceMobile  SourceDevice = "MOBILE"
+	SourceDeviceTablet  SourceDevice = "TABLET"
+	SourceDeviceDesktop SourceDevice = "DESKTOP"
+)
+
+var AllSourceDevice = []SourceDevice{
+	SourceDeviceUnknown,
+	SourceDeviceWeb,
+	SourceDeviceMobile,
+	SourceDeviceTablet,
+	SourceDeviceDesktop,
+}
+
+func (e SourceDevice) IsValid() bool {
+	switch e {
+	case SourceDeviceUnknown, SourceDeviceWeb, SourceDeviceMobile, SourceDeviceTablet, SourceDeviceDesktop:
+		return true
+	}
+	return false
+}
+
+func (e SourceDevice) String() string {
+	return string(e)
+}
+
+func (e *SourceDevice) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SourceDevice(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SourceDevice", str)
+	}
+	return nil
+}
+
+func (e SourceDevice) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TodoBackground string
+
+const (
+	TodoBackgroundNone        TodoBackground = "NONE"
+	TodoBackgroundGroceries   TodoBackground = "GROCERIES"
+	TodoBackgroundFood        TodoBackground = "FOOD"
+	TodoBackgroundMusic       TodoBackground = "MUSIC"
+	TodoBackgroundRecipes     TodoBackground = "RECIPES"
+	TodoBackgroundNotes       TodoBackground = "NOTES"
+	TodoBackgroundPlaces      TodoBackground = "PLACES"
+	TodoBackgroundTravel      TodoBackground = "TRAVEL"
+	TodoBackgroundVideo       TodoBackground = "VIDEO"
+	TodoBackgroundCelebration TodoBackground = "CELEBRATION"
+)
+
+var AllTodoBackground = []TodoBackground{
+	TodoBackgroundNone,
+	TodoBackgroundGroceries,
+	TodoBackgroundFood,
+	TodoBackgroundMusic,
+	TodoBackgroundRecipes,
+	TodoBackgroundNotes,
+	TodoBackgroundPlaces,
+	TodoBackgroundTravel,
+	TodoBackgroundVideo,
+	TodoBackgroundCelebration,
+}
+
+func (e TodoBackground) IsValid() bool {
+	switch e {
+	case TodoBackgroundNone, TodoBackgroundGroceries, TodoBackgroundFood, TodoBackgroundMusic, TodoBackgroundRecipes, TodoBackgroundNotes, TodoBackgroundPlaces, TodoBackgroundTravel, TodoBackgroundVideo, TodoBackgroundCelebration:
+		return true
+	}
+	return false
+}
+
+func (e TodoBackground) String() string {
+	return string(e)
+}
+
+func (e *TodoBackground) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TodoBackground(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TodoBackground", str)
+	}
+	return nil
+}
+
+func (e TodoBackground) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TodoColor string
+
+const (
+	TodoColorDefault   TodoColor = "DEFAULT"
+	TodoColorRed       TodoColor = "RED"
+	TodoColorOrange    TodoColor = "ORANGE"
+	TodoColorYellow    TodoColor = "YELLOW"
+	TodoColorGreen     TodoColor = "GREEN"
+	TodoColorCyan      TodoColor = "CYAN"
+	TodoColorLightblue TodoColor = "LIGHTBLUE"
+	TodoColorDarkblue  TodoColor = "DARKBLUE"
+	TodoColorPurple    TodoColor = "PURPLE"
+	TodoColorPink      TodoColor = "PINK"
+	TodoColorBrown     TodoColor = "BROWN"
+	TodoColorGrey      TodoColor = "GREY"
+)
+
+var AllTodoColor = []TodoColor{
+	TodoColorDefault,
+	TodoColorRed,
+	TodoColorOrange,
+	TodoColorYellow,
+	TodoColorGreen,
+	TodoColorCyan,
+	TodoColorLightblue,
+	TodoColorDarkblue,
+	TodoColorPurple,
+	TodoColorPink,
+	TodoColorBrown,
+	TodoColorGrey,
+}
+
+func (e TodoColor) IsValid() bool {
+	switch e {
+	case TodoColorDefault, TodoColorRed, TodoColorOrange, TodoColorYellow, TodoColorGreen, TodoColorCyan, TodoColorLightblue, TodoColorDarkblue, TodoColorPurple, TodoColorPink, TodoColorBrown, TodoColorGrey:
+		return true
+	}
+	return false
+}
+
+func (e TodoColor) String() string {
+	return string(e)
+}
+
+func (e *TodoColor) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TodoColor(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TodoColor", str)
+	}
+	return nil
+}
+
+func (e TodoColor) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TodoKind string
+
+const (
+	TodoKindText TodoKind = "TEXT"
+	TodoKindList TodoKind = "LIST"
+)
+
+var AllTodoKind = []TodoKind{
+	TodoKindText,
+	TodoKindList,
+}
+
+func (e TodoKind) IsValid() bool {
+	switch e {
+	case TodoKindText, TodoKindList:
+		return true
+	}
+	return false
+}
+
+func (e TodoKind) String() string {
+	return string(e)
+}
+
+func (e *TodoKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TodoKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TodoKind", str)
+	}
+	return nil
+}
+
+func (e TodoKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TodoOrder string
+
+const (
+	TodoOrderCreatedAsc  TodoOrder = "CREATED_ASC"
+	TodoOrderCreatedDesc TodoOrder = "CREATED_DESC"
+	TodoOrderUpdatedDesc TodoOrder = "UPDATED_DESC"
+	TodoOrderTitleAsc    TodoOrder = "TITLE_ASC"
+	TodoOrderReminderAsc TodoOrder = "REMINDER_ASC"
+)
+
+var AllTodoOrder = []TodoOrder{
+	TodoOrderCreatedAsc,
+	TodoOrderCreatedDesc,
+	TodoOrderUpdatedDesc,
+	TodoOrderTitleAsc,
+	TodoOrderReminderAsc,
+}
+
+func (e TodoOrder) IsValid() bool {
+	switch e {
+	case TodoOrderCreatedAsc, TodoOrderCreatedDesc, TodoOrderUpdatedDesc, TodoOrderTitleAsc, TodoOrderReminderAsc:
+		return true
+	}
+	return false
+}
+
+func (e TodoOrder) String() string {
+	return string(e)
+}
+
+func (e *TodoOrder) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TodoOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TodoOrder", str)
+	}
+	return nil
+}
+
+func (e TodoOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type WebhookEvent string
+
+const (
+	WebhookEventCreated     WebhookEvent = "CREATED"
+	WebhookEventUpdated     WebhookEvent = "UPDATED"
+	WebhookEventDeleted     WebhookEvent = "DELETED"
+	WebhookEventReminderDue WebhookEvent = "REMINDER_DUE"
+)
+
+var AllWebhookEvent = []WebhookEvent{
+	WebhookEventCreated,
+	WebhookEventUpdated,
+	WebhookEventDeleted,
+	WebhookEventReminderDue,
+}
+
+func (e WebhookEvent) IsValid() bool {
+	switch e {
+	case WebhookEventCreated, WebhookEventUpdated, WebhookEventDeleted, WebhookEventReminderDue:
+		return true
+	}
+	return false
+}
+
+func (e WebhookEvent) String() string {
+	return string(e)
+}
+
+func (e *WebhookEvent) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WebhookEvent(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WebhookEvent", str)
+	}
+	return nil
+}
+
+func (e WebhookEvent) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// nestNotes nests each indented note under the closest note above, which isn't indented, and numbers the notes
+// in their order. So the notes nest a level deep at most, never in a cycle, and the subitems follow their parent
+func nestNotes(notes []*Note, indented func(index int) bool) {
+	var parent *Note
+	for index, note := range notes {
+		note.Position = index
+		if indented(index) && parent != nil {
+			note.ParentID = &parent.ID
+		} else {
+			note.ParentID = nil // The first note has nothing to nest under
+			parent = note
+		}
+	}
+}
+
+// isNested tells the notes, which are nested already
+func isNested(notes []*Note) func(index int) bool {
+	return func(index int) bool {
+		return notes[index].ParentID != nil
+	}
+}
+
+// isIndented tells the notes, which are indented in the input
+func isIndented(inputs []*NotesInput) func(index int) bool {
+	return func(index int) bool {
+		return inputs[index].IsIndented != nil && *inputs[index].IsIndented
+	}
+}
+
+// moveNote moves the note to the position among the others, along with its subitems. A parent lands below the
+// subitems of the note above it, so that it doesn't take them over, while a subitem joins the parent above it
+func moveNote(notes []*Note, id string, position int) []*Note {
+	moving, others := []*Note{}, []*Note{}
+	for _, note := range notes {
+		if note.ID == id || (note.ParentID != nil && *note.ParentID == id) {
+			moving = append(moving, note)
+		} else {
+			others = append(others, note)
+		}
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position > len(others) {
+		position = len(others)
+	}
+	if moving[0].ParentID == nil {
+		for position < len(others) && others[position].ParentID != nil {
+			position++
+		}
+	}
+	moved := append(append(append([]*Note{}, others[:position]...), moving...), others[position:]...)
+	nestNotes(moved, isNested(moved))
+	return moved
+}
+
+// indentNote nests the note under the closest parent above, along with its subitems, as the notes nest a level
+// deep only. The first note stays as it is
+func indentNote(notes []*Note, id string) []*Note {
+	nestNotes(notes, func(index int) bool {
+		return notes[index].ID == id || notes[index].ParentID != nil
+	})
+	return notes
+}
+
+// outdentNote takes the subitem out of its parent, moving it below the rest of the subitems, which stay with the
+// parent
+func outdentNote(notes []*Note, id string) []*Note {
+	outdented, others := (*Note)(nil), []*Note{}
+	for _, note := range notes {
+		if note.ID == id {
+			outdented = note
+		} else {
+			others = append(others, note)
+		}
+	}
+	if outdented.ParentID == nil {
+		return notes
+	}
+	position := 0
+	for index, note := range others {
+		if note.ID == *outdented.ParentID || (note.ParentID != nil && *note.ParentID == *outdented.ParentID) {
+			position = index + 1
+		}
+	}
+	outdented.ParentID = nil
+	moved := append(append(append([]*Note{}, others[:position]...), outdented), others[position:]...)
+	nestNotes(moved, isNested(moved))
+	return moved
+}
+
+// rearrangeNotes rearranges the notes of the note's todo with the function, in a transaction, so that the concurrent
+// rearrangements don't interleave
+func rearrangeNotes(db *gorm.DB, userID string, id string, rearrange func(notes []*Note, id string) []*Note) (*Todo, error) {
+	todo := Todo{
+		Labels: []*Label{},
+		Notes:  []*Note{},
+	}
+	err := transaction(db, func(tx *gorm.DB) error {
+		note := Note{ID: id}
+		if err := tx.First(&note).Error; err != nil {
+			return notFound(err)
+		}
+		if err := visibleTodos(tx, userID).Where("id = ?", note.TodoID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return notFound(err)
+		}
+		todo.Notes = rearrange(todo.Notes, id)
+		return tx.Save(&todo).Error // Saves the notes too, and fires the update callback for the subscribers
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
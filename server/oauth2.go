@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	aboauth2 "github.com/volatiletech/authboss/v3/oauth2"
+	"golang.org/x/oauth2"
+)
+
+// OAuth2EmailVerified is the key of the details of the OAuth2 user, telling whether the provider has verified the
+// email, as 'true' or 'false'
+const OAuth2EmailVerified string = "email_verified"
+
+// googleUserInfoEndpoint gives the ID, email & name of the Google user, along with whether the email is verified
+var googleUserInfoEndpoint = "https://www.googleapis.com/oauth2/v2/userinfo"
+
+// GoogleUserDetails finds the details of the Google user, like those of authboss, along with the name &
+// whether the email is verified, which are dropped there
+func GoogleUserDetails(ctx context.Context, cfg oauth2.Config, token *oauth2.Token) (map[string]string, error) {
+	resp, err := cfg.Client(ctx, token).Get(googleUserInfoEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google oauth2 endpoint responded with status %d", resp.StatusCode)
+	}
+	info := struct {
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		aboauth2.OAuth2UID:   info.ID,
+		aboauth2.OAuth2Email: info.Email,
+		aboauth2.OAuth2Name:  info.Name,
+		OAuth2EmailVerified:  strconv.FormatBool(info.VerifiedEmail),
+	}, nil
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	aboauth2 "github.com/volatiletech/authboss/v3/oauth2"
+	"golang.org/x/oauth2"
+)
+
+func TestGoogleUserDetails(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		wantVerified string
+	}{
+		{"verified", `{"id":"123","email":"user@example.com","verified_email":true,"name":"User"}`, "true"},
+		{"unverified", `{"id":"123","email":"user@example.com","verified_email":false,"name":"User"}`, "false"},
+		{"missing", `{"id":"123","email":"user@example.com","name":"User"}`, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" {
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+			endpoint := googleUserInfoEndpoint
+			googleUserInfoEndpoint = server.URL
+			defer func() { googleUserInfoEndpoint = endpoint }()
+
+			details, err := GoogleUserDetails(context.Background(), oauth2.Config{}, &oauth2.Token{AccessToken: "token", TokenType: "Bearer"})
+			if err != nil {
+				t.Fatalf("Error while finding the details -> %s", err)
+			}
+			want := map[string]string{aboauth2.OAuth2UID: "123", aboauth2.OAuth2Email: "user@example.com", aboauth2.OAuth2Name: "User", OAuth2EmailVerified: test.wantVerified}
+			for key, value := range want {
+				if details[key] != value {
+					t.Errorf("got %s %q, want %q", key, details[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFromOAuth2(t *testing.T) {
+	db := newTestDB(t)
+	existing := newTestUser(t, db, "existing@example.com")
+	linked := newTestUser(t, db, "linked@example.com")
+	if err := db.Model(linked).Updates(map[string]interface{}{"oauth2_provider": "google", "oauth2_uid": "linked"}).Error; err != nil {
+		t.Fatalf("Error while linking the user -> %s", err)
+	}
+	storer := NewDBStorer(db, nil)
+	tests := []struct {
+		name     string
+		uid      string
+		email    string
+		verified string
+		wantID   string // empty for an error
+	}{
+		{"existing verified", "1", "Existing@example.com", "true", existing.ID},
+		{"existing unverified", "2", "existing@example.com", "false", ""},
+		{"existing verification unknown", "3", "existing@example.com", "", ""},
+		{"new verified", "4", "new@example.com", "true", "new%40example.com"},
+		{"new unverified", "5", "other@example.com", "false", ""},
+		{"linked unverified", "linked", "changed@example.com", "false", linked.ID},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			details := map[string]string{aboauth2.OAuth2UID: test.uid, aboauth2.OAuth2Email: test.email, aboauth2.OAuth2Name: "User"}
+			if test.verified != "" {
+				details[OAuth2EmailVerified] = test.verified
+			}
+			user, err := storer.NewFromOAuth2(context.Background(), "google", details)
+			if test.wantID == "" {
+				if err == nil {
+					t.Errorf("got user %s, want an error", user.GetPID())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error while finding the user -> %s", err)
+			}
+			if got := user.(*User); got.ID != test.wantID || !got.Confirmed {
+				t.Errorf("got user %s, confirmed %v, want %s confirmed", got.ID, got.Confirmed, test.wantID)
+			}
+		})
+	}
+}
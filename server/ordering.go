@@ -0,0 +1,81 @@
+package server
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// orderIndexSpacing is the gap between the order indexes of the todos renumbered, for those moved to fit in between
+const orderIndexSpacing float64 = 1024
+
+// BeforeCreate puts the new todo after the existing ones, in the order of creation. The order index is the
+// creation time in seconds, so that the todos created before the order existed keep their order too. The indexes
+// are kept above 0, so 0 is of the new todos given none
+func (t *Todo) BeforeCreate() error {
+	if t.OrderIndex == 0 {
+		createdAt := t.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		t.OrderIndex = creationOrderIndex(createdAt)
+	}
+	return nil
+}
+
+func creationOrderIndex(createdAt time.Time) float64 {
+	return float64(createdAt.UnixNano()) / float64(time.Second)
+}
+
+// placeTodo moves the todo in between the neighbours. The pinned & the unpinned todos are ordered on their own,
+// so the section of the neighbours pins or unpins the todo. Dropped at the boundary of the sections, in between
+// the last pinned & the first unpinned, the todo stays in its section, at the end or the start of it
+func placeTodo(todo *Todo, before *Todo, after *Todo) (float64, bool) {
+	if before != nil && after != nil && before.IsPinned != after.IsPinned {
+		if todo.IsPinned {
+			after = nil
+		} else {
+			before = nil
+		}
+	}
+	if before != nil {
+		todo.IsPinned = before.IsPinned
+	} else if after != nil {
+		todo.IsPinned = after.IsPinned
+	}
+	return orderIndexBetween(before, after)
+}
+
+// orderIndexBetween is the order index halfway between those of the neighbours, either of which may be missing
+// at the ends of the list. It's false, once the indexes are too close to fit another one in between or above 0
+func orderIndexBetween(before *Todo, after *Todo) (float64, bool) {
+	switch {
+	case before == nil && after == nil:
+		return 0, false
+	case before == nil:
+		index := after.OrderIndex - 1
+		if index <= 0 {
+			index = after.OrderIndex / 2
+		}
+		return index, index > 0 && index < after.OrderIndex
+	case after == nil:
+		index := before.OrderIndex + 1
+		return index, index > 0
+	}
+	index := before.OrderIndex + (after.OrderIndex-before.OrderIndex)/2
+	return index, index > 0 && index > before.OrderIndex && index < after.OrderIndex
+}
+
+// renumberTodos spreads the order indexes of the todos of the user evenly above 0, keeping their order
+func renumberTodos(tx *gorm.DB, userID string) error {
+	todoIDs := []string{}
+	if err := tx.Unscoped().Model(&Todo{}).Where("user_id = ?", userID).Order("order_index").Order("id").Pluck("id", &todoIDs).Error; err != nil {
+		return err
+	}
+	for index, todoID := range todoIDs {
+		if err := tx.Unscoped().Model(&Todo{}).Where("id = ?", todoID).UpdateColumn("order_index", float64(index+1)*orderIndexSpacing).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
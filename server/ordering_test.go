@@ -0,0 +1,112 @@
+package server
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOrderIndexBetween(t *testing.T) {
+	at := func(index float64) *Todo { return &Todo{OrderIndex: index} }
+	tests := []struct {
+		name          string
+		before, after *Todo
+		want          float64
+		wantOK        bool
+	}{
+		{"none", nil, nil, 0, false},
+		{"at the start", nil, at(1024), 1023, true},
+		{"at the start of 1", nil, at(1), 0.5, true},
+		{"at the start of 0", nil, at(0), 0, false},
+		{"at the start of negative", nil, at(-3), -1.5, false},
+		{"at the end", at(1024), nil, 1025, true},
+		{"at the end of negative", at(-1), nil, 0, false},
+		{"in between", at(1024), at(2048), 1536, true},
+		{"in between across 0", at(-1), at(1), 0, false},
+		{"too close", at(1), at(1), 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := orderIndexBetween(test.before, test.after)
+			if ok != test.wantOK || (ok && got != test.want) {
+				t.Errorf("orderIndexBetween() = %v, %t, want %v, %t", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestReorderTodoToTheStartAfterRenumbering(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "order@example.com")
+	todos := []*Todo{}
+	for _, title := range []string{"First", "Second", "Third"} {
+		todos = append(todos, newTestTodo(t, db, user.ID, title))
+	}
+	// Squeezed so close, that moving the third in between renumbers them
+	db.Model(todos[0]).UpdateColumn("order_index", 1)
+	db.Model(todos[1]).UpdateColumn("order_index", math.Nextafter(1, 2))
+
+	ctx := userContext(user.ID)
+	if _, err := resolver.Mutation().ReorderTodo(ctx, todos[2].ID, &todos[0].ID, &todos[1].ID); err != nil {
+		t.Fatalf("ReorderTodo() in between error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		moved, err := resolver.Mutation().ReorderTodo(ctx, todos[1].ID, nil, &todos[0].ID)
+		if err != nil {
+			t.Fatalf("ReorderTodo() to the start error = %v", err)
+		}
+		if moved.OrderIndex <= 0 {
+			t.Fatalf("order index moved to the start = %v, want above 0", moved.OrderIndex)
+		}
+		todos[0], todos[1] = todos[1], todos[0]
+	}
+	ordered := []string{}
+	db.Model(&Todo{}).Where("user_id = ?", user.ID).Order("order_index").Pluck("title", &ordered)
+	if want := []string{"Second", "First", "Third"}; len(ordered) != 3 || ordered[0] != want[0] || ordered[1] != want[1] || ordered[2] != want[2] {
+		t.Errorf("order = %v, want %v", ordered, want)
+	}
+}
+
+func TestReorderTodoAcrossThePinnedBoundary(t *testing.T) {
+	tests := []struct {
+		name          string
+		moved         string
+		before, after string // none when empty
+		want          string
+		wantPinned    bool
+	}{
+		{"unpinned in between the pinned", "U2", "P1", "P2", "P1,U2,P2,U1,U3", true},
+		{"unpinned to the start", "U3", "", "P1", "U3,P1,P2,U1,U2", true},
+		{"pinned in between the unpinned", "P1", "U1", "U2", "P2,U1,P1,U2,U3", false},
+		{"pinned to the end", "P2", "U3", "", "P1,U1,U2,U3,P2", false},
+		{"pinned at the boundary", "P1", "P2", "U1", "P2,P1,U1,U2,U3", true},
+		{"unpinned at the boundary", "U3", "P2", "U1", "P1,P2,U3,U1,U2", false},
+		{"within the pinned", "P2", "", "P1", "P2,P1,U1,U2,U3", true},
+		{"within the unpinned", "U3", "U1", "U2", "P1,P2,U1,U3,U2", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			resolver := newTestResolver(db)
+			user := newTestUser(t, db, "pinned@example.com")
+			ids := map[string]*string{}
+			for _, title := range []string{"P1", "P2", "U1", "U2", "U3"} {
+				todo := newTestTodo(t, db, user.ID, title)
+				db.Model(todo).UpdateColumn("is_pinned", title[0] == 'P')
+				ids[title] = &todo.ID
+			}
+			moved, err := resolver.Mutation().ReorderTodo(userContext(user.ID), *ids[test.moved], ids[test.before], ids[test.after])
+			if err != nil {
+				t.Fatalf("Error while moving the todo -> %s", err)
+			}
+			if got := listedTitles(t, resolver, user.ID, nil); got != test.want || moved.IsPinned != test.wantPinned {
+				t.Errorf("got %s with the todo pinned %v, want %s pinned %v", got, moved.IsPinned, test.want, test.wantPinned)
+			}
+			stored := Todo{}
+			db.Where("id = ?", moved.ID).First(&stored)
+			if stored.IsPinned != test.wantPinned {
+				t.Errorf("got the todo stored pinned %v, want %v", stored.IsPinned, test.wantPinned)
+			}
+		})
+	}
+}
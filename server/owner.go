@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
+)
+
+// ownerDirective is '@owner', which checks the user may change the resources of the argument before resolving
+// the field, so that no mutation goes without the check. The resolvers still scope their queries to the user, as
+// they load the resources anyway: the scope costs nothing there, and keeps the resources of the others out, should
+// the resources change between the check & the query, or a field lose its directive
+func ownerDirective(db *gorm.DB) func(ctx context.Context, obj interface{}, next graphql.Resolver, of OwnedResource, arg string, collaborators bool, readers bool) (interface{}, error) {
+	return func(ctx context.Context, obj interface{}, next graphql.Resolver, of OwnedResource, arg string, collaborators bool, readers bool) (interface{}, error) {
+		userID, _ := ctx.Value(CtxUserIDKey).(string)
+		if userID == "" {
+			return nil, errors.New(MsgNotAuthenticated)
+		}
+		var ids []string
+		switch value := graphql.GetFieldContext(ctx).Args[arg].(type) {
+		case string:
+			ids = []string{value}
+		case []string:
+			ids = value
+		default:
+			return nil, errors.New(MsgNotFound) // The directive names an argument, which the field doesn't have
+		}
+		for _, id := range ids {
+			if err := checkOwner(contextDB(ctx, db), of, id, userID, collaborators, readers); err != nil {
+				return nil, err
+			}
+		}
+		return next(ctx)
+	}
+}
+
+// checkOwner tells whether the user may change the resource. A todo, its notes & revisions are changed by the
+// owner, and by the collaborators with the write permission if allowed, or by all of them if the readers are. The
+// labels, templates & webhooks are changed by their owner only. The collaborators who may only read get an
+// authorization error, the rest find nothing
+func checkOwner(db *gorm.DB, of OwnedResource, id string, userID string, collaborators bool, readers bool) error {
+	todoID := id
+	switch of {
+	case OwnedResourceLabel, OwnedResourceTemplate, OwnedResourceWebhook:
+		models := map[OwnedResource]interface{}{OwnedResourceLabel: &Label{}, OwnedResourceTemplate: &TodoTemplate{}, OwnedResourceWebhook: &Webhook{}}
+		count := 0
+		if err := db.Model(models[of]).Where("id = ? AND user_id = ?", id, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New(MsgNotFound)
+		}
+		return nil
+	case OwnedResourceNote:
+		note := Note{}
+		if err := db.Select("todo_id").Where("id = ?", id).First(&note).Error; err != nil {
+			return notFound(err)
+		}
+		todoID = note.TodoID
+	case OwnedResourceRevision:
+		revision := TodoRevision{}
+		if err := db.Select("todo_id").Where("id = ?", id).First(&revision).Error; err != nil {
+			return notFound(err)
+		}
+		todoID = revision.TodoID
+	}
+	todo := Todo{}
+	if err := db.Unscoped().Select("id, user_id").Where("id = ?", todoID).First(&todo).Error; err != nil { // The trashed ones are restored by the owner
+		return notFound(err)
+	}
+	if todo.UserID == userID {
+		return nil
+	}
+	if !isTodoCollaborator(db, todo.ID, userID) {
+		return errors.New(MsgNotFound)
+	}
+	if !readers && (!collaborators || !canWriteTodo(db, &todo, userID)) {
+		return errors.New(MsgNotAuthorized)
+	}
+	return nil
+}
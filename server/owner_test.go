@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// ownedMutations resolves the mutations into nothing, telling the test which were resolved, so that only
+// '@owner' stands between the users & the resources of the others
+type ownedMutations struct {
+	MutationResolver
+	resolved []string
+}
+
+func (m *ownedMutations) resolve(name string) (*Todo, error) {
+	m.resolved = append(m.resolved, name)
+	return nil, nil
+}
+func (m *ownedMutations) UpdateTodo(ctx context.Context, id string, title *string, notes []*NotesInput, labels []*string, color *string, isCheckboxMode *bool, expectedVersion *int) (*Todo, error) {
+	return m.resolve("updateTodo")
+}
+func (m *ownedMutations) DeleteTodo(ctx context.Context, id string) (*Todo, error) {
+	return m.resolve("deleteTodo")
+}
+func (m *ownedMutations) BulkDeleteTodos(ctx context.Context, ids []string) ([]*Todo, error) {
+	_, err := m.resolve("bulkDeleteTodos")
+	return []*Todo{}, err
+}
+func (m *ownedMutations) CompleteNote(ctx context.Context, id string, completed bool) (*Todo, error) {
+	return m.resolve("completeNote")
+}
+func (m *ownedMutations) RestoreRevision(ctx context.Context, revisionID string) (*Todo, error) {
+	return m.resolve("restoreRevision")
+}
+func (m *ownedMutations) UnlockTodo(ctx context.Context, id string, passphrase string) (*Todo, error) {
+	return m.resolve("unlockTodo")
+}
+func (m *ownedMutations) CreateTodoFromTemplate(ctx context.Context, templateID string) (*Todo, error) {
+	return m.resolve("createTodoFromTemplate")
+}
+func (m *ownedMutations) DeleteTemplate(ctx context.Context, id string) (*TodoTemplate, error) {
+	_, err := m.resolve("deleteTemplate")
+	return nil, err
+}
+func (m *ownedMutations) DeleteLabel(ctx context.Context, id string) (*Label, error) {
+	_, err := m.resolve("deleteLabel")
+	return nil, err
+}
+func (m *ownedMutations) UnregisterWebhook(ctx context.Context, id string) (*Webhook, error) {
+	_, err := m.resolve("unregisterWebhook")
+	return nil, err
+}
+
+type ownedResolverRoot struct {
+	*Resolver
+	mutations *ownedMutations
+}
+
+func (r *ownedResolverRoot) Mutation() MutationResolver {
+	return r.mutations
+}
+
+func TestOwnerDirective(t *testing.T) {
+	db := newTestDB(t)
+	owner := newTestUser(t, db, "owner@example.com")
+	reader := newTestUser(t, db, "reader@example.com")
+	writer := newTestUser(t, db, "writer@example.com")
+	stranger := newTestUser(t, db, "stranger@example.com")
+	todo := newTestTodo(t, db, owner.ID, "Shared")
+	other := newTestTodo(t, db, owner.ID, "Private")
+	newID := func() string {
+		id, _ := gonanoid.New(IDSize)
+		return id
+	}
+	note := &Note{ID: newID(), TodoID: todo.ID, Text: "Note"}
+	revision := &TodoRevision{ID: newID(), TodoID: todo.ID, Title: "Shared"}
+	template := &TodoTemplate{ID: newID(), Name: "Template", Color: "default", UserID: owner.ID}
+	label := &Label{ID: newID(), Name: "Label", UserID: owner.ID}
+	webhook := &Webhook{ID: newID(), URL: "https://example.com", Secret: "secret", UserID: owner.ID}
+	for _, value := range []interface{}{note, revision, template, label, webhook,
+		&TodoCollaborator{TodoID: todo.ID, UserID: reader.ID, Permission: PermissionRead},
+		&TodoCollaborator{TodoID: todo.ID, UserID: writer.ID, Permission: PermissionWrite}} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("Error while creating %T -> %s", value, err)
+		}
+	}
+	mutations := []struct {
+		name  string
+		query string
+		vars  map[string]interface{}
+	}{
+		{"updateTodo", `mutation($id: ID!) { updateTodo(id: $id, title: "Changed") { id } }`, map[string]interface{}{"id": todo.ID}},
+		{"deleteTodo", `mutation($id: ID!) { deleteTodo(id: $id) { id } }`, map[string]interface{}{"id": todo.ID}},
+		{"bulkDeleteTodos", `mutation($ids: [ID!]!) { bulkDeleteTodos(ids: $ids) { id } }`, map[string]interface{}{"ids": []string{other.ID, todo.ID}}},
+		{"completeNote", `mutation($id: ID!) { completeNote(id: $id, completed: true) { id } }`, map[string]interface{}{"id": note.ID}},
+		{"restoreRevision", `mutation($id: ID!) { restoreRevision(revisionId: $id) { id } }`, map[string]interface{}{"id": revision.ID}},
+		{"unlockTodo", `mutation($id: ID!) { unlockTodo(id: $id, passphrase: "secret") { id } }`, map[string]interface{}{"id": todo.ID}},
+		{"createTodoFromTemplate", `mutation($id: ID!) { createTodoFromTemplate(templateId: $id) { id } }`, map[string]interface{}{"id": template.ID}},
+		{"deleteTemplate", `mutation($id: ID!) { deleteTemplate(id: $id) { id } }`, map[string]interface{}{"id": template.ID}},
+		{"deleteLabel", `mutation($id: ID!) { deleteLabel(id: $id) { id } }`, map[string]interface{}{"id": label.ID}},
+		{"unregisterWebhook", `mutation($id: ID!) { unregisterWebhook(id: $id) { id } }`, map[string]interface{}{"id": webhook.ID}},
+	}
+	// The error of each user, where none is resolving the mutation
+	tests := []struct {
+		user   *User
+		errors map[string]string
+	}{
+		{owner, map[string]string{}},
+		{stranger, map[string]string{
+			"updateTodo": MsgNotFound, "deleteTodo": MsgNotFound, "bulkDeleteTodos": MsgNotFound, "completeNote": MsgNotFound,
+			"restoreRevision": MsgNotFound, "unlockTodo": MsgNotFound, "createTodoFromTemplate": MsgNotFound,
+			"deleteTemplate": MsgNotFound, "deleteLabel": MsgNotFound, "unregisterWebhook": MsgNotFound,
+		}},
+		{reader, map[string]string{
+			"updateTodo": MsgNotAuthorized, "deleteTodo": MsgNotAuthorized, "bulkDeleteTodos": MsgNotFound,
+			"completeNote": MsgNotAuthorized, "restoreRevision": MsgNotAuthorized, "createTodoFromTemplate": MsgNotFound,
+			"deleteTemplate": MsgNotFound, "deleteLabel": MsgNotFound, "unregisterWebhook": MsgNotFound,
+		}},
+		{writer, map[string]string{
+			"deleteTodo": MsgNotAuthorized, "bulkDeleteTodos": MsgNotFound, "createTodoFromTemplate": MsgNotFound,
+			"deleteTemplate": MsgNotFound, "deleteLabel": MsgNotFound, "unregisterWebhook": MsgNotFound,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.user.Email, func(t *testing.T) {
+			root := &ownedResolverRoot{Resolver: newTestResolver(db), mutations: &ownedMutations{}}
+			c := newTestClient(root, db)
+			for _, mutation := range mutations {
+				options := []client.Option{asUser(test.user.ID)}
+				for name, value := range mutation.vars {
+					options = append(options, client.Var(name, value))
+				}
+				response, err := c.RawPost(mutation.query, options...)
+				if err != nil {
+					t.Fatalf("Error while posting %s -> %s", mutation.name, err)
+				}
+				errs := []struct{ Message string }{}
+				if len(response.Errors) > 0 {
+					if err := json.Unmarshal(response.Errors, &errs); err != nil {
+						t.Fatalf("Error while reading the errors of %s -> %s", mutation.name, err)
+					}
+				}
+				got := ""
+				if len(errs) > 0 {
+					got = errs[0].Message
+				}
+				if got != test.errors[mutation.name] {
+					t.Errorf("%s: got error %q, want %q", mutation.name, got, test.errors[mutation.name])
+				}
+			}
+			for _, name := range root.mutations.resolved {
+				if test.errors[name] != "" {
+					t.Errorf("%s got resolved along with error %q", name, test.errors[name])
+				}
+			}
+			if want := len(mutations) - len(test.errors); len(root.mutations.resolved) != want {
+				t.Errorf("got %d mutations resolved, want %d", len(root.mutations.resolved), want)
+			}
+		})
+	}
+}
+
+// TestOwnerDirectiveCoverage checks every mutation taking the IDs of the resources checks them with a directive
+func TestOwnerDirectiveCoverage(t *testing.T) {
+	mutation := parsedSchema.Types["Mutation"]
+	for _, field := range mutation.Fields {
+		for _, argument := range field.Arguments {
+			if argument.Type.String() != "ID!" && argument.Type.String() != "[ID!]!" {
+				continue
+			}
+			if field.Directives.ForName("owner") == nil && field.Directives.ForName("admin") == nil {
+				t.Errorf("%s takes the %s by %s, but has neither '@owner' nor '@admin'", field.Name, argument.Name, argument.Type)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MsgInvalidCursor is the constant for Invalid Cursor message
+	MsgInvalidCursor string = "InvalidCursor"
+	// DefaultPageSize is the number of todos in a page, when 'first' is not given
+	DefaultPageSize int = 20
+	// MaxPageSize is the maximum number of todos that can be requested in a page
+	MaxPageSize int = 100
+)
+
+// encodeCursor creates an opaque cursor out of the todo's creation time and ID, which
+// together give a stable ordering even when new todos are created in between
+func encodeCursor(todo *Todo) string {
+	return base64.URLEncoding.EncodeToString([]byte(strconv.FormatInt(todo.CreatedAt.UnixNano(), 10) + ":" + todo.ID))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (time.Time, string, error) {
+	decoded, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errors.New(MsgInvalidCursor)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", errors.New(MsgInvalidCursor)
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", errors.New(MsgInvalidCursor)
+	}
+	return time.Unix(0, nanos), parts[1], nil
+}
+
+// pageSize is the number of the items in a page, as asked by 'first' within the maximum
+func pageSize(first *int) int {
+	size := DefaultPageSize
+	if first != nil && *first > 0 {
+		size = *first
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+	return size
+}
+
+// encodeLabelCursor creates an opaque cursor out of the label's ID and name, the labels being ordered by
+// name. The ID goes first, as it has no ':' unlike the names may
+func encodeLabelCursor(label *Label) string {
+	return base64.URLEncoding.EncodeToString([]byte(label.ID + ":" + label.Name))
+}
+
+// decodeLabelCursor reverses encodeLabelCursor
+func decodeLabelCursor(cursor string) (string, string, error) {
+	decoded, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", errors.New(MsgInvalidCursor)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New(MsgInvalidCursor)
+	}
+	return parts[1], parts[0], nil
+}
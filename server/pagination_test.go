@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		id        string
+	}{
+		{"nanoseconds", time.Date(2021, 4, 13, 10, 20, 30, 123456789, time.UTC), "V1StGXR8"},
+		{"other zone", time.Date(2021, 4, 13, 10, 20, 30, 0, time.FixedZone("IST", 5*3600+1800)), "V1StGXR8"},
+		{"before 1970", time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), "V1StGXR8"},
+		{"colon in ID", time.Date(2021, 4, 13, 0, 0, 0, 0, time.UTC), "a:b:c"},
+		{"empty ID", time.Date(2021, 4, 13, 0, 0, 0, 0, time.UTC), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			createdAt, id, err := decodeCursor(encodeCursor(&Todo{ID: test.id, CreatedAt: test.createdAt}))
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !createdAt.Equal(test.createdAt) || id != test.id {
+				t.Errorf("got %s & %q, want %s & %q", createdAt, id, test.createdAt, test.id)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "not a cursor!"},
+		{"no separator", base64.URLEncoding.EncodeToString([]byte("1618309230000000000"))},
+		{"no time", base64.URLEncoding.EncodeToString([]byte(":V1StGXR8"))},
+		{"time not a number", base64.URLEncoding.EncodeToString([]byte("yesterday:V1StGXR8"))},
+		{"time overflowing", base64.URLEncoding.EncodeToString([]byte("99999999999999999999:V1StGXR8"))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := decodeCursor(test.cursor); err == nil || err.Error() != MsgInvalidCursor {
+				t.Errorf("got error %v, want %s", err, MsgInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestLabelCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    string
+		label string
+	}{
+		{"plain", "V1StGXR8", "Work"},
+		{"colon in name", "V1StGXR8", "To do: later"},
+		{"empty name", "V1StGXR8", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, id, err := decodeLabelCursor(encodeLabelCursor(&Label{ID: test.id, Name: test.label}))
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if name != test.label || id != test.id {
+				t.Errorf("got %q & %q, want %q & %q", name, id, test.label, test.id)
+			}
+		})
+	}
+	for _, cursor := range []string{"", "not a cursor!", base64.URLEncoding.EncodeToString([]byte("V1StGXR8"))} {
+		if _, _, err := decodeLabelCursor(cursor); err == nil || err.Error() != MsgInvalidCursor {
+			t.Errorf("got error %v for cursor %q, want %s", err, cursor, MsgInvalidCursor)
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	size := func(first int) *int { return &first }
+	tests := []struct {
+		name  string
+		first *int
+		want  int
+	}{
+		{"not given", nil, DefaultPageSize},
+		{"zero", size(0), DefaultPageSize},
+		{"negative", size(-5), DefaultPageSize},
+		{"within", size(5), 5},
+		{"maximum", size(MaxPageSize), MaxPageSize},
+		{"over maximum", size(MaxPageSize + 1), MaxPageSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := pageSize(test.first); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// TestTodosConnectionPages walks the pages of the todos, some created at once, which each come once
+func TestTodosConnectionPages(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "pages@example.com")
+	createdAt := time.Date(2021, 4, 13, 10, 0, 0, 0, time.UTC)
+	want := map[string]bool{}
+	for index := 0; index < 7; index++ {
+		todo := newTestTodo(t, db, user.ID, "Todo")
+		db.Model(todo).UpdateColumn("created_at", createdAt.Add(time.Duration(index/3)*time.Second)) // three at a time
+		want[todo.ID] = true
+	}
+	first := 2
+	var after *string
+	seen := map[string]bool{}
+	for page := 0; ; page++ {
+		if page > len(want) {
+			t.Fatal("the pages never end")
+		}
+		connection, err := resolver.Query().TodosConnection(userContext(user.ID), &first, after, nil)
+		if err != nil {
+			t.Fatalf("Error while listing page %d -> %s", page, err)
+		}
+		for _, edge := range connection.Edges {
+			if seen[edge.Node.ID] {
+				t.Errorf("got todo %s on page %d again", edge.Node.ID, page)
+			}
+			seen[edge.Node.ID] = true
+		}
+		if !connection.PageInfo.HasNextPage {
+			break
+		}
+		after = connection.PageInfo.EndCursor
+	}
+	if len(seen) != len(want) {
+		t.Errorf("got %d todos over the pages, want %d", len(seen), len(want))
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// NeedsRehash tells whether the password hash is of a lower cost, as hashed before the cost was raised
+func NeedsRehash(hash string, cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && hashCost < cost
+}
+
+// RehashPassword hashes the password of the user again with the cost. The 'remember me' tokens are kept, unlike
+// on changing the password, as the password is the same
+func RehashPassword(db *gorm.DB, user *User, password string, cost int) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hash)
+	return db.Model(user).UpdateColumn("password", user.Password).Error
+}
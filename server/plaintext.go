@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strings"
+	"unicode"
+)
+
+// todoPlaintext is the todo as text to paste elsewhere, much like Keep's 'Copy to Google Docs'. The title comes
+// first, as a heading in Markdown, then the content. The items of a checklist are '- [ ]' or '- [x]' by whether
+// they're completed, the subitems are indented. The labels make up a trailing line of hashtags
+func todoPlaintext(todo *Todo, format ExportFormat) string {
+	parts := []string{}
+	if title := strings.TrimSpace(todo.Title); title != "" {
+		if format == ExportFormatMarkdown {
+			title = "# " + title
+		}
+		parts = append(parts, title)
+	}
+	lines := make([]string, len(todo.Notes))
+	for index, note := range todo.Notes {
+		if todo.Kind() == TodoKindText {
+			lines[index] = note.Text
+			continue
+		}
+		checkbox := "- [ ] "
+		if note.IsCompleted {
+			checkbox = "- [x] "
+		}
+		if note.ParentID != nil {
+			checkbox = "  " + checkbox
+		}
+		lines[index] = checkbox + strings.ReplaceAll(note.Text, "\n", " ")
+	}
+	if content := strings.Join(lines, "\n"); strings.TrimSpace(content) != "" {
+		parts = append(parts, content)
+	}
+	hashtags := make([]string, len(todo.Labels))
+	for index, label := range todo.Labels {
+		hashtags[index] = "#" + hashtag(label.Name)
+	}
+	if len(hashtags) > 0 {
+		parts = append(parts, strings.Join(hashtags, " "))
+	}
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+// hashtag is the label name as a hashtag, the spaces within replaced by underscores
+func hashtag(name string) string {
+	return strings.Join(strings.FieldsFunc(name, unicode.IsSpace), "_")
+}
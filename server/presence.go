@@ -0,0 +1,105 @@
+package server
+
+import (
+	"sort"
+	"sync"
+)
+
+// presenceBufferSize is the number of the presence events a busy stream can fall behind by
+const presenceBufferSize = 16
+
+// PresenceHub keeps in memory the users viewing each todo, and tells the viewers as others join & leave. A user
+// viewing on several clients joins with the first of them and leaves with the last
+type PresenceHub struct {
+	mu    sync.Mutex
+	todos map[string]*todoViewers // by todoID, of those being viewed
+}
+
+// todoViewers are the users viewing a todo, along with the streams of their clients
+type todoViewers struct {
+	viewers map[string]*Viewer // by userID
+	clients map[string]int     // by userID, the number of the clients viewing
+	streams map[chan *PresenceEvent]struct{}
+}
+
+// NewPresenceHub creates an instance of PresenceHub
+func NewPresenceHub() *PresenceHub {
+	return &PresenceHub{
+		todos: make(map[string]*todoViewers),
+	}
+}
+
+// join streams the presence of the todo's viewers until done, when the viewer leaves, as on closing the websocket.
+// The first event is the viewer's own join, which tells who else is viewing already
+func (h *PresenceHub) join(todoID string, viewer *Viewer, done <-chan struct{}) <-chan *PresenceEvent {
+	stream := make(chan *PresenceEvent, presenceBufferSize)
+	h.mu.Lock()
+	todo := h.todos[todoID]
+	if todo == nil {
+		todo = &todoViewers{
+			viewers: make(map[string]*Viewer),
+			clients: make(map[string]int),
+			streams: make(map[chan *PresenceEvent]struct{}),
+		}
+		h.todos[todoID] = todo
+	}
+	todo.streams[stream] = struct{}{}
+	todo.viewers[viewer.ID] = viewer
+	todo.clients[viewer.ID]++
+	if todo.clients[viewer.ID] == 1 {
+		todo.broadcast(PresenceActionJoined, viewer)
+	} else {
+		stream <- &PresenceEvent{Action: PresenceActionJoined, Viewer: viewer, Viewers: todo.list()} // The others know already
+	}
+	h.mu.Unlock()
+
+	go func() {
+		<-done
+		h.leave(todoID, viewer, stream)
+	}()
+	return stream
+}
+
+func (h *PresenceHub) leave(todoID string, viewer *Viewer, stream chan *PresenceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	todo := h.todos[todoID]
+	delete(todo.streams, stream)
+	todo.clients[viewer.ID]--
+	if todo.clients[viewer.ID] > 0 {
+		return
+	}
+	delete(todo.clients, viewer.ID)
+	delete(todo.viewers, viewer.ID)
+	if len(todo.streams) == 0 {
+		delete(h.todos, todoID)
+		return
+	}
+	todo.broadcast(PresenceActionLeft, viewer)
+}
+
+// broadcast sends the event to the streams of all the viewers
+func (t *todoViewers) broadcast(action PresenceAction, viewer *Viewer) {
+	event := &PresenceEvent{Action: action, Viewer: viewer, Viewers: t.list()}
+	for stream := range t.streams {
+		select {
+		case stream <- event:
+		default: // A busy stream misses the event, the viewers of the next one are up to date still
+		}
+	}
+}
+
+// list is the viewers by name
+func (t *todoViewers) list() []*Viewer {
+	viewers := make([]*Viewer, 0, len(t.viewers))
+	for _, viewer := range t.viewers {
+		viewers = append(viewers, viewer)
+	}
+	sort.Slice(viewers, func(i, j int) bool {
+		if viewers[i].Name != viewers[j].Name {
+			return viewers[i].Name < viewers[j].Name
+		}
+		return viewers[i].ID < viewers[j].ID
+	})
+	return viewers
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// MsgQuotaExceeded is the constant for Quota Exceeded message
+const MsgQuotaExceeded string = "QuotaExceeded"
+
+// Quota caps what each user stores, unlimited when 0. The admins are exempt
+type Quota struct {
+	MaxTodos           int
+	MaxAttachmentBytes int64
+}
+
+// newQuotaError tells the client, which of the quotas is exceeded along with the usage, in 'extensions'
+func newQuotaError(field string, max int64, usage int64) error {
+	return &gqlerror.Error{
+		Message: MsgQuotaExceeded,
+		Extensions: map[string]interface{}{
+			"code":  "QUOTA_EXCEEDED",
+			"field": field,
+			"max":   max,
+			"usage": usage,
+		},
+	}
+}
+
+// userUsage is what the user stores. The trash counts until it's purged, or restoring would get around the quota
+func userUsage(db *gorm.DB, userID string) (*Usage, error) {
+	usage := &Usage{}
+	if err := db.Unscoped().Model(&Todo{}).Where("user_id = ?", userID).Count(&usage.Todos).Error; err != nil {
+		return nil, err
+	}
+	sum := struct{ Bytes int }{}
+	err := db.Table("attachments").Select("COALESCE(SUM(attachments.size), 0) AS bytes").
+		Joins("JOIN todos ON todos.id = attachments.todo_id").Where("todos.user_id = ?", userID).Scan(&sum).Error
+	if err != nil {
+		return nil, err
+	}
+	usage.AttachmentBytes = sum.Bytes
+	return usage, nil
+}
+
+// checkTodos tells whether the user may store the more todos. The quota may be overshot by the requests racing
+// each other, which is no worse than a todo too many
+func (q *Quota) checkTodos(db *gorm.DB, userID string, todos int) error {
+	if q.MaxTodos == 0 {
+		return nil
+	}
+	usage, err := q.usage(db, userID)
+	if err != nil || usage == nil {
+		return err
+	}
+	if usage.Todos+todos > q.MaxTodos {
+		return newQuotaError("todos", int64(q.MaxTodos), int64(usage.Todos))
+	}
+	return nil
+}
+
+// checkAttachmentBytes tells whether the user may store the more bytes of attachments, to the todos they own
+func (q *Quota) checkAttachmentBytes(db *gorm.DB, userID string, bytes int64) error {
+	if q.MaxAttachmentBytes == 0 {
+		return nil
+	}
+	usage, err := q.usage(db, userID)
+	if err != nil || usage == nil {
+		return err
+	}
+	if int64(usage.AttachmentBytes)+bytes > q.MaxAttachmentBytes {
+		return newQuotaError("attachmentBytes", q.MaxAttachmentBytes, int64(usage.AttachmentBytes))
+	}
+	return nil
+}
+
+// usage is what the user stores, nil for the admins who are exempt
+func (q *Quota) usage(db *gorm.DB, userID string) (*Usage, error) {
+	user := User{ID: userID}
+	if err := db.Select("id, is_admin").First(&user).Error; err != nil {
+		return nil, err
+	}
+	if user.IsAdmin {
+		return nil, nil
+	}
+	return userUsage(db, userID)
+}
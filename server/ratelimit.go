@@ -0,0 +1,87 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the requests of the clients with a token bucket per client IP
+type RateLimiter struct {
+	rate           float64 // tokens refilled per second
+	burst          float64
+	trustedProxies int
+	mu             sync.Mutex
+	buckets        map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing the requests per minute of a client, in bursts too. The client IP
+// is taken from 'X-Forwarded-For', if the server runs behind the trusted proxies
+func NewRateLimiter(perMinute int, trustedProxies int) *RateLimiter {
+	limiter := &RateLimiter{
+		rate:           float64(perMinute) / 60,
+		burst:          float64(perMinute),
+		trustedProxies: trustedProxies,
+		buckets:        make(map[string]*tokenBucket),
+	}
+	go limiter.cleanup()
+	return limiter
+}
+
+// allow takes a token from the bucket of the client, else tells how long to wait for the next one
+func (l *RateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// cleanup drops the buckets of the idle clients, which are full again anyway
+func (l *RateLimiter) cleanup() {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		l.mu.Lock()
+		for client, bucket := range l.buckets {
+			if now.Sub(bucket.last) > refill {
+				delete(l.buckets, client)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	return clientIP(r, l.trustedProxies)
+}
+
+// Middleware responds with '429 Too Many Requests', once the client runs out of requests
+func (l *RateLimiter) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(l.clientIP(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		forwarded      []string
+		trustedProxies int
+		want           string
+	}{
+		{"untrusted", []string{"203.0.113.7"}, 0, "192.0.2.1"},
+		{"no header", nil, 1, "192.0.2.1"},
+		{"one proxy", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+		{"one proxy, spoofed", []string{"10.0.0.1, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"two proxies", []string{"10.0.0.1, 203.0.113.7, 198.51.100.2"}, 2, "203.0.113.7"},
+		{"two proxies, headers", []string{"10.0.0.1", "203.0.113.7", "198.51.100.2"}, 2, "203.0.113.7"},
+		{"fewer proxies", []string{"203.0.113.7"}, 2, "203.0.113.7"},
+		{"blank entries", []string{"203.0.113.7, ,"}, 1, "203.0.113.7"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:54321"
+			for _, forwarded := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if got := clientIP(r, test.trustedProxies); got != test.want {
+				t.Errorf("clientIP() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterPerClient(t *testing.T) {
+	limiter := NewRateLimiter(2, 1)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(forwarded string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := request("203.0.113.7"); code != http.StatusOK {
+			t.Fatalf("request #%d = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if code := request("10.0.0.1, 203.0.113.7"); code != http.StatusTooManyRequests {
+		t.Errorf("spoofed request = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := request("203.0.113.8"); code != http.StatusOK {
+		t.Errorf("request of another = %d, want %d", code, http.StatusOK)
+	}
+}
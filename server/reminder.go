@@ -0,0 +1,101 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ReminderHub delivers the todos with due reminders to the todo streams of their owners, and tells the reminder
+// streams of them
+type ReminderHub struct {
+	mu      sync.Mutex
+	streams map[string]map[chan<- *TodoAction]struct{} // by userID
+	dues    map[string]map[chan<- *ReminderEvent]struct{}
+}
+
+// NewReminderHub creates an instance of ReminderHub
+func NewReminderHub() *ReminderHub {
+	return &ReminderHub{
+		streams: make(map[string]map[chan<- *TodoAction]struct{}),
+		dues:    make(map[string]map[chan<- *ReminderEvent]struct{}),
+	}
+}
+
+func (h *ReminderHub) subscribe(userID string, stream chan<- *TodoAction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[chan<- *TodoAction]struct{})
+	}
+	h.streams[userID][stream] = struct{}{}
+}
+
+func (h *ReminderHub) unsubscribe(userID string, stream chan<- *TodoAction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams[userID], stream)
+	if len(h.streams[userID]) == 0 {
+		delete(h.streams, userID)
+	}
+}
+
+func (h *ReminderHub) subscribeDue(userID string, stream chan<- *ReminderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dues[userID] == nil {
+		h.dues[userID] = make(map[chan<- *ReminderEvent]struct{})
+	}
+	h.dues[userID][stream] = struct{}{}
+}
+
+func (h *ReminderHub) unsubscribeDue(userID string, stream chan<- *ReminderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.dues[userID], stream)
+	if len(h.dues[userID]) == 0 {
+		delete(h.dues, userID)
+	}
+}
+
+// Notify sends the due todos as updated to the todo streams of their owners, and as due to the reminder streams
+func (h *ReminderHub) Notify(todos []*Todo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, todo := range todos {
+		for stream := range h.streams[todo.UserID] {
+			select {
+			case stream <- &TodoAction{Action: ActionUpdated, Todo: todo}:
+			default: // A busy stream misses the event, the reminder still shows as due on the next fetch
+			}
+		}
+		for stream := range h.dues[todo.UserID] {
+			select {
+			case stream <- &ReminderEvent{TodoID: todo.ID, Title: todo.Title, RemindAt: *todo.RemindAt}:
+			default:
+			}
+		}
+	}
+}
+
+// DueReminders finds the todos, whose reminders have fallen due by the time and are not delivered yet, and
+// marks them delivered. Each is claimed on its own, so that it's delivered once, even by several instances
+func DueReminders(db *gorm.DB, until time.Time) ([]*Todo, error) {
+	todos := []*Todo{}
+	if err := db.Where("remind_at <= ? AND reminded_at IS NULL", until.UTC()).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	due := []*Todo{}
+	for _, todo := range todos {
+		// UpdateColumn leaves the version & the update time alone, as the todo isn't changed by the user
+		claim := db.Model(&Todo{}).Where("id = ? AND reminded_at IS NULL", todo.ID).UpdateColumn("reminded_at", until.UTC())
+		if claim.Error != nil {
+			return due, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			due = append(due, todo)
+		}
+	}
+	return due, nil
+}
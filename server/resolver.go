@@ -3,11 +3,20 @@ package server
 //go:generate go run github.com/99designs/gqlgen
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/jinzhu/gorm"
 	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/volatiletech/authboss/v3"
+	"github.com/volatiletech/authboss/v3/confirm"
+	"github.com/volatiletech/authboss/v3/defaults"
+	"golang.org/x/crypto/bcrypt"
 ) // THIS CODE IS A STARTING POINT ONLY. IT WILL NOT BE UPDATED WITH SCHEMA CHANGES.
 
 type CtxUserID string
@@ -15,15 +24,67 @@ type CtxUserID string
 const (
 	// MsgNotAuthenticated is the constant for Not Authenticated message
 	MsgNotAuthenticated string = "NotAuthenticated"
+	// MsgNotConfirmed is the constant for Not Confirmed message
+	MsgNotConfirmed string = "NotConfirmed"
+	// MsgLocked is the constant for Locked message
+	MsgLocked string = "Locked"
+	// MsgNotAuthorized is the constant for Not Authorized message
+	MsgNotAuthorized string = "NotAuthorized"
+	// MsgUserNotFound is the constant for User Not Found message
+	MsgUserNotFound string = "UserNotFound"
+	// MsgInvalidColor is the constant for Invalid Color message
+	MsgInvalidColor string = "InvalidColor"
+	// MsgLabelExists is the constant for Label Exists message
+	MsgLabelExists string = "LabelExists"
+	// MsgWrongPassword is the constant for Wrong Password message
+	MsgWrongPassword string = "WrongPassword"
+	// MsgInvalidPassword is the constant for Invalid Password message
+	MsgInvalidPassword string = "InvalidPassword"
+	// MsgInvalidEmail is the constant for Invalid Email message
+	MsgInvalidEmail string = "InvalidEmail"
+	// MsgInvalidName is the constant for Invalid Name message
+	MsgInvalidName string = "InvalidName"
+	// MsgEmailExists is the constant for Email Exists message
+	MsgEmailExists string = "EmailExists"
+	// MsgCSRFInvalid is the constant for CSRF Invalid message
+	MsgCSRFInvalid string = "CSRFInvalid"
+	// MsgNotFound is the constant for Not Found message
+	MsgNotFound string = "NotFound"
 	// CtxUserIDKey holds the key for 'userid' value
 	CtxUserIDKey CtxUserID = "userid"
+	// CtxRequestIDKey holds the key for 'requestid' value
+	CtxRequestIDKey CtxUserID = "requestid"
+	// SessionEpochKey is the session key holding the session epoch of the user at login
+	SessionEpochKey string = "epoch"
 	// IDSize is the size of the UIDs generated for DB columns
 	IDSize int = 4
 )
 
 // Resolver holds the Query, mutation and subscription resolvers
 type Resolver struct {
-	DB *gorm.DB
+	DB                *gorm.DB
+	Reminders         *ReminderHub
+	TodoEvents        *TodoHub
+	LabelEvents       *LabelHub
+	Presence          *PresenceHub
+	Undos             *UndoLog
+	Idempotency       *IdempotencyLog
+	Blobs             BlobStore // of the contents of the attachments
+	MaxAttachmentSize int64
+	RevisionLimit     int // revisions kept per todo
+	Auth              *authboss.Authboss
+	EmailRule         defaults.Rules // the changed details must follow the rules of registration
+	PasswordRule      defaults.Rules
+	NameRule          defaults.Rules
+	Limits            Limits       // of the size of the todos
+	Quota             Quota        // of what each user stores
+	SearchIndex       *SearchIndex // nil without FTS5, the basic search is used then
+	AuditLog          *AuditLog
+}
+
+// db is the DB bound to the context of the operation, so that its queries are cancelled along with it
+func (r *Resolver) db(ctx context.Context) *gorm.DB {
+	return contextDB(ctx, r.DB)
 }
 
 // Mutation returns an instance of mutationResolver
@@ -43,18 +104,33 @@ func (r *Resolver) Subscription() SubscriptionResolver {
 
 type mutationResolver struct{ *Resolver }
 
-func (r *mutationResolver) CreateTodo(ctx context.Context, title string, notes []string, labels []*string, color *string, isCheckboxMode *bool) (*Todo, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
+func (r *mutationResolver) CreateTodo(ctx context.Context, title string, notes []string, labels []*string, color *string, isCheckboxMode *bool, device *SourceDevice, idempotencyKey *string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		existing, finish, err := r.Idempotency.replay(ctx, r.db(ctx), userID, idempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+		created := ""
+		defer func() { finish(created) }()
+		if err := r.Limits.checkTodoInput(title, notes, len(labels)); err != nil {
+			return nil, err
+		}
+		if err := r.Quota.checkTodos(r.db(ctx), userID, 1); err != nil {
+			return nil, err
+		}
 		newTodoID, _ := gonanoid.New(IDSize)
 		todo := Todo{
-			ID:     newTodoID,
-			Title:  title,
-			UserID: userID,
-			Notes:  make([]*Note, len(notes)),
+			ID:           newTodoID,
+			Title:        title,
+			UserID:       userID,
+			Notes:        make([]*Note, len(notes)),
+			SourceDevice: sourceDevice(ctx, device),
 		}
 		if color != nil {
-			todo.Color = *color
+			if !TodoColor(strings.ToUpper(*color)).IsValid() {
+				return nil, errors.New(MsgInvalidColor)
+			}
+			todo.Color = strings.ToLower(*color) // Stored as the palette key, whatever the casing given
 		}
 		if isCheckboxMode != nil {
 			todo.IsCheckboxMode = *isCheckboxMode
@@ -65,36 +141,184 @@ func (r *mutationResolver) CreateTodo(ctx context.Context, title string, notes [
 				ID:          newNoteID,
 				Text:        note,
 				IsCompleted: false,
+				Position:    index,
+			}
+		}
+		if err := r.db(ctx).Where("id in (?)", labels).Find(&todo.Labels).Error; err != nil { // Load the related labels
+			return nil, err
+		}
+		if err := r.db(ctx).Create(&todo).Error; err != nil {
+			return nil, err
+		}
+		created = todo.ID
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) CreateTodoWithContent(ctx context.Context, input TodoInput) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		existing, finish, err := r.Idempotency.replay(ctx, r.db(ctx), userID, input.IdempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+		created := ""
+		defer func() { finish(created) }()
+		texts := make([]string, len(input.Notes))
+		for index, note := range input.Notes {
+			texts[index] = note.Text
+		}
+		if err := r.Limits.checkTodoInput(input.Title, texts, countUnique(input.Labels)); err != nil {
+			return nil, err
+		}
+		if err := r.Quota.checkTodos(r.db(ctx), userID, 1); err != nil {
+			return nil, err
+		}
+		newTodoID, _ := gonanoid.New(IDSize)
+		todo := Todo{
+			ID:           newTodoID,
+			Title:        input.Title,
+			UserID:       userID,
+			Notes:        make([]*Note, len(input.Notes)),
+			Labels:       []*Label{},
+			SourceDevice: sourceDevice(ctx, input.SourceDevice),
+		}
+		if input.Color != nil {
+			todo.Color = strings.ToLower(input.Color.String())
+		}
+		if input.IsCheckboxMode != nil {
+			todo.IsCheckboxMode = *input.IsCheckboxMode
+		}
+		for index, note := range input.Notes {
+			newNoteID, _ := gonanoid.New(IDSize)
+			todo.Notes[index] = &Note{
+				ID:          newNoteID,
+				Text:        note.Text,
+				IsCompleted: note.IsCompleted,
+				Position:    index,
+			}
+		}
+		nestNotes(todo.Notes, isIndented(input.Notes))
+		// The todo, its notes & labels are created all or none
+		err = transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if len(input.Labels) > 0 {
+				if err := tx.Where("id IN (?) AND user_id = ?", input.Labels, userID).Find(&todo.Labels).Error; err != nil {
+					return err
+				}
+				if len(todo.Labels) != countUnique(input.Labels) {
+					return errors.New(MsgNotAuthorized)
+				}
+			}
+			return tx.Create(&todo).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		created = todo.ID
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) DuplicateTodo(ctx context.Context, id string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		original := Todo{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).Preload("Notes", orderedNotes).Preload("Labels").First(&original).Error; err != nil { // Only the owner duplicates
+			return nil, notFound(err)
+		}
+		if err := checkUnlocked(&original); err != nil { // The sealed notes open only for the todo they're of
+			return nil, err
+		}
+		newTodoID, _ := gonanoid.New(IDSize)
+		todo := Todo{
+			ID:             newTodoID,
+			Title:          original.Title + " (copy)",
+			UserID:         userID,
+			Notes:          make([]*Note, len(original.Notes)),
+			Labels:         original.Labels,
+			Color:          original.Color,
+			Background:     original.Background,
+			IsCheckboxMode: original.IsCheckboxMode,
+			SourceDevice:   sourceDevice(ctx, nil),
+		}
+		for index, note := range original.Notes {
+			newNoteID, _ := gonanoid.New(IDSize)
+			todo.Notes[index] = &Note{
+				ID:          newNoteID,
+				Text:        note.Text,
+				IsCompleted: note.IsCompleted,
+				Position:    index,
 			}
 		}
-		if err := r.DB.Where("id in (?)", labels).Find(&todo.Labels).Error; err != nil { // Load the related labels
+		nestNotes(todo.Notes, isNested(original.Notes))
+		if err := r.Limits.checkTodo(&todo); err != nil { // The title may have grown too long with the suffix
+			return nil, err
+		}
+		if err := r.Quota.checkTodos(r.db(ctx), userID, 1); err != nil {
 			return nil, err
 		}
-		if err := r.DB.Create(&todo).Error; err != nil {
+		// The copy, its notes & labels are created all or none
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			return tx.Create(&todo).Error
+		})
+		if err != nil {
 			return nil, err
 		}
 		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *mutationResolver) UpdateTodo(ctx context.Context, id string, title *string, notes []*NotesInput, labels []*string, color *string, isCheckboxMode *bool) (*Todo, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
+func (r *mutationResolver) UpdateTodo(ctx context.Context, id string, title *string, notes []*NotesInput, labels []*string, color *string, isCheckboxMode *bool, expectedVersion *int) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
 		todo := Todo{
 			ID:     id,
 			UserID: userID,
 			Labels: []*Label{},
 			Notes:  []*Note{},
 		}
-		if err := r.DB.Where("user_id = ?", userID).Preload("Notes").Preload("Labels").Find(&todo).Error; err != nil {
-			return nil, err
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if expectedVersion != nil && *expectedVersion != todo.Version { // The edit was made on a stale todo, like when offline
+			return nil, newConflictError(&todo)
+		}
+		if title != nil {
+			if err := r.Limits.checkTitle(*title); err != nil {
+				return nil, err
+			}
+		}
+		if notes != nil {
+			if err := checkUnlocked(&todo); err != nil {
+				return nil, err
+			}
+			texts := make([]string, len(notes))
+			for index, note := range notes {
+				texts[index] = note.Text
+			}
+			if err := r.Limits.checkNotes(texts); err != nil {
+				return nil, err
+			}
+		}
+		if labels != nil {
+			if err := r.Limits.checkLabels(len(labels)); err != nil {
+				return nil, err
+			}
+		}
+		var revision *TodoRevision
+		if title != nil || notes != nil { // Only the title & the notes are kept in the history
+			var err error
+			if revision, err = newTodoRevision(&todo, userID); err != nil {
+				return nil, err
+			}
 		}
 
+		staleNotes := []*Note{}
 		if title != nil {
 			todo.Title = *title
 		}
 		if color != nil {
-			todo.Color = *color
+			if !TodoColor(strings.ToUpper(*color)).IsValid() {
+				return nil, errors.New(MsgInvalidColor)
+			}
+			todo.Color = strings.ToLower(*color) // Stored as the palette key, whatever the casing given
 		}
 		if isCheckboxMode != nil {
 			todo.IsCheckboxMode = *isCheckboxMode
@@ -107,232 +331,1746 @@ func (r *mutationResolver) UpdateTodo(ctx context.Context, id string, title *str
 					ID:          newNoteID,
 					Text:        note.Text,
 					IsCompleted: note.IsCompleted,
+					Position:    index,
 				}
 			}
-			// Updating Association just updates the references, won't clear the data. So, manually deleting the notes
-			if len(todo.Notes) > 0 {
-				notesIDs := make([]string, len(todo.Notes))
-				for index, noteItem := range todo.Notes {
-					notesIDs[index] = noteItem.ID
-				}
-				r.DB.Where("id in (?)", notesIDs).Delete(Note{})
-			}
+			nestNotes(nts, isIndented(notes))
+			staleNotes = todo.Notes
 			todo.Notes = nts
 		}
 		if labels != nil {
 			lbls := []*Label{}
-			r.DB.Where("id in (?)", labels).Find(&lbls)
-			r.DB.Model(&todo).Association("Labels").Clear()
+			r.db(ctx).Where("id in (?) AND user_id = ?", labels, todo.UserID).Find(&lbls) // Collaborators can only pick the labels of the owner
 			todo.Labels = lbls
 		}
-		if err := r.DB.Save(&todo).Error; err != nil {
+		if err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := claimVersion(tx, &todo, userID); err != nil {
+				return err
+			}
+			// Updating Association just updates the references, won't clear the data. So, manually deleting the notes
+			if len(staleNotes) > 0 {
+				notesIDs := make([]string, len(staleNotes))
+				for index, noteItem := range staleNotes {
+					notesIDs[index] = noteItem.ID
+				}
+				if err := tx.Where("id in (?)", notesIDs).Delete(Note{}).Error; err != nil {
+					return err
+				}
+			}
+			if labels != nil {
+				if err := tx.Model(&todo).Association("Labels").Clear().Error; err != nil {
+					return err
+				}
+			}
+			if revision != nil {
+				if err := saveRevision(tx, revision, r.RevisionLimit); err != nil {
+					return err
+				}
+			}
+			return tx.Save(&todo).Error
+		}); err != nil {
 			return nil, err
 		}
 		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *mutationResolver) DeleteTodo(ctx context.Context, id string) (*Todo, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
+func (r *mutationResolver) PatchTodo(ctx context.Context, id string, input TodoPatch) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
 		todo := Todo{
 			ID:     id,
 			UserID: userID,
+			Labels: []*Label{},
 			Notes:  []*Note{},
 		}
-		if err := r.DB.Where("user_id = ?", userID).Preload("Notes").Find(&todo).Error; err != nil { // Only load associated notes
-			return nil, err
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
 		}
-		if err := r.DB.Model(&todo).Association("Labels").Clear().Error; err != nil {
-			return nil, err
+		if input.ExpectedVersion != nil && *input.ExpectedVersion != todo.Version {
+			return nil, newConflictError(&todo)
+		}
+		if input.Title != nil {
+			if err := r.Limits.checkTitle(*input.Title); err != nil {
+				return nil, err
+			}
+		}
+		if input.Notes != nil {
+			if err := checkUnlocked(&todo); err != nil {
+				return nil, err
+			}
+			texts := make([]string, len(input.Notes))
+			for index, note := range input.Notes {
+				texts[index] = note.Text
+			}
+			if err := r.Limits.checkNotes(texts); err != nil {
+				return nil, err
+			}
+		}
+		var revision *TodoRevision
+		if input.Title != nil || input.Notes != nil {
+			var err error
+			if revision, err = newTodoRevision(&todo, userID); err != nil {
+				return nil, err
+			}
+		}
+
+		// Only the fields given are changed, the rest are left as they are
+		staleNotes := todo.Notes
+		if input.Title != nil {
+			todo.Title = *input.Title
+		}
+		if input.Notes != nil {
+			todo.Notes = make([]*Note, len(input.Notes))
+			for index, note := range input.Notes {
+				noteID, _ := gonanoid.New(IDSize)
+				todo.Notes[index] = &Note{
+					ID:          noteID,
+					Text:        note.Text,
+					IsCompleted: note.IsCompleted,
+					Position:    index,
+				}
+			}
+			nestNotes(todo.Notes, isIndented(input.Notes))
+		}
+		if input.Color != nil {
+			todo.Color = strings.ToLower(input.Color.String())
 		}
-		if err := r.DB.Delete(todo).Error; err != nil {
+		if input.Pinned != nil {
+			todo.IsPinned = *input.Pinned
+		}
+		if input.Archived != nil {
+			todo.IsArchived = *input.Archived
+		}
+		if err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := claimVersion(tx, &todo, userID); err != nil {
+				return err
+			}
+			if input.Notes != nil && len(staleNotes) > 0 {
+				notesIDs := make([]string, len(staleNotes))
+				for index, noteItem := range staleNotes {
+					notesIDs[index] = noteItem.ID
+				}
+				if err := tx.Where("id in (?)", notesIDs).Delete(Note{}).Error; err != nil {
+					return err
+				}
+			}
+			if revision != nil {
+				if err := saveRevision(tx, revision, r.RevisionLimit); err != nil {
+					return err
+				}
+			}
+			return tx.Save(&todo).Error // A single save, so the subscribers get a single update of all the changes
+		}); err != nil {
 			return nil, err
 		}
 		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *mutationResolver) CopyTodo(ctx context.Context, sourceID string) (*Todo, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
+func (r *mutationResolver) ConvertTodoKind(ctx context.Context, id string, kind TodoKind) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
 		todo := Todo{
-			ID:     sourceID,
-			UserID: userID,
+			ID:     id,
 			Labels: []*Label{},
 			Notes:  []*Note{},
 		}
-		if err := r.DB.Where("user_id = ?", userID).Preload("Notes").Preload("Labels").First(&todo).Error; err != nil {
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if todo.Kind() == kind {
+			return &todo, nil
+		}
+		if err := checkUnlocked(&todo); err != nil {
 			return nil, err
 		}
-		todo.ID, _ = gonanoid.New(IDSize)
-		for _, note := range todo.Notes {
-			note.ID, _ = gonanoid.New(IDSize)
+		revision, err := newTodoRevision(&todo, userID)
+		if err != nil {
+			return nil, err
+		}
+		notes := convertNotes(todo.Notes, kind)
+		if err := r.Limits.checkNotes(noteTexts(notes)); err != nil {
+			return nil, err
 		}
-		if err := r.DB.Create(&todo).Error; err != nil {
+		err = transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := claimVersion(tx, &todo, userID); err != nil {
+				return err
+			}
+			if err := tx.Where("todo_id = ?", todo.ID).Delete(Note{}).Error; err != nil {
+				return err
+			}
+			if err := saveRevision(tx, revision, r.RevisionLimit); err != nil {
+				return err
+			}
+			todo.Notes = notes
+			todo.IsCheckboxMode = kind == TodoKindList
+			return tx.Save(&todo).Error
+		})
+		if err != nil {
 			return nil, err
 		}
 		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *mutationResolver) CreateLabel(ctx context.Context, name string) (*Label, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		newLabelID, _ := gonanoid.New(IDSize)
-		label := Label{
-			ID:     newLabelID,
-			Name:   name,
-			UserID: userID,
+func (r *mutationResolver) ReorderTodo(ctx context.Context, id string, beforeID *string, afterID *string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		// Only the owner orders the todos, the collaborators see them in the order of the owner
+		loadOwned := func(tx *gorm.DB, todoID *string) (*Todo, error) {
+			if todoID == nil {
+				return nil, nil
+			}
+			neighbour := &Todo{}
+			if err := tx.Where("id = ? AND user_id = ?", *todoID, userID).First(neighbour).Error; err != nil {
+				return nil, err
+			}
+			return neighbour, nil
 		}
-		if err := r.DB.Create(&label).Error; err != nil {
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := tx.Where("id = ? AND user_id = ?", id, userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+				return notFound(err)
+			}
+			before, err := loadOwned(tx, beforeID)
+			if err != nil {
+				return err
+			}
+			after, err := loadOwned(tx, afterID)
+			if err != nil {
+				return err
+			}
+			if before == nil && after == nil {
+				return nil
+			}
+			index, ok := placeTodo(&todo, before, after)
+			if !ok { // Rare enough to renumber all the todos of the user
+				if err := renumberTodos(tx, userID); err != nil {
+					return err
+				}
+				if before, err = loadOwned(tx, beforeID); err != nil {
+					return err
+				}
+				if after, err = loadOwned(tx, afterID); err != nil {
+					return err
+				}
+				index, _ = placeTodo(&todo, before, after)
+			}
+			todo.OrderIndex = index
+			return tx.Save(&todo).Error // fires the update callback for the subscribers
+		})
+		if err != nil {
 			return nil, err
 		}
-		return &label, nil
+		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *mutationResolver) DeleteLabel(ctx context.Context, id string) (*Label, error) {
-	panic("not implemented")
-}
-func (r *mutationResolver) UpdateUser(ctx context.Context, listMode *bool, darkMode *bool) (*User, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		user := User{
-			ID: userID,
+func (r *mutationResolver) AddLabelToTodo(ctx context.Context, id string, labelID string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			Labels: []*Label{},
+			Notes:  []*Note{},
 		}
-		if err := r.DB.First(&user).Error; err != nil {
-			return nil, err
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
 		}
-		if listMode != nil {
-			user.ListMode = *listMode
+		label := Label{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", labelID, todo.UserID).First(&label).Error; err != nil { // Collaborators can only pick the labels of the owner
+			return nil, notFound(err)
 		}
-		if darkMode != nil {
-			user.DarkMode = *darkMode
+		for _, todoLabel := range todo.Labels {
+			if todoLabel.ID == label.ID {
+				return &todo, nil
+			}
 		}
-		if err := r.DB.Save(&user).Error; err != nil {
+		todo.Labels = append(todo.Labels, &label)
+		if err := r.Limits.checkLabels(len(todo.Labels)); err != nil {
 			return nil, err
 		}
-		return &user, nil
+		// Saved as a whole, so that the subscribers get the todo along with its labels
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil {
+			return nil, err
+		}
+		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-
-type queryResolver struct{ *Resolver }
-
-func (r *queryResolver) Todos(ctx context.Context) ([]*Todo, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		todos := []*Todo{}
-		if err := r.DB.Where("user_id = ?", userID).Preload("Notes").Preload("Labels").Find(&todos).Error; err != nil {
+func (r *mutationResolver) RemoveLabelFromTodo(ctx context.Context, id string, labelID string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		labels := []*Label{}
+		for _, todoLabel := range todo.Labels {
+			if todoLabel.ID != labelID {
+				labels = append(labels, todoLabel)
+			}
+		}
+		if len(labels) == len(todo.Labels) {
+			return &todo, nil
+		}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := claimVersion(tx, &todo, userID); err != nil {
+				return err
+			}
+			if err := tx.Model(&todo).Association("Labels").Delete(&Label{ID: labelID}).Error; err != nil {
+				return err
+			}
+			todo.Labels = labels
+			return tx.Save(&todo).Error // publishes the todo without the label to the subscribers
+		})
+		if err != nil {
 			return nil, err
 		}
-		return todos, nil
+		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
-
 }
-func (r *queryResolver) Labels(ctx context.Context) ([]*Label, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		labels := []*Label{}
-		if err := r.DB.Where("user_id = ?", userID).Preload("Todos").Find(&labels).Error; err != nil {
+func (r *mutationResolver) DeleteTodo(ctx context.Context, id string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Notes:  []*Note{},
+		}
+		if err := r.db(ctx).Where("user_id = ?", userID).Preload("Notes", orderedNotes).Find(&todo).Error; err != nil { // Only load associated notes
+			return nil, notFound(err)
+		}
+		// Todo has 'DeletedAt', so it's only moved to trash. Labels are kept, so that it can be restored as is
+		if err := rowsAffected(r.db(ctx).Delete(todo)); err != nil {
 			return nil, err
 		}
-		return labels, nil
+		todo.UndoToken = r.Undos.issue(&undoAction{userID: userID, todoID: todo.ID, deleted: true})
+		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *queryResolver) User(ctx context.Context) (*User, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		user := User{
-			ID: userID,
+func (r *mutationResolver) RestoreTodo(ctx context.Context, id string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
 		}
-		if err := r.DB.First(&user).Error; err != nil {
+		if err := r.db(ctx).Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if err := rowsAffected(r.db(ctx).Unscoped().Model(&todo).Update("deleted_at", nil)); err != nil {
 			return nil, err
 		}
-		return &user, nil
+		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-
-type subscriptionResolver struct{ *Resolver }
-
-func (r *subscriptionResolver) TodoStream(ctx context.Context) (<-chan *TodoAction, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		todoAction := make(chan *TodoAction, 1)
-		callbackCreateID, _ := gonanoid.New(6)
-		callbackUpdateID, _ := gonanoid.New(6)
-		callbackDeleteID, _ := gonanoid.New(6)
-		r.DB.Callback().Create().Register(callbackCreateID, func(scope *gorm.Scope) {
-			createdTodo, ok := scope.Value.(*Todo)
-			if ok && scope.TableName() == "todos" && createdTodo.UserID == userID {
-				todoAction <- &TodoAction{
-					Action: ActionCreated,
-					Todo:   createdTodo,
-				}
+func (r *mutationResolver) RestoreRevision(ctx context.Context, revisionID string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			revision := TodoRevision{ID: revisionID}
+			if err := tx.First(&revision).Error; err != nil {
+				return notFound(err)
 			}
-		})
-		r.DB.Callback().Update().Register(callbackUpdateID, func(scope *gorm.Scope) {
-			updatedTodo, ok := scope.Value.(*Todo)
-			if ok && scope.TableName() == "todos" && updatedTodo.UserID == userID {
-				todoAction <- &TodoAction{
-					Action: ActionUpdated,
-					Todo:   updatedTodo,
-				}
+			if err := visibleTodos(tx, userID).Where("id = ?", revision.TodoID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+				return notFound(err)
 			}
-		})
-		r.DB.Callback().Delete().Register(callbackDeleteID, func(scope *gorm.Scope) {
-			deletedTodo, ok := scope.Value.(Todo)
-			if ok && scope.TableName() == "todos" && deletedTodo.UserID == userID {
-				todoAction <- &TodoAction{
-					Action: ActionDeleted,
-					Todo:   &deletedTodo,
-				}
+			if err := checkUnlocked(&todo); err != nil {
+				return err
+			}
+			// The current state goes into the history too, so that the restore can be undone
+			current, err := newTodoRevision(&todo, userID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("todo_id = ?", todo.ID).Delete(Note{}).Error; err != nil {
+				return err
+			}
+			todo.Title = revision.Title
+			todo.Notes = revision.Notes()
+			for _, note := range todo.Notes {
+				note.ID, _ = gonanoid.New(IDSize)
 			}
+			nestNotes(todo.Notes, isNested(todo.Notes))
+			if err := saveRevision(tx, current, r.RevisionLimit); err != nil {
+				return err
+			}
+			return tx.Save(&todo).Error
 		})
-		go func() {
-			<-ctx.Done()
-			r.DB.Callback().Create().Remove(callbackCreateID)
-			r.DB.Callback().Update().Remove(callbackUpdateID)
-			r.DB.Callback().Delete().Remove(callbackDeleteID)
-		}()
-		return todoAction, nil
+		if err != nil {
+			return nil, err
+		}
+		return &todo, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
-func (r *subscriptionResolver) LabelStream(ctx context.Context) (<-chan *LabelAction, error) {
-	if userID := ctx.Value(CtxUserIDKey); userID != "" {
-		userID := userID.(string)
-		labelAction := make(chan *LabelAction, 1)
-		callbackCreateID, _ := gonanoid.New(6)
-		callbackUpdateID, _ := gonanoid.New(6)
-		r.DB.Callback().Create().Register(callbackCreateID, func(scope *gorm.Scope) {
-			createdLabel, ok := scope.Value.(*Label)
-			if ok && scope.TableName() == "labels" && createdLabel.UserID == userID {
-				labelAction <- &LabelAction{
-					Action: ActionCreated,
-					Label:  createdLabel,
-				}
-			}
-		})
-		r.DB.Callback().Update().Register(callbackUpdateID, func(scope *gorm.Scope) {
-			updatedLabel, ok := scope.Value.(*Label)
-			if ok && scope.TableName() == "labels" && updatedLabel.UserID == userID {
-				labelAction <- &LabelAction{
-					Action: ActionUpdated,
-					Label:  updatedLabel,
-				}
-			}
-		})
-		go func() {
-			<-ctx.Done()
-			r.DB.Callback().Create().Remove(callbackCreateID)
-			r.DB.Callback().Update().Remove(callbackUpdateID)
-		}()
-		return labelAction, nil
+func (r *mutationResolver) CopyTodo(ctx context.Context, sourceID string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     sourceID,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := r.db(ctx).Where("user_id = ?", userID).Preload("Notes", orderedNotes).Preload("Labels").First(&todo).Error; err != nil { // Attachments aren't copied
+			return nil, notFound(err)
+		}
+		if err := checkUnlocked(&todo); err != nil {
+			return nil, err
+		}
+		todo.ID, _ = gonanoid.New(IDSize)
+		if err := r.Quota.checkTodos(r.db(ctx), userID, 1); err != nil {
+			return nil, err
+		}
+		todo.SourceDevice = sourceDevice(ctx, nil) // The copy is created on this device
+		todo.IsOngoing = false                     // as the original stays ongoing
+		for _, note := range todo.Notes {
+			note.ID, _ = gonanoid.New(IDSize)
+		}
+		if err := r.db(ctx).Create(&todo).Error; err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) SaveTodoAsTemplate(ctx context.Context, id string, name string) (*TodoTemplate, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).Preload("Notes", orderedNotes).Preload("Labels").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if err := checkUnlocked(&todo); err != nil { // The sealed notes aren't to be kept in the clear
+			return nil, err
+		}
+		if name = strings.TrimSpace(name); name == "" {
+			name = todo.Title
+		}
+		if err := r.Limits.checkTitle(name); err != nil {
+			return nil, err
+		}
+		count := 0
+		if err := r.db(ctx).Model(&TodoTemplate{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count >= maxTemplates {
+			return nil, newLimitError("templates", maxTemplates)
+		}
+		template, err := newTodoTemplate(&todo, userID, name)
+		if err != nil {
+			return nil, err
+		}
+		// The template & its labels are created all or none
+		err = transaction(r.db(ctx), func(tx *gorm.DB) error {
+			return tx.Create(template).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		return template, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) CreateTodoFromTemplate(ctx context.Context, templateID string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		template := TodoTemplate{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", templateID, userID).Preload("Labels").First(&template).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo := template.newTodo(userID)
+		todo.SourceDevice = sourceDevice(ctx, nil)
+		if err := r.Limits.checkTodo(todo); err != nil { // The limits may have been lowered since it was saved
+			return nil, err
+		}
+		if err := r.Quota.checkTodos(r.db(ctx), userID, 1); err != nil {
+			return nil, err
+		}
+		// The todo, its notes & labels are created all or none
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			return tx.Create(todo).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		return todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) DeleteTemplate(ctx context.Context, id string) (*TodoTemplate, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		template := TodoTemplate{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).Preload("Labels").First(&template).Error; err != nil {
+			return nil, notFound(err)
+		}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM todo_templates_labels WHERE todo_template_id = ?", template.ID).Error; err != nil {
+				return err
+			}
+			return rowsAffected(tx.Where("id = ? AND user_id = ?", template.ID, userID).Delete(&TodoTemplate{}))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &template, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) PinTodo(ctx context.Context, id string, pinned bool) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo.IsPinned = pinned
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil { // Save fires the update callback, so subscribers reorder too
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) SetOngoing(ctx context.Context, id string, ongoing bool) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		// The previous ongoing todo is cleared along, so that at most one is ongoing
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			todo := Todo{}
+			if err := tx.Where("id = ? AND user_id = ?", id, userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+				return notFound(err)
+			}
+			if ongoing {
+				previous := []*Todo{}
+				if err := tx.Where("user_id = ? AND is_ongoing = ? AND id <> ?", userID, true, id).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&previous).Error; err != nil {
+					return err
+				}
+				for _, other := range previous {
+					other.IsOngoing = false
+					if err := tx.Save(other).Error; err != nil { // Save fires the update callback for the subscribers
+						return err
+					}
+					todos = append(todos, other)
+				}
+				// The trashed ones would be ongoing again once restored, they're cleared quietly
+				if err := tx.Unscoped().Model(&Todo{}).Where("user_id = ? AND is_ongoing = ? AND deleted_at IS NOT NULL", userID, true).UpdateColumn("is_ongoing", false).Error; err != nil {
+					return err
+				}
+			}
+			todo.IsOngoing = ongoing
+			if err := tx.Save(&todo).Error; err != nil {
+				return err
+			}
+			todos = append(todos, &todo)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) ArchiveTodo(ctx context.Context, id string, archived bool) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		previous := todo.IsArchived
+		todo.IsArchived = archived
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil { // Labels are preloaded, so the associations are kept as is
+			return nil, err
+		}
+		todo.UndoToken = r.Undos.issue(&undoAction{userID: userID, todoID: todo.ID, archived: previous})
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) Undo(ctx context.Context, token string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		action, err := r.Undos.take(userID, token)
+		if err != nil {
+			return nil, err
+		}
+		if action.deleted {
+			return r.RestoreTodo(ctx, action.todoID)
+		}
+		todo := Todo{
+			ID:     action.todoID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo.IsArchived = action.archived
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) SetTodoColor(ctx context.Context, id string, color TodoColor) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo.Color = strings.ToLower(color.String()) // Stored as the palette key used by the web client
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) SetTodoBackground(ctx context.Context, id string, background TodoBackground) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo.Background = strings.ToLower(background.String()) // Stored as the name of the scene used by the web client, the color is kept
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) BulkArchiveTodos(ctx context.Context, ids []string, archived bool) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			var err error
+			if todos, err = ownedTodos(tx, userID, ids); err != nil {
+				return err
+			}
+			for _, todo := range todos {
+				todo.IsArchived = archived
+				if err := tx.Save(todo).Error; err != nil { // Save fires the update callback of each todo for the subscribers
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) BulkDeleteTodos(ctx context.Context, ids []string) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			var err error
+			if todos, err = ownedTodos(tx, userID, ids); err != nil {
+				return err
+			}
+			for _, todo := range todos {
+				if err := rowsAffected(tx.Delete(*todo)); err != nil { // Moved to trash, as in deleteTodo
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) BulkSetTodoColor(ctx context.Context, ids []string, color TodoColor) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			var err error
+			if todos, err = ownedTodos(tx, userID, ids); err != nil {
+				return err
+			}
+			for _, todo := range todos {
+				todo.Color = strings.ToLower(color.String())
+				if err := tx.Save(todo).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) SetReminder(ctx context.Context, id string, remindAt time.Time) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		remindAt = remindAt.UTC() // Clients convert it to their timezone
+		todo.RemindAt = &remindAt
+		todo.RemindedAt = nil
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) ClearReminder(ctx context.Context, id string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo.RemindAt = nil
+		todo.RemindedAt = nil
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) CompleteNote(ctx context.Context, id string, completed bool) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		note := Note{ID: id}
+		if err := r.db(ctx).First(&note).Error; err != nil {
+			return nil, notFound(err)
+		}
+		todo := Todo{
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Where("id = ?", note.TodoID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		for _, sibling := range todo.Notes {
+			if sibling.ID == note.ID {
+				sibling.IsCompleted = completed
+			}
+		}
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil { // Subscribers get the todo with its new progress
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) ReorderNote(ctx context.Context, id string, position int) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		return rearrangeNotes(r.db(ctx), userID, id, func(notes []*Note, id string) []*Note {
+			return moveNote(notes, id, position)
+		})
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) IndentNote(ctx context.Context, id string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		return rearrangeNotes(r.db(ctx), userID, id, indentNote)
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) OutdentNote(ctx context.Context, id string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		return rearrangeNotes(r.db(ctx), userID, id, outdentNote)
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) UploadAttachment(ctx context.Context, todoID string, file graphql.Upload) (*Attachment, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{}
+		if err := visibleTodos(r.db(ctx), userID).Where("id = ?", todoID).First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if file.Size > r.MaxAttachmentSize {
+			return nil, errors.New(MsgAttachmentTooLarge)
+		}
+		if err := r.Quota.checkAttachmentBytes(r.db(ctx), todo.UserID, file.Size); err != nil { // The owner stores the attachments of the shared todos
+			return nil, err
+		}
+		content := bufio.NewReader(file.File)
+		contentType := sniffContentType(content)
+		if !allowedAttachmentTypes[contentType] {
+			return nil, errors.New(MsgAttachmentTypeNotAllowed)
+		}
+		key, err := storeAttachment(ctx, r.Blobs, content, file.Size)
+		if err != nil {
+			return nil, err
+		}
+		newAttachmentID, _ := gonanoid.New(IDSize)
+		attachment := Attachment{
+			ID:          newAttachmentID,
+			TodoID:      todo.ID,
+			Filename:    file.Filename,
+			ContentType: contentType,
+			Size:        int(file.Size),
+			Path:        key,
+		}
+		if err := r.db(ctx).Create(&attachment).Error; err != nil {
+			r.Blobs.Delete(ctx, key)
+			return nil, err
+		}
+		return &attachment, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) ImportKeepTakeout(ctx context.Context, file graphql.Upload) (*ImportResult, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		archive, err := openTakeout(file.File, file.Size)
+		if err != nil {
+			return nil, err
+		}
+		var result *ImportResult
+		err = transaction(r.db(ctx), func(tx *gorm.DB) error {
+			result, err = importTakeout(tx, userID, archive, &r.Limits)
+			if err != nil {
+				return err
+			}
+			return r.Quota.checkTodos(tx, userID, 0) // The todos imported are counted already, all or none stay
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) LockTodo(ctx context.Context, id string, passphrase string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		if err := checkPassphrase(passphrase); err != nil {
+			return nil, err
+		}
+		todo := Todo{
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil { // Only the owner locks
+			return nil, notFound(err)
+		}
+		if err := checkUnlocked(&todo); err != nil { // Locked again, it'd be sealed with both passphrases
+			return nil, err
+		}
+		content, err := sealNotes(&todo, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		// The plain notes go along with the history holding them, so that only the sealed ones are stored
+		err = transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := claimVersion(tx, &todo, userID); err != nil {
+				return err
+			}
+			if err := tx.Where("todo_id = ?", todo.ID).Delete(Note{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("todo_id = ?", todo.ID).Delete(TodoRevision{}).Error; err != nil {
+				return err
+			}
+			todo.Notes = []*Note{}
+			todo.IsLocked = true
+			todo.LockedContent = &content
+			return tx.Save(&todo).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) UnlockTodo(ctx context.Context, id string, passphrase string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := visibleTodos(r.db(ctx), userID).Where("id = ?", id).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil { // The collaborators who know the passphrase read it too
+			return nil, notFound(err)
+		}
+		notes, err := openNotes(&todo, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		todo.Notes = notes // Neither stored nor published, the todo stays locked
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) RemoveTodoLock(ctx context.Context, id string, passphrase string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		notes, err := openNotes(&todo, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		todo.Notes = notes // of the IDs before, so that the nesting holds
+		todo.IsLocked = false
+		todo.LockedContent = nil
+		if err := saveClaimed(r.db(ctx), &todo, userID); err != nil { // Saves the notes too, and publishes them to the subscribers
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) ShareTodo(ctx context.Context, id string, email string, permission Permission) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := r.db(ctx).Where("user_id = ?", userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil { // Only the owner shares
+			return nil, notFound(err)
+		}
+		collaborator := User{}
+		if r.db(ctx).Where("LOWER(email) = ?", strings.ToLower(email)).First(&collaborator).RecordNotFound() || collaborator.ID == userID {
+			return nil, errors.New(MsgUserNotFound)
+		}
+		if err := r.db(ctx).Save(&TodoCollaborator{TodoID: todo.ID, UserID: collaborator.ID, Permission: permission}).Error; err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) UnshareTodo(ctx context.Context, id string, email string) (*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{
+			ID:     id,
+			UserID: userID,
+			Labels: []*Label{},
+			Notes:  []*Note{},
+		}
+		if err := r.db(ctx).Where("user_id = ?", userID).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").First(&todo).Error; err != nil {
+			return nil, notFound(err)
+		}
+		collaborator := User{}
+		if r.db(ctx).Where("LOWER(email) = ?", strings.ToLower(email)).First(&collaborator).RecordNotFound() {
+			return nil, errors.New(MsgUserNotFound)
+		}
+		if err := rowsAffected(r.db(ctx).Where("todo_id = ? AND user_id = ?", todo.ID, collaborator.ID).Delete(&TodoCollaborator{})); err != nil { // Not shared with the collaborator
+			return nil, err
+		}
+		return &todo, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) CreateLabel(ctx context.Context, name string) (*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		newLabelID, _ := gonanoid.New(IDSize)
+		label := Label{
+			ID:     newLabelID,
+			Name:   name,
+			Color:  strings.ToLower(LabelColorDefault.String()),
+			UserID: userID,
+		}
+		if labelExists(r.db(ctx), userID, name, "") {
+			return nil, errors.New(MsgLabelExists)
+		}
+		if err := r.db(ctx).Create(&label).Error; err != nil {
+			return nil, err
+		}
+		return &label, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) GetOrCreateLabel(ctx context.Context, name string) (*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		if label, err := findLabelByName(r.db(ctx), userID, name); err == nil {
+			return label, nil
+		} else if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+		newLabelID, _ := gonanoid.New(IDSize)
+		label := Label{
+			ID:     newLabelID,
+			Name:   name,
+			Color:  strings.ToLower(LabelColorDefault.String()),
+			UserID: userID,
+		}
+		if err := r.db(ctx).Create(&label).Error; err != nil {
+			// Another request has just created the label, which the unique index has kept from being duplicated
+			if existing, findErr := findLabelByName(r.db(ctx), userID, name); findErr == nil {
+				return existing, nil
+			}
+			return nil, err
+		}
+		return &label, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) DeleteLabel(ctx context.Context, id string) (*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		label := Label{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).First(&label).Error; err != nil {
+			return nil, notFound(err)
+		}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM todos_labels WHERE label_id = ?", label.ID).Error; err != nil { // The todos are kept, without the label
+				return err
+			}
+			if err := tx.Exec("DELETE FROM todo_templates_labels WHERE label_id = ?", label.ID).Error; err != nil { // So are the templates
+				return err
+			}
+			return rowsAffected(tx.Where("id = ? AND user_id = ?", label.ID, userID).Delete(&Label{}))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &label, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) RenameLabel(ctx context.Context, id string, name string) (*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		label := Label{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).First(&label).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if labelExists(r.db(ctx), userID, name, label.ID) {
+			return nil, errors.New(MsgLabelExists)
+		}
+		label.Name = name
+		if err := r.db(ctx).Save(&label).Error; err != nil {
+			return nil, err
+		}
+		return &label, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) SetLabelColor(ctx context.Context, id string, color LabelColor) (*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		label := Label{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).First(&label).Error; err != nil {
+			return nil, notFound(err)
+		}
+		label.Color = strings.ToLower(color.String()) // Stored as the palette key, same as that of the todos
+		if err := r.db(ctx).Save(&label).Error; err != nil {
+			return nil, err
+		}
+		return &label, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) RegisterWebhook(ctx context.Context, url string, events []WebhookEvent) (*Webhook, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		webhook, err := newWebhook(userID, url, events)
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		if err := r.db(ctx).Model(&Webhook{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count >= maxWebhooks {
+			return nil, newLimitError("webhooks", maxWebhooks)
+		}
+		if err := r.db(ctx).Create(webhook).Error; err != nil {
+			return nil, err
+		}
+		return webhook, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) UnregisterWebhook(ctx context.Context, id string) (*Webhook, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		webhook := Webhook{}
+		if err := r.db(ctx).Where("id = ? AND user_id = ?", id, userID).First(&webhook).Error; err != nil {
+			return nil, notFound(err)
+		}
+		if err := rowsAffected(r.db(ctx).Where("id = ? AND user_id = ?", webhook.ID, userID).Delete(&Webhook{})); err != nil {
+			return nil, err
+		}
+		return &webhook, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
+	if id == ctx.Value(CtxUserIDKey) { // Admins can't delete nor lock themselves, which could leave no admin
+		return false, errors.New(MsgNotAuthorized)
+	}
+	if err := DeleteUser(r.db(ctx), r.Blobs, id); err != nil {
+		return false, notFound(err)
+	}
+	return true, nil
+}
+func (r *mutationResolver) LockUser(ctx context.Context, id string) (*User, error) {
+	if id == ctx.Value(CtxUserIDKey) {
+		return nil, errors.New(MsgNotAuthorized)
+	}
+	user := User{ID: id}
+	if err := r.db(ctx).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	user.Locked = time.Now().Add(adminLockDuration) // The requests of the user are refused from now on
+	if err := r.db(ctx).Save(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+func (r *mutationResolver) UnlockUser(ctx context.Context, id string) (*User, error) {
+	user := User{ID: id}
+	if err := r.db(ctx).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	user.Locked = time.Time{}
+	user.AttemptCount = 0
+	if err := r.db(ctx).Save(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+func (r *mutationResolver) UpdateProfile(ctx context.Context, name *string, email *string) (*User, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		user := &User{ID: userID}
+		if err := r.db(ctx).First(user).Error; err != nil {
+			return nil, err
+		}
+		if name != nil {
+			if errs := r.NameRule.Errors(*name); len(errs) > 0 {
+				return nil, errors.New(MsgInvalidName)
+			}
+			user.Name = *name
+		}
+		emailChanged := email != nil && *email != user.Email
+		if emailChanged {
+			if errs := r.EmailRule.Errors(*email); *email == "" || len(errs) > 0 {
+				return nil, errors.New(MsgInvalidEmail)
+			}
+			// The todos are shared by email, so it can't be of another user. The login stays with the email
+			// registered, which is the user ID
+			if !r.db(ctx).Where("id <> ? AND (LOWER(email) = ? OR canonical_pid = ? OR LOWER(id) = ?)", userID, canonicalPID(*email), canonicalPID(*email), strings.ToLower(url.QueryEscape(*email))).First(&User{}).RecordNotFound() {
+				return nil, errors.New(MsgEmailExists)
+			}
+			user.Email = *email
+		}
+		if err := r.db(ctx).Save(user).Error; err != nil {
+			return nil, err
+		}
+		if emailChanged && r.Auth.IsLoaded("confirm") {
+			// Unconfirmed until the link mailed to the new address is followed
+			if err := (&confirm.Confirm{Authboss: r.Auth}).StartConfirmation(ctx, user, true); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+
+func (r *mutationResolver) ChangePassword(ctx context.Context, current string, new string) (bool, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		user := &User{ID: userID}
+		if err := r.db(ctx).First(user).Error; err != nil {
+			return false, err
+		}
+		// The users signed up with Google have no password, so none matches
+		if user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+			return false, errors.New(MsgWrongPassword)
+		}
+		if errs := r.PasswordRule.Errors(new); len(errs) > 0 {
+			return false, errors.New(MsgInvalidPassword)
+		}
+		// Hashed as authboss does, also revoking the 'remember me' tokens of the other devices
+		if err := r.Auth.UpdatePassword(ctx, user, new); err != nil {
+			return false, err
+		}
+		r.AuditLog.record(ctx, AuthEventTypePasswordChanged, &user.ID, user.Email)
+		return true, nil
+	}
+	return false, errors.New(MsgNotAuthenticated)
+}
+
+func (r *mutationResolver) LogoutAllSessions(ctx context.Context) (bool, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		user := User{ID: userID}
+		if err := r.db(ctx).First(&user).Error; err != nil {
+			return false, err
+		}
+		err := transaction(r.db(ctx), func(tx *gorm.DB) error {
+			if err := tx.Where("pid = ?", user.GetPID()).Delete(RememberToken{}).Error; err != nil {
+				return err
+			}
+			// The sessions of the older epoch, including this one, are rejected from the next request on
+			return tx.Model(&user).UpdateColumn("session_epoch", gorm.Expr("session_epoch + 1")).Error
+		})
+		if err != nil {
+			return false, err
+		}
+		r.AuditLog.record(ctx, AuthEventTypeLogoutAll, &user.ID, user.Email)
+		return true, nil
+	}
+	return false, errors.New(MsgNotAuthenticated)
+}
+func (r *mutationResolver) UpdateUser(ctx context.Context, listMode *bool, darkMode *bool) (*User, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		user := User{
+			ID: userID,
+		}
+		if err := r.db(ctx).First(&user).Error; err != nil {
+			return nil, err
+		}
+		if listMode != nil {
+			user.ListMode = *listMode
+		}
+		if darkMode != nil {
+			user.DarkMode = *darkMode
+		}
+		if err := r.db(ctx).Save(&user).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+
+// orderedNotes preloads the notes of a todo in their position
+func orderedNotes(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// completedNotesLast preloads the notes of a todo in their position, the completed ones at the end
+func completedNotesLast(db *gorm.DB) *gorm.DB {
+	return db.Order("is_completed").Order("position")
+}
+
+// notesOrder is the order of the notes as asked by the filter
+func notesOrder(filter *TodoFilter) func(*gorm.DB) *gorm.DB {
+	if filter != nil && filter.CompletedLast != nil && *filter.CompletedLast {
+		return completedNotesLast
+	}
+	return orderedNotes
+}
+
+// labelExists tells whether the user has another label of the name, as the DB constraint error isn't fit for the client
+func labelExists(db *gorm.DB, userID string, name string, exceptID string) bool {
+	count := 0
+	db.Model(&Label{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, exceptID).Count(&count)
+	return count > 0
+}
+
+// countUnique counts the IDs, leaving out the repeated ones
+func countUnique(ids []string) int {
+	unique := map[string]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return len(unique)
+}
+
+// labelledTodoIDs is the sub-query of the IDs of the todos having all (or any) of the user's labels
+func labelledTodoIDs(db *gorm.DB, userID string, labelIDs []string, all bool) *gorm.SqlExpr {
+	query := db.Table("todos_labels").Joins("JOIN labels ON labels.id = todos_labels.label_id").Where("labels.user_id = ? AND labels.id IN (?)", userID, labelIDs)
+	if all {
+		query = query.Group("todos_labels.todo_id").Having("COUNT(DISTINCT labels.id) = ?", countUnique(labelIDs))
+	}
+	return query.Select("todos_labels.todo_id").QueryExpr()
+}
+
+// filterTodos narrows down the todos query as per the filter, all of whose conditions are met in the one query.
+// Without a filter, only the active todos are listed and with a filter but no 'archived', all the todos are
+// listed. The labels filter by the labels of the user only, so that the todos can't be probed by others' labels
+func filterTodos(query *gorm.DB, userID string, filter *TodoFilter) *gorm.DB {
+	if filter == nil {
+		return query.Where("is_archived = ?", false)
+	}
+	if filter.Archived != nil {
+		query = query.Where("is_archived = ?", *filter.Archived)
+	}
+	if len(filter.LabelIds) > 0 {
+		query = query.Where("id IN (?)", labelledTodoIDs(query.New(), userID, filter.LabelIds, true))
+	}
+	if len(filter.AnyLabelIds) > 0 {
+		query = query.Where("id IN (?)", labelledTodoIDs(query.New(), userID, filter.AnyLabelIds, false))
+	}
+	if filter.SourceDevice != nil {
+		query = query.Where("source_device = ?", strings.ToLower(filter.SourceDevice.String()))
+	}
+	if filter.Search != nil && *filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(*filter.Search)) + "%"
+		notesMatching := query.New().Table("notes").Where("LOWER(text) LIKE ? ESCAPE '!'", pattern).Select("todo_id").QueryExpr()
+		query = query.Where("LOWER(title) LIKE ? ESCAPE '!' OR id IN (?)", pattern, notesMatching)
+	}
+	if len(filter.Colors) > 0 {
+		colors := make([]string, len(filter.Colors))
+		colorless := false
+		for index, color := range filter.Colors {
+			colors[index] = strings.ToLower(color.String())
+			colorless = colorless || color == TodoColorDefault
+		}
+		// The todos created without a color are of the default
+		if colorless {
+			query = query.Where("color IN (?) OR color = ''", colors)
+		} else {
+			query = query.Where("color IN (?)", colors)
+		}
+	}
+	if filter.HasReminder != nil {
+		if *filter.HasReminder {
+			query = query.Where("remind_at IS NOT NULL")
+		} else {
+			query = query.Where("remind_at IS NULL")
+		}
+	}
+	return query
+}
+
+// orderTodos sorts the todos query as per the order, by the order of the user by default
+func orderTodos(query *gorm.DB, orderBy *TodoOrder) *gorm.DB {
+	if orderBy == nil {
+		return query.Order("order_index").Order("id")
+	}
+	switch *orderBy {
+	case TodoOrderCreatedAsc:
+		query = query.Order("created_at")
+	case TodoOrderCreatedDesc:
+		query = query.Order("created_at desc")
+	case TodoOrderUpdatedDesc:
+		query = query.Order("updated_at desc")
+	case TodoOrderTitleAsc:
+		query = query.Order("LOWER(title)")
+	case TodoOrderReminderAsc:
+		query = query.Order("remind_at IS NULL").Order("remind_at") // NULL sorts first in SQLite, but last in Postgres
+	}
+	return query.Order("id")
+}
+
+func (r *mutationResolver) RebuildSearchIndex(ctx context.Context) (bool, error) {
+	if r.SearchIndex == nil {
+		return false, nil // Nothing to rebuild without the full-text index
+	}
+	if err := r.SearchIndex.Rebuild(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type queryResolver struct{ *Resolver }
+
+func (r *queryResolver) Limits(ctx context.Context) (*Limits, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		return &r.Resolver.Limits, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) Stats(ctx context.Context) (*Stats, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		return userStats(r.db(ctx), userID)
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) Templates(ctx context.Context) ([]*TodoTemplate, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		templates := []*TodoTemplate{}
+		if err := r.db(ctx).Where("user_id = ?", userID).Preload("Labels").Order("name").Order("id").Find(&templates).Error; err != nil {
+			return nil, err
+		}
+		return templates, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) AuthEvents(ctx context.Context, userID *string) ([]*AuthEvent, error) {
+	events := []*AuthEvent{}
+	query := r.db(ctx).Order("created_at desc").Limit(authEventsMax)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+func (r *queryResolver) UserUsage(ctx context.Context, id string) (*Usage, error) {
+	if err := r.db(ctx).First(&User{ID: id}).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return userUsage(r.db(ctx), id)
+}
+func (r *queryResolver) Webhooks(ctx context.Context) ([]*Webhook, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		webhooks := []*Webhook{}
+		if err := r.db(ctx).Where("user_id = ?", userID).Order("created_at").Order("id").Find(&webhooks).Error; err != nil {
+			return nil, err
+		}
+		return webhooks, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) AllUsers(ctx context.Context) ([]*User, error) {
+	users := []*User{}
+	if err := r.db(ctx).Order("email").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+func (r *queryResolver) Todos(ctx context.Context, filter *TodoFilter, orderBy *TodoOrder) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		// Pinned todos go first, each group keeps the order of the user unless asked otherwise
+		if err := orderTodos(filterTodos(visibleTodos(r.db(ctx), userID), userID, filter).Order("is_pinned desc"), orderBy).Preload("Notes", notesOrder(filter)).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+
+}
+func (r *queryResolver) TodosConnection(ctx context.Context, first *int, after *string, filter *TodoFilter) (*TodoConnection, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		pageSize := pageSize(first)
+		query := filterTodos(visibleTodos(r.db(ctx), userID), userID, filter)
+		if after != nil {
+			createdAt, id, err := decodeCursor(*after)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", createdAt, createdAt, id)
+		}
+		todos := []*Todo{}
+		// Fetching one extra todo tells whether there's a next page
+		if err := query.Order("created_at").Order("id").Limit(pageSize+1).Preload("Notes", notesOrder(filter)).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+			return nil, err
+		}
+		connection := TodoConnection{
+			Edges:    []*TodoEdge{},
+			PageInfo: &PageInfo{HasNextPage: len(todos) > pageSize},
+		}
+		if len(todos) > pageSize {
+			todos = todos[:pageSize]
+		}
+		for _, todo := range todos {
+			connection.Edges = append(connection.Edges, &TodoEdge{
+				Cursor: encodeCursor(todo),
+				Node:   todo,
+			})
+		}
+		if len(connection.Edges) > 0 {
+			connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+		}
+		return &connection, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) Trash(ctx context.Context) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		if err := r.db(ctx).Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Order("deleted_at desc").Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) Reminders(ctx context.Context) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todos := []*Todo{}
+		if err := r.db(ctx).Where("user_id = ? AND remind_at > ?", userID, time.Now().UTC()).Order("remind_at").Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+			return nil, err
+		}
+		return todos, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) TodoHistory(ctx context.Context, todoID string) ([]*TodoRevision, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		revisions := []*TodoRevision{}
+		if err := r.db(ctx).Where("todo_id IN (?)", visibleTodos(r.db(ctx), userID).Model(&Todo{}).Where("id = ?", todoID).Select("id").QueryExpr()).Order("created_at desc").Find(&revisions).Error; err != nil {
+			return nil, err
+		}
+		return revisions, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) ExportTodo(ctx context.Context, id string, format ExportFormat) (string, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todo := Todo{}
+		if err := visibleTodos(r.db(ctx), userID).Where("id = ?", id).Preload("Notes", orderedNotes).Preload("Labels", func(db *gorm.DB) *gorm.DB {
+			return db.Order("name")
+		}).First(&todo).Error; err != nil {
+			return "", notFound(err)
+		}
+		return todoPlaintext(&todo, format), nil
+	}
+	return "", errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) SearchTodos(ctx context.Context, query string) ([]*Todo, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		ids := []string{}
+		if r.SearchIndex != nil {
+			hits, err := r.SearchIndex.search(userID, query)
+			if err != nil {
+				return nil, err
+			}
+			for _, hit := range hits {
+				ids = append(ids, hit.Todo.ID)
+			}
+		} else {
+			var err error
+			if ids, err = searchTodoIDs(r.db(ctx), userID, query); err != nil {
+				return nil, err
+			}
+		}
+		return loadTodosInOrder(r.db(ctx), ids)
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) SearchHits(ctx context.Context, query string) ([]*SearchHit, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		hits := []*SearchHit{}
+		if r.SearchIndex != nil {
+			var err error
+			if hits, err = r.SearchIndex.search(userID, query); err != nil {
+				return nil, err
+			}
+		} else {
+			ids, err := searchTodoIDs(r.db(ctx), userID, query)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids { // Unranked, in the order of the basic search
+				hits = append(hits, &SearchHit{Todo: &Todo{ID: id}})
+			}
+		}
+		ids := make([]string, len(hits))
+		for index, hit := range hits {
+			ids[index] = hit.Todo.ID
+		}
+		todos, err := loadTodosInOrder(r.db(ctx), ids)
+		if err != nil {
+			return nil, err
+		}
+		todosByID := map[string]*Todo{}
+		for _, todo := range todos {
+			todosByID[todo.ID] = todo
+		}
+		found := make([]*SearchHit, 0, len(hits))
+		for _, hit := range hits {
+			if todo, ok := todosByID[hit.Todo.ID]; ok {
+				hit.Todo = todo
+				found = append(found, hit)
+			}
+		}
+		return found, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) Labels(ctx context.Context) ([]*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		labels := []*Label{}
+		if err := r.db(ctx).Where("user_id = ?", userID).Order("name").Preload("Todos").Find(&labels).Error; err != nil {
+			return nil, err
+		}
+		return labels, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) LabelsConnection(ctx context.Context, first *int, after *string, nameContains *string) (*LabelConnection, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		pageSize := pageSize(first)
+		query := r.db(ctx).Model(&Label{}).Where("user_id = ?", userID)
+		if nameContains != nil && *nameContains != "" {
+			query = query.Where("LOWER(name) LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(strings.ToLower(*nameContains))+"%")
+		}
+		connection := LabelConnection{
+			Edges:    []*LabelEdge{},
+			PageInfo: &PageInfo{},
+		}
+		if err := query.Count(&connection.TotalCount).Error; err != nil {
+			return nil, err
+		}
+		if after != nil {
+			name, id, err := decodeLabelCursor(*after)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Where("name > ? OR (name = ? AND id > ?)", name, name, id)
+		}
+		labels := []*Label{}
+		// Fetching one extra label tells whether there's a next page
+		if err := query.Order("name").Order("id").Limit(pageSize + 1).Find(&labels).Error; err != nil {
+			return nil, err
+		}
+		connection.PageInfo.HasNextPage = len(labels) > pageSize
+		if len(labels) > pageSize {
+			labels = labels[:pageSize]
+		}
+		for _, label := range labels {
+			connection.Edges = append(connection.Edges, &LabelEdge{
+				Cursor: encodeLabelCursor(label),
+				Node:   label,
+			})
+		}
+		if len(connection.Edges) > 0 {
+			connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+		}
+		return &connection, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) SuggestLabels(ctx context.Context, prefix string, limit *int) ([]*Label, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		return suggestLabels(r.db(ctx), userID, prefix, suggestionLimit(limit))
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *queryResolver) User(ctx context.Context) (*User, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		user := User{
+			ID: userID,
+		}
+		if err := r.db(ctx).First(&user).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+
+func (r *queryResolver) Me(ctx context.Context) (*User, error) {
+	// Null for the anonymous sessions, so that the SPA tells them apart without an error
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		user := User{
+			ID: userID,
+		}
+		if err := r.db(ctx).First(&user).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) { // deleted since the login
+				return nil, nil
+			}
+			return nil, err
+		}
+		return &user, nil
+	}
+	return nil, nil
+}
+
+type subscriptionResolver struct{ *Resolver }
+
+func (r *subscriptionResolver) TodoStream(ctx context.Context, since *int) (<-chan *TodoAction, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		todoAction := r.TodoEvents.subscribe(userID, since, ctx.Done())
+		reminders := make(chan *TodoAction, 1)
+		r.Reminders.subscribe(userID, reminders)
+		stream := make(chan *TodoAction, 1)
+		metricSubscriptions.WithLabelValues("todoStream").Inc()
+		go func() { // The reminders aren't changes to replay, so they join once numbered
+			defer func() {
+				metricSubscriptions.WithLabelValues("todoStream").Dec()
+				r.Reminders.unsubscribe(userID, reminders)
+			}()
+			for {
+				var event *TodoAction
+				select {
+				case event = <-todoAction:
+				case event = <-reminders:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case stream <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return stream, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *subscriptionResolver) LabelStream(ctx context.Context) (<-chan *LabelAction, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		labelAction := r.LabelEvents.subscribe(userID, ctx.Done())
+		metricSubscriptions.WithLabelValues("labelStream").Inc()
+		go func() {
+			<-ctx.Done()
+			metricSubscriptions.WithLabelValues("labelStream").Dec()
+		}()
+		return labelAction, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *subscriptionResolver) TodoPresence(ctx context.Context, todoID string) (<-chan *PresenceEvent, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		if err := visibleTodos(r.db(ctx), userID).Where("id = ?", todoID).First(&Todo{}).Error; err != nil {
+			return nil, notFound(err)
+		}
+		user := User{ID: userID}
+		if err := r.db(ctx).First(&user).Error; err != nil {
+			return nil, err
+		}
+		presence := r.Presence.join(todoID, &Viewer{ID: user.ID, Name: user.Name}, ctx.Done()) // Left on closing the websocket too
+		metricSubscriptions.WithLabelValues("todoPresence").Inc()
+		go func() {
+			<-ctx.Done()
+			metricSubscriptions.WithLabelValues("todoPresence").Dec()
+		}()
+		return presence, nil
+	}
+	return nil, errors.New(MsgNotAuthenticated)
+}
+func (r *subscriptionResolver) ReminderDue(ctx context.Context) (<-chan *ReminderEvent, error) {
+	if userID, _ := ctx.Value(CtxUserIDKey).(string); userID != "" {
+		reminders := make(chan *ReminderEvent, 1)
+		r.Reminders.subscribeDue(userID, reminders)
+		metricSubscriptions.WithLabelValues("reminderDue").Inc()
+		go func() {
+			<-ctx.Done()
+			metricSubscriptions.WithLabelValues("reminderDue").Dec()
+			r.Reminders.unsubscribeDue(userID, reminders)
+		}()
+		return reminders, nil
 	}
 	return nil, errors.New(MsgNotAuthenticated)
 }
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+func TestTodoColorsStoredAsPaletteKeys(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "colors@example.com")
+	ctx := userContext(user.ID)
+
+	red := "Red"
+	created, err := resolver.Mutation().CreateTodo(ctx, "Red", []string{}, nil, &red, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	green := "GREEN"
+	if _, err := resolver.Mutation().UpdateTodo(ctx, created.ID, nil, nil, nil, &green, nil, nil); err != nil {
+		t.Fatalf("UpdateTodo() error = %v", err)
+	}
+	saved := Todo{ID: created.ID}
+	db.First(&saved)
+	if saved.Color != "green" {
+		t.Errorf("color = %s, want green", saved.Color)
+	}
+	mauve := "mauve"
+	if _, err := resolver.Mutation().CreateTodo(ctx, "Mauve", []string{}, nil, &mauve, nil, nil, nil); err == nil || err.Error() != MsgInvalidColor {
+		t.Errorf("CreateTodo() of an unknown color error = %v, want %s", err, MsgInvalidColor)
+	}
+
+	todos, err := resolver.Query().Todos(ctx, &TodoFilter{Colors: []TodoColor{TodoColorGreen}}, nil)
+	if err != nil {
+		t.Fatalf("Todos() error = %v", err)
+	}
+	if len(todos) != 1 || todos[0].ID != created.ID {
+		t.Errorf("Todos() of green = %d todos, want the one updated", len(todos))
+	}
+}
+
+// newTestLabel creates a label of the user with the name
+func newTestLabel(t testing.TB, db *gorm.DB, userID string, name string) *Label {
+	t.Helper()
+	id, _ := gonanoid.New(IDSize)
+	label := &Label{ID: id, Name: name, UserID: userID}
+	if err := db.Create(label).Error; err != nil {
+		t.Fatalf("Error while creating label %s -> %s", name, err)
+	}
+	return label
+}
+
+// listedTitles lists the todos of the user by the filter, giving their titles in order
+func listedTitles(t *testing.T, resolver *Resolver, userID string, filter *TodoFilter) string {
+	t.Helper()
+	todos, err := resolver.Query().Todos(userContext(userID), filter, nil)
+	if err != nil {
+		t.Fatalf("Error while listing the todos -> %s", err)
+	}
+	titles := []string{}
+	for _, todo := range todos {
+		titles = append(titles, todo.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestFilterTodosByLabels(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "labels@example.com")
+	other := newTestUser(t, db, "other@example.com")
+	work, home, idle := newTestLabel(t, db, user.ID, "Work"), newTestLabel(t, db, user.ID, "Home"), newTestLabel(t, db, user.ID, "Idle")
+	othersWork := newTestLabel(t, db, other.ID, "Work")
+	labelled := map[string][]*Label{"A": {work}, "B": {work, home}, "C": {home}, "D": {}, "E": {othersWork}}
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		todo := newTestTodo(t, db, user.ID, title)
+		if len(labelled[title]) > 0 {
+			if err := db.Model(todo).Association("Labels").Append(labelled[title]).Error; err != nil {
+				t.Fatalf("Error while labelling %s -> %s", title, err)
+			}
+		}
+	}
+	ids := func(labels ...*Label) []string {
+		ids := []string{}
+		for _, label := range labels {
+			ids = append(ids, label.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name   string
+		filter *TodoFilter
+		want   string
+	}{
+		{"no labels", &TodoFilter{}, "A,B,C,D,E"},
+		{"all of one", &TodoFilter{LabelIds: ids(work)}, "A,B"},
+		{"all of both", &TodoFilter{LabelIds: ids(work, home)}, "B"},
+		{"all of one twice", &TodoFilter{LabelIds: ids(work, work)}, "A,B"},
+		{"all of an unused one", &TodoFilter{LabelIds: ids(work, idle)}, ""},
+		{"any of one", &TodoFilter{AnyLabelIds: ids(home)}, "B,C"},
+		{"any of both", &TodoFilter{AnyLabelIds: ids(work, home)}, "A,B,C"},
+		{"any of an unused one", &TodoFilter{AnyLabelIds: ids(idle, home)}, "B,C"},
+		{"all & any", &TodoFilter{LabelIds: ids(home), AnyLabelIds: ids(work, idle)}, "B"},
+		{"all of the others'", &TodoFilter{LabelIds: ids(othersWork)}, ""},
+		{"any of the others'", &TodoFilter{AnyLabelIds: ids(othersWork, home)}, "B,C"},
+		{"all of unknown", &TodoFilter{LabelIds: []string{"unknown"}}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := listedTitles(t, resolver, user.ID, test.filter); got != test.want {
+				t.Errorf("got todos %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// boardQuery lists the todos of the board along with all they're shown with
+const boardQuery = `query {
+	todos {
+		id title color background isCheckboxMode kind isPinned isOngoing isArchived remindAt isReminderDue progress
+		version orderIndex sourceDevice isLocked createdAt updatedAt deletedAt
+		notes { id text isCompleted }
+		labels { id name }
+		attachments { id filename contentType size }
+	}
+}`
+
+// newTestBoard creates a board of the todos for the user, each with its notes, labels & attachment
+func newTestBoard(tb testing.TB, db *gorm.DB, userID string, size int) {
+	tb.Helper()
+	labels := []*Label{}
+	for index := 0; index < 3; index++ {
+		id, _ := gonanoid.New(IDSize)
+		label := &Label{ID: id, Name: fmt.Sprintf("Label %d", index), UserID: userID}
+		if err := db.Create(label).Error; err != nil {
+			tb.Fatalf("Error while creating label -> %s", err)
+		}
+		labels = append(labels, label)
+	}
+	for index := 0; index < size; index++ {
+		todo := newTestTodo(tb, db, userID, fmt.Sprintf("Todo %d", index))
+		for position := 0; position < 3; position++ {
+			id, _ := gonanoid.New(IDSize)
+			if err := db.Create(&Note{ID: id, TodoID: todo.ID, Text: "Note", Position: position}).Error; err != nil {
+				tb.Fatalf("Error while creating note -> %s", err)
+			}
+		}
+		if err := db.Model(todo).Association("Labels").Append(labels[index%3], labels[(index+1)%3]).Error; err != nil {
+			tb.Fatalf("Error while labelling todo -> %s", err)
+		}
+		id, _ := gonanoid.New(IDSize)
+		if err := db.Create(&Attachment{ID: id, TodoID: todo.ID, Filename: "file.txt", ContentType: "text/plain", Size: 1}).Error; err != nil {
+			tb.Fatalf("Error while creating attachment -> %s", err)
+		}
+	}
+}
+
+// countQueries counts the queries run on the DB, along with those of the contexts of its requests. The callbacks
+// run by the preloading of the many-to-many for each row found run none
+func countQueries(db *gorm.DB) *int64 {
+	count := new(int64)
+	registerCallbacks(db, func(callback *gorm.Callback) {
+		increment := func(scope *gorm.Scope) {
+			if scope.SQL != "" {
+				atomic.AddInt64(count, 1)
+			}
+		}
+		callback.Query().After("gorm:query").Register("test:count_queries", increment)
+		callback.RowQuery().After("gorm:row_query").Register("test:count_queries", increment)
+	})
+	return count
+}
+
+// BenchmarkBoardQueries lists a board of 200 todos, which takes as many queries as that of one, the notes, labels
+// & attachments being preloaded for all the todos at once
+func BenchmarkBoardQueries(b *testing.B) {
+	queriesOf := func(size int) func() int64 {
+		db := newTestDB(b)
+		user := newTestUser(b, db, fmt.Sprintf("board%d@example.com", size))
+		newTestBoard(b, db, user.ID, size)
+		count := countQueries(db)
+		c := newTestClient(newTestResolver(db), db)
+		return func() int64 {
+			response := struct{ Todos []map[string]interface{} }{}
+			start := atomic.LoadInt64(count)
+			c.MustPost(boardQuery, &response, asUser(user.ID))
+			if len(response.Todos) != size {
+				b.Fatalf("got %d todos, want %d", len(response.Todos), size)
+			}
+			return atomic.LoadInt64(count) - start
+		}
+	}
+	listOne, listBoard := queriesOf(1), queriesOf(200)
+	one, board := listOne(), listBoard()
+	if one != board {
+		b.Fatalf("got %d queries for 200 todos, want %d as for 1", board, one)
+	}
+	b.ResetTimer()
+	queries := int64(0)
+	for i := 0; i < b.N; i++ {
+		queries += listBoard()
+	}
+	b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+}
+
+func TestOrderTodos(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "order@example.com")
+	at := func(hours int) time.Time { return time.Date(2021, 4, 13, hours, 0, 0, 0, time.UTC) }
+	remindAt := func(hours int) *time.Time { reminder := at(hours); return &reminder }
+	for _, todo := range []struct {
+		id, title        string
+		created, updated int // hours
+		remindAt         *time.Time
+		pinned           bool
+		orderIndex       float64
+	}{
+		{"c", "Apple", 0, 3, remindAt(1), false, 3},
+		{"a", "banana", 1, 4, remindAt(2), false, 1},
+		{"e", "date", 4, 0, remindAt(3), true, 2},
+		{"b", "apple", 1, 3, nil, false, 4}, // ties with 'a' & 'c', coming after 'a' & before 'c' by the ID
+		{"d", "Cherry", 2, 3, nil, true, 5},
+	} {
+		if err := db.Create(&Todo{ID: todo.id, Title: todo.title, UserID: user.ID, Color: "default", RemindAt: todo.remindAt, IsPinned: todo.pinned, OrderIndex: todo.orderIndex}).Error; err != nil {
+			t.Fatalf("Error while creating todo %s -> %s", todo.title, err)
+		}
+		db.Model(&Todo{}).Where("id = ?", todo.id).UpdateColumns(map[string]interface{}{"created_at": at(todo.created), "updated_at": at(todo.updated)})
+	}
+	order := func(orderBy TodoOrder) *TodoOrder { return &orderBy }
+	tests := []struct {
+		name    string
+		orderBy *TodoOrder
+		want    string // pinned first
+	}{
+		{"of the user", nil, "date,Cherry,banana,Apple,apple"},
+		{"created", order(TodoOrderCreatedAsc), "Cherry,date,Apple,banana,apple"},
+		{"created latest", order(TodoOrderCreatedDesc), "date,Cherry,banana,apple,Apple"},
+		{"updated latest", order(TodoOrderUpdatedDesc), "Cherry,date,banana,apple,Apple"},
+		{"title of any casing", order(TodoOrderTitleAsc), "Cherry,date,apple,Apple,banana"},
+		{"reminder, those without last", order(TodoOrderReminderAsc), "date,Cherry,Apple,banana,apple"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todos, err := resolver.Query().Todos(userContext(user.ID), nil, test.orderBy)
+			if err != nil {
+				t.Fatalf("Error while listing the todos -> %s", err)
+			}
+			titles := []string{}
+			for _, todo := range todos {
+				titles = append(titles, todo.Title)
+			}
+			if got := strings.Join(titles, ","); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+	t.Run("unknown", func(t *testing.T) {
+		response := struct{ Todos []struct{ ID string } }{}
+		err := newTestClient(resolver, db).Post(`{ todos(orderBy: NEWEST) { id } }`, &response, asUser(user.ID))
+		if err == nil || !strings.Contains(err.Error(), "GRAPHQL_VALIDATION_FAILED") {
+			t.Errorf("got %d todos & error %v by an unknown order, want it invalid", len(response.Todos), err)
+		}
+	})
+}
+
+func TestFilterTodos(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "filter@example.com")
+	other := newTestUser(t, db, "other@example.com")
+	work, home := newTestLabel(t, db, user.ID, "Work"), newTestLabel(t, db, user.ID, "Home")
+	remindAt := time.Date(2021, 4, 13, 10, 0, 0, 0, time.UTC)
+	for _, todo := range []struct {
+		title, note, color, device string
+		reminded, archived         bool
+		labels                     []*Label
+	}{
+		{"Groceries", "Milk", "red", "web", true, false, []*Label{work}},
+		{"Milk run", "", "darkblue", "mobile", false, false, []*Label{work, home}},
+		{"Taxes", "The receipts of the milk", "", "web", true, true, []*Label{home}}, // created without a color
+		{"Ideas", "", "red", "web", false, false, nil},
+		{"100% done", "", "default", "tablet", true, false, []*Label{work}},
+		{"Silk", "", "red", "web", true, false, []*Label{work}},
+	} {
+		created := newTestTodo(t, db, user.ID, todo.title)
+		updates := map[string]interface{}{"color": todo.color, "source_device": todo.device, "is_archived": todo.archived}
+		if todo.reminded {
+			updates["remind_at"] = remindAt
+		}
+		db.Model(created).UpdateColumns(updates)
+		if todo.note != "" {
+			db.Create(&Note{ID: created.ID + "-note", TodoID: created.ID, Text: todo.note})
+		}
+		if len(todo.labels) > 0 {
+			db.Model(created).Association("Labels").Append(todo.labels)
+		}
+	}
+	othersTodo := newTestTodo(t, db, other.ID, "Milk of the other")
+	db.Model(othersTodo).UpdateColumn("color", "red")
+
+	search := func(text string) *string { return &text }
+	is := func(value bool) *bool { return &value }
+	device := func(device SourceDevice) *SourceDevice { return &device }
+	tests := []struct {
+		name   string
+		filter *TodoFilter
+		want   string
+	}{
+		{"none", nil, "Groceries,Milk run,Ideas,100% done,Silk"},
+		{"archived", &TodoFilter{Archived: is(true)}, "Taxes"},
+		{"either archived", &TodoFilter{}, "Groceries,Milk run,Taxes,Ideas,100% done,Silk"},
+		{"search of title or note", &TodoFilter{Search: search("MILK")}, "Groceries,Milk run,Taxes"},
+		{"search of the wildcard", &TodoFilter{Search: search("%")}, "100% done"},
+		{"search of the single wildcard", &TodoFilter{Search: search("_ilk")}, ""},
+		{"colors", &TodoFilter{Colors: []TodoColor{TodoColorRed, TodoColorDarkblue}}, "Groceries,Milk run,Ideas,Silk"},
+		{"default color", &TodoFilter{Colors: []TodoColor{TodoColorDefault}}, "Taxes,100% done"},
+		{"reminder", &TodoFilter{HasReminder: is(true)}, "Groceries,Taxes,100% done,Silk"},
+		{"no reminder", &TodoFilter{HasReminder: is(false)}, "Milk run,Ideas"},
+		{"device", &TodoFilter{SourceDevice: device(SourceDeviceWeb)}, "Groceries,Taxes,Ideas,Silk"},
+		{"search & color", &TodoFilter{Search: search("milk"), Colors: []TodoColor{TodoColorRed}}, "Groceries"},
+		{"search of either & reminder", &TodoFilter{Search: search("milk"), HasReminder: is(false)}, "Milk run"},
+		{"search & archived", &TodoFilter{Search: search("milk"), Archived: is(false)}, "Groceries,Milk run"},
+		{"search & labels", &TodoFilter{Search: search("milk"), LabelIds: []string{home.ID}}, "Milk run,Taxes"},
+		{"color & any labels", &TodoFilter{Colors: []TodoColor{TodoColorRed}, AnyLabelIds: []string{work.ID, home.ID}}, "Groceries,Silk"},
+		{"color, reminder & labels", &TodoFilter{Colors: []TodoColor{TodoColorRed, TodoColorDefault}, HasReminder: is(true), LabelIds: []string{work.ID}, Archived: is(false)}, "Groceries,100% done,Silk"},
+		{"all", &TodoFilter{Search: search("ilk"), Colors: []TodoColor{TodoColorRed}, HasReminder: is(true), LabelIds: []string{work.ID}, SourceDevice: device(SourceDeviceWeb), Archived: is(false)}, "Groceries,Silk"},
+		{"all, matching none", &TodoFilter{Search: search("milk"), Colors: []TodoColor{TodoColorDarkblue}, HasReminder: is(true)}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := listedTitles(t, resolver, user.ID, test.filter); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// marshalNotes is the content of the notes as JSON, keeping the text, the completion & the indent of each
+func marshalNotes(notes []*Note) (string, error) {
+	inputs := make([]*NotesInput, len(notes))
+	for index, note := range notes {
+		indented := note.ParentID != nil
+		inputs[index] = &NotesInput{
+			Text:        note.Text,
+			IsCompleted: note.IsCompleted,
+			IsIndented:  &indented,
+		}
+	}
+	content, err := json.Marshal(inputs)
+	return string(content), err
+}
+
+// unmarshalNotes gives back the notes of the content, whose IDs are made of the ID of what keeps them
+func unmarshalNotes(content string, id string, todoID string) []*Note {
+	inputs := []*NotesInput{}
+	json.Unmarshal([]byte(content), &inputs)
+	notes := make([]*Note, len(inputs))
+	for index, input := range inputs {
+		notes[index] = &Note{
+			ID:          fmt.Sprintf("%s-%d", id, index),
+			TodoID:      todoID,
+			Text:        input.Text,
+			IsCompleted: input.IsCompleted,
+			Position:    index,
+		}
+	}
+	nestNotes(notes, isIndented(inputs))
+	return notes
+}
+
+// newTodoRevision snapshots the title & the notes of the todo, before the editor changes them
+func newTodoRevision(todo *Todo, editorID string) (*TodoRevision, error) {
+	content, err := marshalNotes(todo.Notes)
+	if err != nil {
+		return nil, err
+	}
+	revisionID, _ := gonanoid.New(IDSize)
+	return &TodoRevision{
+		ID:        revisionID,
+		TodoID:    todo.ID,
+		Title:     todo.Title,
+		Content:   content,
+		EditorID:  editorID,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// saveRevision stores the revision and drops the oldest ones of the todo beyond the limit
+func saveRevision(tx *gorm.DB, revision *TodoRevision, limit int) error {
+	if err := tx.Create(revision).Error; err != nil {
+		return err
+	}
+	revisionIDs := []string{}
+	if err := tx.Model(&TodoRevision{}).Where("todo_id = ?", revision.TodoID).Order("created_at desc").Pluck("id", &revisionIDs).Error; err != nil {
+		return err
+	}
+	if len(revisionIDs) <= limit {
+		return nil
+	}
+	return tx.Where("id IN (?)", revisionIDs[limit:]).Delete(&TodoRevision{}).Error
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// MsgInvalidTime is the constant for Invalid Time message
+const MsgInvalidTime string = "InvalidTime"
+
+// MarshalTime marshals the 'Time' scalar as RFC3339 in UTC, along with the fractional seconds if any, so that
+// the times read the same whatever the timezone of the server
+func MarshalTime(t time.Time) graphql.Marshaler {
+	if t.IsZero() {
+		return graphql.Null
+	}
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(t.UTC().Format(time.RFC3339Nano)))
+	})
+}
+
+// UnmarshalTime parses the 'Time' scalar from RFC3339, with an offset or 'Z' and optionally the fractional
+// seconds, into UTC. Anything else is rejected, rather than taken as of some timezone
+func UnmarshalTime(v interface{}) (time.Time, error) {
+	if value, ok := v.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New(MsgInvalidTime)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+)
+
+func TestTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"UTC", "2021-04-13T10:20:30Z", `"2021-04-13T10:20:30Z"`},
+		{"milliseconds", "2021-04-13T10:20:30.123Z", `"2021-04-13T10:20:30.123Z"`},
+		{"nanoseconds", "2021-04-13T10:20:30.123456789Z", `"2021-04-13T10:20:30.123456789Z"`},
+		{"trailing zeros", "2021-04-13T10:20:30.500000Z", `"2021-04-13T10:20:30.5Z"`},
+		{"zero fraction", "2021-04-13T10:20:30.000Z", `"2021-04-13T10:20:30Z"`},
+		{"positive offset", "2021-04-13T15:50:30+05:30", `"2021-04-13T10:20:30Z"`},
+		{"negative offset", "2021-04-13T03:20:30.25-07:00", `"2021-04-13T10:20:30.25Z"`},
+		{"offset over the day", "2021-04-14T01:20:30+15:00", `"2021-04-13T10:20:30Z"`},
+		{"zero offset", "2021-04-13T10:20:30+00:00", `"2021-04-13T10:20:30Z"`},
+		{"leap day", "2020-02-29T23:30:00-01:00", `"2020-03-01T00:30:00Z"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := UnmarshalTime(test.value)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if parsed.Location() != time.UTC {
+				t.Errorf("got time in %s, want UTC", parsed.Location())
+			}
+			marshalled := &bytes.Buffer{}
+			MarshalTime(parsed).MarshalGQL(marshalled)
+			if marshalled.String() != test.want {
+				t.Errorf("got %s, want %s", marshalled, test.want)
+			}
+			again, err := UnmarshalTime(parsed.Format(time.RFC3339Nano))
+			if err != nil || !again.Equal(parsed) {
+				t.Errorf("got %s & error %v parsed again, want %s", again, err, parsed)
+			}
+		})
+	}
+}
+
+func TestMarshalTimeZero(t *testing.T) {
+	marshalled := &bytes.Buffer{}
+	MarshalTime(time.Time{}).MarshalGQL(marshalled)
+	if marshalled.String() != "null" {
+		t.Errorf("got %s, want null", marshalled)
+	}
+}
+
+func TestUnmarshalTimeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"empty", ""},
+		{"date only", "2021-04-13"},
+		{"no offset", "2021-04-13T10:20:30"},
+		{"space separated", "2021-04-13 10:20:30Z"},
+		{"offset without colon", "2021-04-13T10:20:30+0530"},
+		{"zone name", "2021-04-13T10:20:30 IST"},
+		{"month out of range", "2021-13-13T10:20:30Z"},
+		{"hour out of range", "2021-04-13T24:20:30Z"},
+		{"not a leap day", "2021-02-29T10:20:30Z"},
+		{"fraction without digits", "2021-04-13T10:20:30.Z"},
+		{"RFC1123", "Tue, 13 Apr 2021 10:20:30 GMT"},
+		{"unix seconds", 1618309230},
+		{"unix seconds as string", "1618309230"},
+		{"null", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if parsed, err := UnmarshalTime(test.value); err == nil || err.Error() != MsgInvalidTime {
+				t.Errorf("got %s & error %v, want %s", parsed, err, MsgInvalidTime)
+			}
+		})
+	}
+}
+
+// TestSetReminderTime sets the reminder at the time of an offset, which is told back in UTC
+func TestSetReminderTime(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "time@example.com")
+	todo := newTestTodo(t, db, user.ID, "Todo")
+	c := newTestClient(newTestResolver(db), db)
+	tests := []struct {
+		name      string
+		remindAt  string
+		want      string
+		wantError string // empty when set
+	}{
+		{"offset & fraction", "2021-04-13T15:50:30.125+05:30", "2021-04-13T10:20:30.125Z", ""},
+		{"UTC", "2021-04-13T10:20:30Z", "2021-04-13T10:20:30Z", ""},
+		{"malformed", "13/04/2021 10:20", "", MsgInvalidTime},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := struct {
+				SetReminder struct{ RemindAt string }
+			}{}
+			err := c.Post(`mutation($id: ID!, $remindAt: Time!) { setReminder(id: $id, remindAt: $remindAt) { remindAt } }`, &response,
+				asUser(user.ID), client.Var("id", todo.ID), client.Var("remindAt", test.remindAt))
+			if test.wantError != "" {
+				errs := []struct{ Message string }{}
+				if err == nil {
+					t.Fatalf("got reminder at %s, want error %s", response.SetReminder.RemindAt, test.wantError)
+				}
+				if jsonErr, ok := err.(client.RawJsonError); !ok || json.Unmarshal(jsonErr.RawMessage, &errs) != nil || len(errs) == 0 || errs[0].Message != test.wantError {
+					t.Errorf("got error %s, want %s", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if response.SetReminder.RemindAt != test.want {
+				t.Errorf("got reminder at %s, want %s", response.SetReminder.RemindAt, test.want)
+			}
+			stored := Todo{}
+			db.Where("id = ?", todo.ID).First(&stored)
+			if want, _ := time.Parse(time.RFC3339Nano, test.want); stored.RemindAt == nil || !stored.RemindAt.Equal(want) {
+				t.Errorf("got reminder stored at %v, want %s", stored.RemindAt, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// likeEscaper escapes the wildcards of LIKE patterns. '!' is used as the escape character,
+// as backslash is treated differently in MySQL string literals
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// searchTodoIDs returns the IDs of the user's todos (excluding trashed ones) whose title or
+// notes contain the query case-insensitively. Title matches are ranked above notes matches,
+// and within the same rank the todos keep their creation order
+func searchTodoIDs(db *gorm.DB, userID string, query string) ([]string, error) {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(query)) + "%"
+	rows, err := db.Table("todos").
+		Select("todos.id, MAX(CASE WHEN LOWER(todos.title) LIKE ? ESCAPE '!' THEN 1 ELSE 0 END) AS title_match", pattern).
+		Joins("LEFT JOIN notes ON notes.todo_id = todos.id").
+		Where("todos.user_id = ? AND todos.deleted_at IS NULL", userID).
+		Where("LOWER(todos.title) LIKE ? ESCAPE '!' OR LOWER(notes.text) LIKE ? ESCAPE '!'", pattern, pattern).
+		Group("todos.id").
+		Order("title_match desc").Order("MIN(todos.created_at)").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		var titleMatch int
+		if err := rows.Scan(&id, &titleMatch); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// loadTodosInOrder loads the todos with the IDs along with their notes, labels & attachments, keeping the
+// order of the IDs
+func loadTodosInOrder(db *gorm.DB, ids []string) ([]*Todo, error) {
+	todosByID := map[string]*Todo{}
+	if len(ids) > 0 {
+		todos := []*Todo{}
+		if err := db.Where("id in (?)", ids).Preload("Notes", orderedNotes).Preload("Labels").Preload("Attachments").Find(&todos).Error; err != nil {
+			return nil, err
+		}
+		for _, todo := range todos {
+			todosByID[todo.ID] = todo
+		}
+	}
+	todos := make([]*Todo, 0, len(ids))
+	for _, id := range ids {
+		if todo, ok := todosByID[id]; ok {
+			todos = append(todos, todo)
+		}
+	}
+	return todos, nil
+}
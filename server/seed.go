@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// seedTodo is a todo of the demo board, its notes are checkboxes when it's a list
+type seedTodo struct {
+	title  string
+	notes  []string
+	done   int // the first notes completed
+	isList bool
+	color  TodoColor
+	pinned bool
+	labels []string
+}
+
+// seedLabels & seedTodos make up the demo board
+var (
+	seedLabels = []string{"Home", "Work", "Ideas", "Travel"}
+	seedTodos  = []seedTodo{
+		{title: "Welcome to Keep Clone", notes: []string{"This board is demo data, seeded for development only.\nFeel free to edit, pin, archive or delete anything."}, color: TodoColorYellow, pinned: true},
+		{title: "Groceries", notes: []string{"Milk", "Eggs", "Bread", "Coffee beans", "Apples"}, done: 2, isList: true, color: TodoColorGreen, pinned: true, labels: []string{"Home"}},
+		{title: "Sprint tasks", notes: []string{"Review the open pull requests", "Write the release notes", "Update the dependencies"}, done: 1, isList: true, color: TodoColorLightblue, labels: []string{"Work"}},
+		{title: "Meeting notes", notes: []string{"Agreed to ship the sharing feature next week. Follow up with design on the mobile layout."}, labels: []string{"Work"}},
+		{title: "App ideas", notes: []string{"A recipe box that plans the week's groceries", "A reading list synced from the library"}, color: TodoColorPurple, labels: []string{"Ideas"}},
+		{title: "Packing list", notes: []string{"Passport", "Charger", "Sunscreen", "Hiking boots"}, isList: true, color: TodoColorOrange, labels: []string{"Travel"}},
+		{title: "Home repairs", notes: []string{"Fix the dripping tap", "Paint the fence", "Replace the hallway bulb"}, done: 1, isList: true, labels: []string{"Home"}},
+		{title: "Quote", notes: []string{"Simplicity is the ultimate sophistication."}, color: TodoColorGrey},
+	}
+)
+
+// Seed creates a demo user along with a board of labels & todos, for development only. The user signs in with
+// the email & the password. Nothing is created when the user exists already, so that seeding again is harmless
+func Seed(db *gorm.DB, email string, name string, password string) (bool, error) {
+	userID := url.QueryEscape(email) // as the users registered with an email
+	if err := db.First(&User{ID: userID}).Error; err == nil {
+		return false, nil
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+	err = transaction(db, func(tx *gorm.DB) error {
+		user := User{ID: userID, Name: name, Email: email, Password: string(hash), Confirmed: true}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		labels := map[string]*Label{}
+		for _, name := range seedLabels {
+			id, _ := gonanoid.New(IDSize)
+			label := &Label{ID: id, Name: name, Color: strings.ToLower(LabelColorDefault.String()), UserID: userID}
+			if err := tx.Create(label).Error; err != nil {
+				return err
+			}
+			labels[name] = label
+		}
+		for _, seed := range seedTodos {
+			id, _ := gonanoid.New(IDSize)
+			todo := &Todo{
+				ID:             id,
+				Title:          seed.title,
+				Notes:          []*Note{},
+				Labels:         []*Label{},
+				Color:          strings.ToLower(TodoColorDefault.String()),
+				IsCheckboxMode: seed.isList,
+				IsPinned:       seed.pinned,
+				UserID:         userID,
+			}
+			if seed.color != "" {
+				todo.Color = strings.ToLower(seed.color.String())
+			}
+			for position, text := range seed.notes {
+				noteID, _ := gonanoid.New(IDSize)
+				todo.Notes = append(todo.Notes, &Note{ID: noteID, Text: text, IsCompleted: position < seed.done, Position: position})
+			}
+			for _, name := range seed.labels {
+				todo.Labels = append(todo.Labels, labels[name])
+			}
+			if err := tx.Create(todo).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
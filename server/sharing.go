@@ -0,0 +1,39 @@
+package server
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// TodoCollaborator shares a todo of its owner with another user
+type TodoCollaborator struct {
+	TodoID     string `gorm:"primary_key" sql:"type:VARCHAR(255) REFERENCES todos(id) ON DELETE CASCADE"`
+	UserID     string `gorm:"primary_key" sql:"type:VARCHAR(255) REFERENCES users(id) ON DELETE CASCADE"`
+	Permission Permission
+}
+
+// sharedTodoIDs is the sub-query of the IDs of the todos shared with the user
+func sharedTodoIDs(db *gorm.DB, userID string) *gorm.SqlExpr {
+	return db.Model(&TodoCollaborator{}).Where("user_id = ?", userID).Select("todo_id").QueryExpr()
+}
+
+// visibleTodos scopes the query to the todos owned by or shared with the user
+func visibleTodos(db *gorm.DB, userID string) *gorm.DB {
+	return db.Where("user_id = ? OR id IN (?)", userID, sharedTodoIDs(db, userID))
+}
+
+// canWriteTodo tells whether the user owns the todo or collaborates on it with write permission
+func canWriteTodo(db *gorm.DB, todo *Todo, userID string) bool {
+	if todo.UserID == userID {
+		return true
+	}
+	count := 0
+	db.Model(&TodoCollaborator{}).Where("todo_id = ? AND user_id = ? AND permission = ?", todo.ID, userID, PermissionWrite).Count(&count)
+	return count > 0
+}
+
+// isTodoCollaborator tells whether the todo is shared with the user
+func isTodoCollaborator(db *gorm.DB, todoID string, userID string) bool {
+	count := 0
+	db.Model(&TodoCollaborator{}).Where("todo_id = ? AND user_id = ?", todoID, userID).Count(&count)
+	return count > 0
+}
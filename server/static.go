@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// assetPrefixes are the paths of the built assets of the SPA, which are never served the index in place
+var assetPrefixes = []string{"/static/", "/dist/", "/_snowpack/"}
+
+// hashedAsset matches the file names carrying a content hash, like 'main.3f2a9c1b.js', which never change
+var hashedAsset = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[a-zA-Z0-9]+$`)
+
+// NewStaticHandler serves the SPA from the directory. The paths without a file are the routes of the SPA, and
+// get 'index.html', except those of the assets, which get a 404. The hashed assets are cached for long, the rest
+// is revalidated on every use
+func NewStaticHandler(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		file := filepath.Join(dir, filepath.FromSlash(urlPath))
+		if info, err := os.Stat(file); err == nil && !info.IsDir() && urlPath != "/index.html" {
+			if hashedAsset.MatchString(urlPath) {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			} else {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			http.ServeFile(w, r, file)
+			return
+		}
+		if urlPath != "/index.html" && isAssetPath(urlPath) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(w, r, filepath.Join(dir, "index.html"))
+	}
+}
+
+// isAssetPath tells whether the path is meant for a file rather than a route of the SPA
+func isAssetPath(urlPath string) bool {
+	for _, prefix := range assetPrefixes {
+		if strings.HasPrefix(urlPath, prefix) {
+			return true
+		}
+	}
+	return path.Ext(urlPath) != ""
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// userStats sums up the todos the user owns, excluding the trashed ones. Each count is aggregated by the DB, so
+// that no todo, note or label is loaded but those of the breakdown
+func userStats(db *gorm.DB, userID string) (*Stats, error) {
+	stats := &Stats{Labels: []*LabelStats{}}
+	todos := struct {
+		Todos        int
+		Archived     int
+		WithReminder int
+	}{}
+	err := db.Table("todos").
+		Select("COUNT(*) AS todos, COALESCE(SUM(CASE WHEN is_archived THEN 1 ELSE 0 END), 0) AS archived, COUNT(remind_at) AS with_reminder").
+		Where("user_id = ? AND deleted_at IS NULL", userID).Scan(&todos).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Todos, stats.Archived, stats.WithReminder = todos.Todos, todos.Archived, todos.WithReminder
+
+	// Only the notes of the checklists are ticked, those of the plain todos are neither completed nor pending
+	notes := struct {
+		Completed int
+		Pending   int
+	}{}
+	err = db.Table("notes").
+		Select("COALESCE(SUM(CASE WHEN notes.is_completed THEN 1 ELSE 0 END), 0) AS completed, COALESCE(SUM(CASE WHEN notes.is_completed THEN 0 ELSE 1 END), 0) AS pending").
+		Joins("JOIN todos ON todos.id = notes.todo_id").
+		Where("todos.user_id = ? AND todos.deleted_at IS NULL AND todos.is_checkbox_mode", userID).Scan(&notes).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.CompletedNotes, stats.PendingNotes = notes.Completed, notes.Pending
+
+	labels := []struct {
+		Label
+		TodoCount int
+	}{}
+	err = db.Table("labels").Select("labels.*, COUNT(todos.id) AS todo_count").
+		Joins("LEFT JOIN todos_labels ON todos_labels.label_id = labels.id").
+		Joins("LEFT JOIN todos ON todos.id = todos_labels.todo_id AND todos.deleted_at IS NULL").
+		Where("labels.user_id = ?", userID).
+		Group("labels.id").Order("todo_count desc").Order("labels.name").
+		Scan(&labels).Error
+	if err != nil {
+		return nil, err
+	}
+	for index := range labels {
+		stats.Labels = append(stats.Labels, &LabelStats{Label: &labels[index].Label, Todos: labels[index].TodoCount})
+	}
+	return stats, nil
+}
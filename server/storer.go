@@ -2,24 +2,109 @@ package server
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
+	"github.com/gorilla/sessions"
 	"github.com/jinzhu/gorm"
 	abclientstate "github.com/volatiletech/authboss-clientstate"
 	"github.com/volatiletech/authboss/v3"
+	aboauth2 "github.com/volatiletech/authboss/v3/oauth2"
 )
 
 /////////////////////////////////////////////////////////////////
 // ServerStorer
 
-type SQLiteStorer struct {
+// RememberToken holds a hashed 'remember me' token of a user
+type RememberToken struct {
+	ID    uint   `gorm:"primary_key"`
+	PID   string `gorm:"column:pid;index"`
+	Token string
+}
+
+// canonicalPID is the PID (email) as compared, so that the emails differing only in the casing are of the same
+// user. The casing registered is kept for the display
+func canonicalPID(pid string) string {
+	return strings.ToLower(pid)
+}
+
+// BeforeCreate keeps the canonical PID of the new user, unique so that no other registers it in another casing
+func (u *User) BeforeCreate() error {
+	if u.CanonicalPID == nil {
+		pid := canonicalPID(u.GetPID())
+		u.CanonicalPID = &pid
+	}
+	return nil
+}
+
+// CanonicalizePIDs gives the users registered before the canonical PIDs existed theirs. Those whose PIDs differ only
+// in the casing are left without, logging in with the casing registered, and are told as the conflicts by their IDs
+// for an admin to resolve
+func CanonicalizePIDs(db *gorm.DB) ([][]string, error) {
+	count := 0
+	if err := db.Model(&User{}).Where("canonical_pid IS NULL").Count(&count).Error; err != nil || count == 0 {
+		return nil, err
+	}
+	users := []*User{}
+	if err := db.Select("id, canonical_pid").Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byPID := map[string][]*User{}
+	pids := []string{}
+	for _, user := range users {
+		pid := canonicalPID(user.GetPID())
+		if byPID[pid] == nil {
+			pids = append(pids, pid)
+		}
+		byPID[pid] = append(byPID[pid], user)
+	}
+	conflicts := [][]string{}
+	for _, pid := range pids {
+		if len(byPID[pid]) > 1 {
+			userIDs := []string{}
+			for _, user := range byPID[pid] {
+				userIDs = append(userIDs, user.ID)
+			}
+			conflicts = append(conflicts, userIDs)
+			continue
+		}
+		if user := byPID[pid][0]; user.CanonicalPID == nil {
+			if err := db.Model(user).UpdateColumn("canonical_pid", pid).Error; err != nil {
+				return conflicts, err
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// DBStorer stores the users in any of the database supported by GORM
+type DBStorer struct {
 	authboss.CreatingServerStorer
-	DB *gorm.DB
+	authboss.OAuth2ServerStorer
+	authboss.ConfirmingServerStorer
+	authboss.RecoveringServerStorer
+	authboss.RememberingServerStorer
+	DB        *gorm.DB
+	Templates []TemplateSeed // seeded for each user signing up
 }
 
-func (s SQLiteStorer) Load(ctx context.Context, key string) (authboss.User, error) {
-	user := User{
-		ID: url.QueryEscape(key), // Encode the email to userID
+func (s DBStorer) Load(ctx context.Context, key string) (authboss.User, error) {
+	if provider, uid, err := authboss.ParseOAuth2PID(key); err == nil { // OAuth2 logins have the provider's PID in session
+		user := User{}
+		if err := s.DB.Where("oauth2_provider = ? AND oauth2_uid = ?", provider, uid).First(&user).Error; err != nil {
+			return &user, authboss.ErrUserNotFound
+		}
+		return &user, nil
+	}
+	user := User{}
+	if err := s.DB.Where("canonical_pid = ?", canonicalPID(key)).First(&user).Error; err == nil {
+		return &user, nil
+	}
+	user = User{
+		ID: url.QueryEscape(key), // Encode the email to userID. Those without the canonical PID log in as registered
 	}
 	if err := s.DB.First(&user).Error; err != nil {
 		return &user, authboss.ErrUserNotFound
@@ -27,45 +112,196 @@ func (s SQLiteStorer) Load(ctx context.Context, key string) (authboss.User, erro
 	return &user, nil
 }
 
-func (s SQLiteStorer) Save(ctx context.Context, user authboss.User) error {
-	user = user.(*User)
-	err := s.DB.Save(&user).Error
+func (s DBStorer) Save(ctx context.Context, user authboss.User) error {
+	existingUser := user.(*User)
+	err := s.DB.Save(existingUser).Error
 	return err
 }
 
-func (s SQLiteStorer) New(ctx context.Context) authboss.User {
+func (s DBStorer) New(ctx context.Context) authboss.User {
 	return &User{
 		ListMode: false,
 		DarkMode: false,
 	}
 }
 
-func (s SQLiteStorer) Create(ctx context.Context, user authboss.User) error {
+func (s DBStorer) Create(ctx context.Context, user authboss.User) error {
 	existingUser := user.(*User)
-	existingUser.ID = url.QueryEscape(existingUser.ID)
-	if err := s.DB.First(&existingUser).Error; err == nil {
+	pid := existingUser.ID
+	existingUser.ID = url.QueryEscape(pid)
+	// The users without the canonical PID are told by their IDs, which are the PIDs encoded in the casing registered
+	if err := s.DB.Where("canonical_pid = ? OR LOWER(id) = ?", canonicalPID(pid), strings.ToLower(existingUser.ID)).First(&User{}).Error; err == nil {
 		return authboss.ErrUserFound
 	}
-	err := s.DB.Create(&existingUser).Error
-	return err
+	return transaction(s.DB, func(tx *gorm.DB) error {
+		if err := tx.Create(&existingUser).Error; err != nil {
+			return err
+		}
+		return seedTemplates(tx, existingUser.ID, s.Templates)
+	})
+}
+
+func (s DBStorer) LoadByConfirmSelector(ctx context.Context, selector string) (authboss.ConfirmableUser, error) {
+	user := User{}
+	if err := s.DB.Where("confirm_selector = ?", selector).First(&user).Error; err != nil {
+		return &user, authboss.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s DBStorer) LoadByRecoverSelector(ctx context.Context, selector string) (authboss.RecoverableUser, error) {
+	user := User{}
+	if err := s.DB.Where("recover_selector = ?", selector).First(&user).Error; err != nil {
+		return &user, authboss.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s DBStorer) AddRememberToken(ctx context.Context, pid string, token string) error {
+	return s.DB.Create(&RememberToken{PID: pid, Token: token}).Error
+}
+
+func (s DBStorer) DelRememberTokens(ctx context.Context, pid string) error {
+	return s.DB.Where("pid = ?", pid).Delete(RememberToken{}).Error
+}
+
+func (s DBStorer) UseRememberToken(ctx context.Context, pid string, token string) error {
+	result := s.DB.Where("pid = ? AND token = ?", pid, token).Delete(RememberToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return authboss.ErrTokenNotFound
+	}
+	return nil
+}
+
+func (s DBStorer) NewFromOAuth2(ctx context.Context, provider string, details map[string]string) (authboss.OAuth2User, error) {
+	uid, email := details[aboauth2.OAuth2UID], details[aboauth2.OAuth2Email]
+	if uid == "" || email == "" {
+		return nil, errors.New("oauth2 provider didn't return the uid and email")
+	}
+	user := User{}
+	if err := s.DB.Where("oauth2_provider = ? AND oauth2_uid = ?", provider, uid).First(&user).Error; err == nil {
+		return &user, nil
+	}
+	// The email is taken only if the provider has verified it, as anyone could sign up there with the email of
+	// another here. The users linked before sign in as ever
+	if details[OAuth2EmailVerified] != "true" {
+		return nil, errors.New("oauth2 provider didn't verify the email, so the user has to register or login with the password")
+	}
+	// An existing user with the same email (even registered with password) gets linked, instead of creating a new one
+	user = User{}
+	if err := s.DB.Where("canonical_pid = ?", canonicalPID(email)).First(&user).Error; err != nil {
+		user = User{
+			ID:       url.QueryEscape(email),
+			Name:     details[aboauth2.OAuth2Name],
+			Email:    email,
+			ListMode: false,
+			DarkMode: false,
+		}
+	}
+	user.OAuth2UID = uid
+	user.Confirmed = true // The provider has verified the email already
+	return &user, nil
+}
+
+func (s DBStorer) SaveOAuth2(ctx context.Context, user authboss.OAuth2User) error {
+	existingUser := user.(*User)
+	return transaction(s.DB, func(tx *gorm.DB) error {
+		err := tx.First(&User{ID: existingUser.ID}).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		if err := tx.Save(existingUser).Error; err != nil { // Creates the user when not existing yet
+			return err
+		}
+		if err == nil { // Signed in before, or linked to the user registered with the email
+			return nil
+		}
+		return seedTemplates(tx, existingUser.ID, s.Templates)
+	})
 }
 
 ////////////////////////////////////////////////////////////
 // Factory Methods
 
-func NewSQLiteStorer(db *gorm.DB) *SQLiteStorer {
-	return &SQLiteStorer{
-		DB: db,
+func NewDBStorer(db *gorm.DB, templates []TemplateSeed) *DBStorer {
+	return &DBStorer{
+		DB:        db,
+		Templates: templates,
 	}
 }
 
-func NewCookieStorer(cookieStoreKey []byte, isSecure bool) abclientstate.CookieStorer {
+// NewCookieStorer creates the storer of the 'remember me' cookie, lasting for maxAge unless another duration to
+// keep signed in was chosen at login
+func NewCookieStorer(cookieStoreKey []byte, isSecure bool, maxAge time.Duration, sameSite http.SameSite) CookieStorer {
 	newCookieStore := abclientstate.NewCookieStorer(cookieStoreKey, nil)
+	newCookieStore.Cookies = []string{authboss.CookieRemember, CookieKeepSignedIn}
 	newCookieStore.HTTPOnly = isSecure
 	newCookieStore.Secure = isSecure
-	return newCookieStore
+	newCookieStore.MaxAge = int(maxAge / time.Second)
+	newCookieStore.SameSite = sameSite
+	return CookieStorer{newCookieStore}
+}
+
+// NewSessionStorer creates the storer of the session cookie, lasting for maxAge. The session-only logins get a
+// cookie of the browser session instead
+func NewSessionStorer(cookieName string, sessionStoreKey []byte, maxAge time.Duration, sameSite http.SameSite) abclientstate.SessionStorer {
+	cookieStore := sessions.NewCookieStore(sessionStoreKey, nil)
+	cookieStore.MaxAge(int(maxAge / time.Second)) // also expires the session value itself, not only the cookie
+	cookieStore.Options.HttpOnly = true
+	cookieStore.Options.Secure = true
+	cookieStore.Options.SameSite = sameSite
+	return abclientstate.NewSessionStorerFromExisting(cookieName, sessionStore{cookieStore})
+}
+
+// CookieStorer writes the 'remember me' cookie to expire after the duration to keep signed in, which is kept
+// in a cookie of its own alongside, so that the tokens rotated on the next visits last as long
+type CookieStorer struct {
+	abclientstate.CookieStorer
+}
+
+// WriteState writes the cookies for the duration chosen at login, if any. The cookie of the duration is
+// refreshed along with the token, and deleted along with it
+func (c CookieStorer) WriteState(w http.ResponseWriter, state authboss.ClientState, events []authboss.ClientStateEvent) error {
+	keepSignedIn, chosen := "", false
+	if state != nil {
+		keepSignedIn, chosen = state.Get(CookieKeepSignedIn)
+	}
+	for _, event := range events {
+		if event.Key == CookieKeepSignedIn && event.Kind == authboss.ClientStateEventPut {
+			keepSignedIn, chosen = event.Value, false // put already
+		}
+	}
+	if duration, err := time.ParseDuration(keepSignedIn); err == nil && duration > 0 {
+		c.MaxAge = int(duration / time.Second)
+	}
+	for _, event := range events {
+		if event.Key != authboss.CookieRemember {
+			continue
+		}
+		if event.Kind == authboss.ClientStateEventPut && chosen {
+			events = append(events, authboss.ClientStateEvent{Kind: authboss.ClientStateEventPut, Key: CookieKeepSignedIn, Value: keepSignedIn})
+		} else if event.Kind == authboss.ClientStateEventDel {
+			events = append(events, authboss.ClientStateEvent{Kind: authboss.ClientStateEventDel, Key: CookieKeepSignedIn})
+		}
+	}
+	return c.CookieStorer.WriteState(w, state, events)
 }
 
-func NewSessionStorer(cookieName string, sessionStoreKey []byte) abclientstate.SessionStorer {
-	return abclientstate.NewSessionStorer(cookieName, sessionStoreKey, nil)
+// sessionStore saves the session cookies of the session-only logins without an expiry, so that the browsers
+// drop them on closing. The signed in longer get the cookies of the usual expiry, or of the duration when
+// sooner
+type sessionStore struct {
+	*sessions.CookieStore
+}
+
+func (s sessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if keepSignedIn, ok := session.Values[SessionKeepSignedInKey].(string); ok && session.Options.MaxAge > 0 {
+		if duration, err := time.ParseDuration(keepSignedIn); err == nil && duration < time.Duration(session.Options.MaxAge)*time.Second {
+			session.Options.MaxAge = int(duration / time.Second)
+		}
+	}
+	return s.CookieStore.Save(r, w, session)
 }
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/volatiletech/authboss/v3"
+)
+
+func TestCanonicalPID(t *testing.T) {
+	db := newTestDB(t)
+	storer := NewDBStorer(db, nil)
+	ctx := context.Background()
+	if err := storer.Create(ctx, &User{ID: "Alice@Example.com", Email: "Alice@Example.com"}); err != nil {
+		t.Fatalf("Error while registering the user -> %s", err)
+	}
+	tests := []struct {
+		name   string
+		pid    string
+		wantID string // empty when not found
+	}{
+		{"as registered", "Alice@Example.com", "Alice%40Example.com"},
+		{"lowercase", "alice@example.com", "Alice%40Example.com"},
+		{"uppercase", "ALICE@EXAMPLE.COM", "Alice%40Example.com"},
+		{"other", "bob@example.com", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := storer.Load(ctx, test.pid)
+			if test.wantID == "" {
+				if err != authboss.ErrUserNotFound {
+					t.Errorf("got user %s & error %v, want not found", user.GetPID(), err)
+				}
+				return
+			}
+			if err != nil || user.(*User).ID != test.wantID || user.(*User).Email != "Alice@Example.com" {
+				t.Errorf("got user %s & error %v, want user %s of the email as registered", user.(*User).ID, err, test.wantID)
+			}
+			if err := storer.Create(ctx, &User{ID: test.pid, Email: test.pid}); err != authboss.ErrUserFound {
+				t.Errorf("got error %v registering again, want %v", err, authboss.ErrUserFound)
+			}
+		})
+	}
+}
+
+// TestCanonicalizePIDs migrates the users registered before the canonical PIDs, telling those differing only in
+// the casing as the conflicts
+func TestCanonicalizePIDs(t *testing.T) {
+	db := newTestDB(t)
+	for _, email := range []string{"Alice@x.com", "alice@x.com", "Bob@x.com", "carol@x.com"} {
+		user := newTestUser(t, db, email)
+		if email != "carol@x.com" {
+			db.Model(user).UpdateColumn("canonical_pid", nil)
+		}
+	}
+	for run := 1; run <= 2; run++ { // told again on each start
+		conflicts, err := CanonicalizePIDs(db)
+		if err != nil {
+			t.Fatalf("Error while canonicalizing the PIDs -> %s", err)
+		}
+		if got := fmt.Sprint(conflicts); got != "[[Alice%40x.com alice%40x.com]]" {
+			t.Errorf("got conflicts %s on run %d, want those of Alice", got, run)
+		}
+	}
+	canonicalPIDs := map[string]*string{}
+	users := []*User{}
+	db.Find(&users)
+	for _, user := range users {
+		canonicalPIDs[user.ID] = user.CanonicalPID
+	}
+	for userID, want := range map[string]string{"Alice%40x.com": "", "alice%40x.com": "", "Bob%40x.com": "bob@x.com", "carol%40x.com": "carol@x.com"} {
+		if got := canonicalPIDs[userID]; (got == nil) != (want == "") || (got != nil && *got != want) {
+			t.Errorf("got canonical PID %v of %s, want %q", got, userID, want)
+		}
+	}
+
+	storer := NewDBStorer(db, nil)
+	for pid, wantID := range map[string]string{"Alice@x.com": "Alice%40x.com", "alice@x.com": "alice%40x.com", "BOB@x.com": "Bob%40x.com"} {
+		if user, err := storer.Load(context.Background(), pid); err != nil || user.(*User).ID != wantID {
+			t.Errorf("got user %s & error %v logging in as %s, want %s", user.(*User).ID, err, pid, wantID)
+		}
+	}
+	if err := storer.Create(context.Background(), &User{ID: "ALICE@x.com", Email: "ALICE@x.com"}); err != authboss.ErrUserFound {
+		t.Errorf("got error %v registering another casing of the conflicts, want %v", err, authboss.ErrUserFound)
+	}
+}
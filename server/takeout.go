@@ -0,0 +1,177 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// MsgInvalidTakeout is the constant for Invalid Takeout message
+const MsgInvalidTakeout string = "InvalidTakeout"
+
+// keepColors maps the colors of Google Keep, which aren't named the same, to the nearest of the palette
+var keepColors = map[string]TodoColor{
+	"TEAL":     TodoColorCyan,
+	"BLUE":     TodoColorLightblue,
+	"CERULEAN": TodoColorDarkblue,
+	"GRAY":     TodoColorGrey,
+}
+
+// keepNote is a note in the JSON files of a Google Keep Takeout archive
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Color                string `json:"color"`
+	IsArchived           bool   `json:"isArchived"`
+	IsPinned             bool   `json:"isPinned"`
+	IsTrashed            bool   `json:"isTrashed"`
+	CreatedTimestampUsec int64  `json:"createdTimestampUsec"`
+}
+
+// openTakeout opens the uploaded archive as zip, reading it into memory unless it can be read at random
+func openTakeout(file io.Reader, size int64) (*zip.Reader, error) {
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		readerAt, size = bytes.NewReader(content), int64(len(content))
+	}
+	archive, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return nil, errors.New(MsgInvalidTakeout)
+	}
+	return archive, nil
+}
+
+// importTakeout creates the todos of the user out of the notes in the Keep folder of the Takeout archive.
+// The files, which aren't Keep notes, are skipped, as are the trashed notes & those beyond the limits
+func importTakeout(tx *gorm.DB, userID string, archive *zip.Reader, limits *Limits) (*ImportResult, error) {
+	result := &ImportResult{}
+	labels := map[string]*Label{}
+	for _, file := range archive.File {
+		if path.Ext(file.Name) != ".json" || path.Base(path.Dir(file.Name)) != "Keep" {
+			continue
+		}
+		note, err := readKeepNote(file)
+		if err != nil || note.IsTrashed {
+			result.Skipped++
+			continue
+		}
+		todo, err := newKeepTodo(tx, userID, note, labels)
+		if err != nil {
+			return nil, err
+		}
+		if limits.checkTodo(todo) != nil {
+			result.Skipped++
+			continue
+		}
+		if err := tx.Create(todo).Error; err != nil {
+			return nil, err
+		}
+		result.Imported++
+	}
+	return result, nil
+}
+
+func readKeepNote(file *zip.File) (*keepNote, error) {
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	note := &keepNote{}
+	if err := json.NewDecoder(content).Decode(note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// newKeepTodo converts the Keep note into a todo, with a note per checklist item or per line of the text.
+// The labels are looked up by name, and created when the user doesn't have them yet
+func newKeepTodo(tx *gorm.DB, userID string, note *keepNote, labels map[string]*Label) (*Todo, error) {
+	newTodoID, _ := gonanoid.New(IDSize)
+	todo := &Todo{
+		ID:             newTodoID,
+		Title:          note.Title,
+		Notes:          []*Note{},
+		Labels:         []*Label{},
+		Color:          strings.ToLower(keepColor(note.Color).String()),
+		IsCheckboxMode: len(note.ListContent) > 0,
+		IsPinned:       note.IsPinned,
+		IsArchived:     note.IsArchived,
+		UserID:         userID,
+	}
+	if note.CreatedTimestampUsec > 0 {
+		todo.CreatedAt = time.Unix(0, note.CreatedTimestampUsec*int64(time.Microsecond))
+	}
+	texts, completed := []string{}, []bool{}
+	if todo.IsCheckboxMode {
+		for _, item := range note.ListContent {
+			texts, completed = append(texts, item.Text), append(completed, item.IsChecked)
+		}
+	} else if note.TextContent != "" {
+		for _, line := range strings.Split(note.TextContent, "\n") {
+			texts, completed = append(texts, line), append(completed, false)
+		}
+	}
+	for index, text := range texts {
+		newNoteID, _ := gonanoid.New(IDSize)
+		todo.Notes = append(todo.Notes, &Note{
+			ID:          newNoteID,
+			Text:        text,
+			IsCompleted: completed[index],
+			Position:    index,
+		})
+	}
+	for _, keepLabel := range note.Labels {
+		label, ok := labels[keepLabel.Name]
+		if !ok {
+			label = &Label{}
+			if err := tx.Where("user_id = ? AND name = ?", userID, keepLabel.Name).First(label).Error; gorm.IsRecordNotFoundError(err) {
+				newLabelID, _ := gonanoid.New(IDSize)
+				label = &Label{
+					ID:     newLabelID,
+					Name:   keepLabel.Name,
+					Color:  strings.ToLower(LabelColorDefault.String()),
+					UserID: userID,
+				}
+				if err := tx.Create(label).Error; err != nil {
+					return nil, err
+				}
+			} else if err != nil {
+				return nil, err
+			}
+			labels[keepLabel.Name] = label
+		}
+		todo.Labels = append(todo.Labels, label)
+	}
+	return todo, nil
+}
+
+func keepColor(color string) TodoColor {
+	if todoColor, ok := keepColors[color]; ok {
+		return todoColor
+	}
+	if todoColor := TodoColor(color); todoColor.IsValid() {
+		return todoColor
+	}
+	return TodoColorDefault
+}
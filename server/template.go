@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// maxTemplates caps the templates of a user, as they aren't counted in the quota of the todos
+const maxTemplates int = 50
+
+// TemplateSeed is a template, which every user gets on signing up
+type TemplateSeed struct {
+	Name           string   `yaml:"name"`
+	Title          string   `yaml:"title"`
+	Notes          []string `yaml:"notes"`
+	Color          string   `yaml:"color"` // like 'GREEN', the default when empty
+	IsCheckboxMode bool     `yaml:"isCheckboxMode"`
+}
+
+// BuiltInTemplates are seeded for the new users, unless others are configured
+var BuiltInTemplates = []TemplateSeed{
+	{Name: "Meeting notes", Title: "Meeting notes", Notes: []string{"Attendees:\n\nAgenda:\n\nDecisions:\n\nAction items:"}},
+	{Name: "Shopping list", Title: "Shopping list", Notes: []string{"Fruits & vegetables", "Dairy", "Bakery", "Household"}, Color: "GREEN", IsCheckboxMode: true},
+	{Name: "Packing list", Title: "Packing list", Notes: []string{"Passport & tickets", "Clothes", "Toiletries", "Chargers"}, Color: "LIGHTBLUE", IsCheckboxMode: true},
+	{Name: "Weekly plan", Title: "This week", Notes: []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Weekend"}, Color: "YELLOW", IsCheckboxMode: true},
+}
+
+// ReadTemplateSeeds reads the templates to seed from the YAML file, being a list of the TemplateSeed. The built-in
+// ones are seeded when the path is empty, and none when the file lists none
+func ReadTemplateSeeds(path string) ([]TemplateSeed, error) {
+	if path == "" {
+		return BuiltInTemplates, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seeds := []TemplateSeed{}
+	if err := yaml.UnmarshalStrict(content, &seeds); err != nil {
+		return nil, err
+	}
+	for index, seed := range seeds {
+		if strings.TrimSpace(seed.Name) == "" {
+			return nil, fmt.Errorf("the template #%d has no name", index+1)
+		}
+		if seed.Color != "" && !TodoColor(strings.ToUpper(seed.Color)).IsValid() {
+			return nil, fmt.Errorf("the template '%s' is of an unknown color '%s'", seed.Name, seed.Color)
+		}
+	}
+	return seeds, nil
+}
+
+// seedTemplates creates the templates of the seeds for the user
+func seedTemplates(tx *gorm.DB, userID string, seeds []TemplateSeed) error {
+	for _, seed := range seeds {
+		notes := make([]*Note, len(seed.Notes))
+		for index, text := range seed.Notes {
+			notes[index] = &Note{Text: text}
+		}
+		content, err := marshalNotes(notes)
+		if err != nil {
+			return err
+		}
+		id, _ := gonanoid.New(IDSize)
+		template := &TodoTemplate{
+			ID:             id,
+			Name:           seed.Name,
+			Title:          seed.Title,
+			Content:        content,
+			Labels:         []*Label{},
+			Color:          strings.ToLower(TodoColorDefault.String()),
+			IsCheckboxMode: seed.IsCheckboxMode,
+			UserID:         userID,
+		}
+		if seed.Color != "" {
+			template.Color = strings.ToLower(seed.Color)
+		}
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTodoTemplate makes a template of the todo of the user, keeping its title, notes, labels & color. Only the
+// labels of the user are kept, as those added by the collaborators are of theirs
+func newTodoTemplate(todo *Todo, userID string, name string) (*TodoTemplate, error) {
+	content, err := marshalNotes(todo.Notes)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := gonanoid.New(IDSize)
+	template := &TodoTemplate{
+		ID:             id,
+		Name:           name,
+		Title:          todo.Title,
+		Content:        content,
+		Labels:         []*Label{},
+		Color:          todo.Color,
+		IsCheckboxMode: todo.IsCheckboxMode,
+		UserID:         userID,
+	}
+	for _, label := range todo.Labels {
+		if label.UserID == userID {
+			template.Labels = append(template.Labels, label)
+		}
+	}
+	return template, nil
+}
+
+// newTodo makes a new todo of the template, whose notes are of their own
+func (t *TodoTemplate) newTodo(userID string) *Todo {
+	id, _ := gonanoid.New(IDSize)
+	todo := &Todo{
+		ID:             id,
+		Title:          t.Title,
+		UserID:         userID,
+		Notes:          t.Notes(),
+		Labels:         t.Labels,
+		Color:          t.Color,
+		IsCheckboxMode: t.IsCheckboxMode,
+	}
+	for _, note := range todo.Notes {
+		note.ID, _ = gonanoid.New(IDSize)
+		note.TodoID = todo.ID
+	}
+	nestNotes(todo.Notes, isNested(todo.Notes))
+	return todo
+}
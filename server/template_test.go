@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTemplateSeeds(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string // none when empty
+		wantNames string // empty for an error
+	}{
+		{"built-in", "", "Meeting notes,Shopping list,Packing list,Weekly plan"},
+		{"configured", "- name: Standup\n  title: Standup\n  notes: [Yesterday, Today]\n  color: green\n  isCheckboxMode: true\n- name: Journal\n", "Standup,Journal"},
+		{"none", "[]", "-"},
+		{"no name", "- title: Standup\n", ""},
+		{"blank name", "- name: ' '\n", ""},
+		{"unknown color", "- name: Standup\n  color: gold\n", ""},
+		{"unknown field", "- name: Standup\n  colour: green\n", ""},
+		{"malformed", "name: Standup\n", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := ""
+			if test.file != "" {
+				path = filepath.Join(t.TempDir(), "templates.yml")
+				if err := ioutil.WriteFile(path, []byte(test.file), 0600); err != nil {
+					t.Fatalf("Error while writing the templates -> %s", err)
+				}
+			}
+			seeds, err := ReadTemplateSeeds(path)
+			if test.wantNames == "" {
+				if err == nil {
+					t.Errorf("got %d templates, want an error", len(seeds))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			names := []string{}
+			for _, seed := range seeds {
+				names = append(names, seed.Name)
+			}
+			if got := strings.Join(names, ","); got != strings.TrimPrefix(test.wantNames, "-") {
+				t.Errorf("got templates %s, want %s", got, test.wantNames)
+			}
+		})
+	}
+}
+
+// TestSeedTemplates registers a user, who gets the templates of the seeds
+func TestSeedTemplates(t *testing.T) {
+	db := newTestDB(t)
+	seeds := []TemplateSeed{
+		{Name: "Standup", Title: "Standup", Notes: []string{"Yesterday", "Today"}, Color: "GREEN", IsCheckboxMode: true},
+		{Name: "Journal"},
+	}
+	if err := NewDBStorer(db, seeds).Create(context.Background(), &User{ID: "seeded@example.com", Email: "seeded@example.com"}); err != nil {
+		t.Fatalf("Error while registering the user -> %s", err)
+	}
+	templates, err := newTestResolver(db).Query().Templates(userContext("seeded%40example.com"))
+	if err != nil {
+		t.Fatalf("Error while listing the templates -> %s", err)
+	}
+	if len(templates) != 2 || templates[0].Name != "Journal" || templates[0].Color != "default" || templates[1].Name != "Standup" || templates[1].Color != "green" || !templates[1].IsCheckboxMode {
+		t.Fatalf("got templates %+v, want Journal & Standup", templates)
+	}
+	if notes := templates[1].Notes(); len(notes) != 2 || notes[0].Text != "Yesterday" || notes[1].Text != "Today" {
+		t.Errorf("got notes %+v of Standup, want Yesterday & Today", notes)
+	}
+}
+
+// TestTodoFromTemplate saves the todo as a template, and creates the todos of it, of their own notes & alike
+func TestTodoFromTemplate(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	user := newTestUser(t, db, "template@example.com")
+	other := newTestUser(t, db, "other@example.com")
+	ctx := userContext(user.ID)
+	work := newTestLabel(t, db, user.ID, "Work")
+	indented := true
+	green := "GREEN"
+	todo, err := resolver.Mutation().CreateTodo(ctx, "Sprint", []string{}, []*string{&work.ID}, &green, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Error while creating the todo -> %s", err)
+	}
+	if todo, err = resolver.Mutation().UpdateTodo(ctx, todo.ID, nil, []*NotesInput{{Text: "Plan"}, {Text: "Review", IsIndented: &indented}}, nil, nil, nil, nil); err != nil {
+		t.Fatalf("Error while adding the notes -> %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		userID    string
+		template  string
+		wantName  string
+		wantError string // empty when saved
+	}{
+		{"named", todo.ID, user.ID, "Sprints", "Sprints", ""},
+		{"blank name of the title", todo.ID, user.ID, "  ", "Sprint", ""},
+		{"of another", todo.ID, other.ID, "Sprints", "", MsgNotFound},
+		{"missing", "missing", user.ID, "Sprints", "", MsgNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := resolver.Mutation().SaveTodoAsTemplate(userContext(test.userID), test.id, test.template)
+			if test.wantError != "" {
+				if err == nil || err.Error() != test.wantError {
+					t.Errorf("got error %v, want %s", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if template.Name != test.wantName || template.Title != "Sprint" || template.Color != "green" || len(template.Labels) != 1 {
+				t.Errorf("got template %s of title %s, color %s & %d labels, want %s of the todo", template.Name, template.Title, template.Color, len(template.Labels), test.wantName)
+			}
+
+			noteIDs := map[string]bool{todo.Notes[0].ID: true, todo.Notes[1].ID: true}
+			for copies := 0; copies < 2; copies++ { // each with notes of its own
+				created, err := resolver.Mutation().CreateTodoFromTemplate(ctx, template.ID)
+				if err != nil {
+					t.Fatalf("Error while creating the todo of the template -> %s", err)
+				}
+				stored := Todo{}
+				if err := db.Where("id = ?", created.ID).Preload("Notes", orderedNotes).Preload("Labels").First(&stored).Error; err != nil {
+					t.Fatalf("Error while reading the todo created -> %s", err)
+				}
+				if stored.ID == todo.ID || stored.Title != "Sprint" || stored.Color != "green" || len(stored.Labels) != 1 || stored.Labels[0].ID != work.ID {
+					t.Errorf("got todo %s of title %s, color %s & labels %v, want a copy of the todo", stored.ID, stored.Title, stored.Color, stored.Labels)
+				}
+				if len(stored.Notes) != 2 || stored.Notes[0].Text != "Plan" || stored.Notes[1].Text != "Review" || stored.Notes[1].ParentID == nil || *stored.Notes[1].ParentID != stored.Notes[0].ID {
+					t.Fatalf("got notes %+v, want Review nested under Plan", stored.Notes)
+				}
+				for _, note := range stored.Notes {
+					if noteIDs[note.ID] {
+						t.Errorf("got note %s again, want one of its own", note.ID)
+					}
+					noteIDs[note.ID] = true
+				}
+			}
+			if _, err := resolver.Mutation().CreateTodoFromTemplate(userContext(other.ID), template.ID); err == nil || err.Error() != MsgNotFound {
+				t.Errorf("got error %v creating of the template of another, want %s", err, MsgNotFound)
+			}
+		})
+	}
+
+	if _, err := resolver.Mutation().LockTodo(ctx, todo.ID, "correct horse"); err != nil {
+		t.Fatalf("Error while locking the todo -> %s", err)
+	}
+	if _, err := resolver.Mutation().SaveTodoAsTemplate(ctx, todo.ID, "Locked"); err == nil || err.Error() != MsgTodoLocked {
+		t.Errorf("got error %v saving the locked todo, want %s", err, MsgTodoLocked)
+	}
+}
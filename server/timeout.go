@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// MsgTimeout is the constant for Timeout message
+const MsgTimeout string = "Timeout"
+
+// ctxDBKey holds the DB bound to the context of the operation
+type ctxDBKey struct{}
+
+// QueryTimeout cancels the DB queries of the queries & mutations running longer than the timeout, or whose client
+// has gone away, as the context derives from that of the request. The subscriptions live as long as their
+// websockets, so they aren't timed
+type QueryTimeout struct {
+	DB      *gorm.DB
+	Timeout time.Duration
+}
+
+var _ interface {
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+	graphql.HandlerExtension
+} = QueryTimeout{}
+
+// ExtensionName implements graphql.HandlerExtension
+func (q QueryTimeout) ExtensionName() string {
+	return "QueryTimeout"
+}
+
+// Validate implements graphql.HandlerExtension
+func (q QueryTimeout) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse implements graphql.ResponseInterceptor
+func (q QueryTimeout) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if op := graphql.GetOperationContext(ctx).Operation; op != nil && op.Operation == ast.Subscription {
+		return next(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, q.Timeout)
+	defer cancel()
+	return next(context.WithValue(ctx, ctxDBKey{}, withContext(q.DB, ctx)))
+}
+
+// InterceptField implements graphql.FieldInterceptor, telling the client of the timeout rather than of an internal
+// error. The statements cut short fail with errors of all kinds, like of the rows closed within a transaction
+func (q QueryTimeout) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	res, err := next(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return res, errors.New(MsgTimeout)
+	}
+	return res, err
+}
+
+// contextDB is the DB bound to the context of the operation, or else the DB given
+func contextDB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if ctxDB, ok := ctx.Value(ctxDBKey{}).(*gorm.DB); ok {
+		return ctxDB
+	}
+	return db
+}
+
+// withContext is the DB running its statements & transactions with the context. gorm v1 knows nothing of the
+// contexts, so a DB is opened anew over the connection pool, through a wrapper running the statements with it. Such
+// a DB has none of the callbacks, so those registered with registerCallbacks are registered again
+func withContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return openCallbacks(db.Dialect().GetName(), db.DB(), &sqlContext{DB: db.DB(), ctx: ctx})
+}
+
+// callbackSetups are the setups of the callbacks registered with the DBs, by their connection pools
+var callbackSetups = struct {
+	sync.Mutex
+	byPool map[*sql.DB][]func(*gorm.Callback)
+}{byPool: make(map[*sql.DB][]func(*gorm.Callback))}
+
+// registerCallbacks registers the callbacks of the setup with the DB, as well as with those opened later over its
+// connection pool for the contexts
+func registerCallbacks(db *gorm.DB, setup func(callback *gorm.Callback)) {
+	setup(db.Callback())
+	callbackSetups.Lock()
+	defer callbackSetups.Unlock()
+	callbackSetups.byPool[db.DB()] = append(callbackSetups.byPool[db.DB()], setup)
+}
+
+// dbLogger is the logger of gorm, whose interface gorm keeps unexported
+type dbLogger interface {
+	Print(v ...interface{})
+}
+
+// dbLog is the logger & the log mode of a DB
+type dbLog struct {
+	logger   dbLogger
+	detailed bool
+}
+
+// dbLogs are the loggers & the log modes set with SetDBLogger, by the connection pools of the DBs
+var dbLogs = struct {
+	sync.Mutex
+	byPool map[*sql.DB]dbLog
+}{byPool: make(map[*sql.DB]dbLog)}
+
+// SetDBLogger sets the logger & the log mode of the DB, as well as of those opened later over its connection pool
+// for the contexts. gorm tells neither of a DB, so those set on the DB itself are left to the DB alone
+func SetDBLogger(db *gorm.DB, logger dbLogger, detailed bool) {
+	db.SetLogger(logger)
+	db.LogMode(detailed)
+	dbLogs.Lock()
+	defer dbLogs.Unlock()
+	dbLogs.byPool[db.DB()] = dbLog{logger: logger, detailed: detailed}
+}
+
+// openCallbacks opens a DB over the connection of the pool, with the callbacks, the logger & the log mode of the pool
+func openCallbacks(dialect string, pool *sql.DB, conn gorm.SQLCommon) *gorm.DB {
+	db, _ := gorm.Open(dialect, conn) // fails only of the DSNs
+	callbackSetups.Lock()
+	setups := callbackSetups.byPool[pool]
+	callbackSetups.Unlock()
+	dbLogs.Lock()
+	poolLog, ok := dbLogs.byPool[pool]
+	dbLogs.Unlock()
+	if ok {
+		db.SetLogger(poolLog.logger)
+		db.LogMode(poolLog.detailed)
+	}
+	// The callbacks are registered through a clone sharing them, which keeps quiet of registering every one again
+	quiet := db.New()
+	quiet.SetLogger(gorm.Logger{LogWriter: log.New(ioutil.Discard, "", 0)})
+	callback := quiet.Callback()
+	for _, setup := range setups {
+		setup(callback)
+	}
+	return db
+}
+
+// sqlContext runs the statements of the connection pool with the context
+type sqlContext struct {
+	*sql.DB
+	ctx context.Context
+}
+
+func (s *sqlContext) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.ExecContext(s.ctx, query, args...)
+}
+
+func (s *sqlContext) Prepare(query string) (*sql.Stmt, error) {
+	return s.DB.PrepareContext(s.ctx, query)
+}
+
+func (s *sqlContext) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.QueryContext(s.ctx, query, args...)
+}
+
+func (s *sqlContext) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRowContext(s.ctx, query, args...)
+}
+
+// Begin starts the transactions gorm runs a write in by itself, which are rolled back once the context is done. gorm
+// runs their statements on the *sql.Tx as is, so the one running then is let finish, while the rest fail
+func (s *sqlContext) Begin() (*sql.Tx, error) {
+	return s.DB.BeginTx(s.ctx, nil)
+}
+
+func (s *sqlContext) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return s.DB.BeginTx(s.ctx, opts) // gorm begins with the background context
+}
+
+// transaction runs fn in a transaction of the DB over the pool, whose statements run with the context too
+func (s *sqlContext) transaction(db *gorm.DB, hooks *commitHooks, fn func(tx *gorm.DB) error) (err error) {
+	sqlTx, err := s.DB.BeginTx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+	err = fn(openCallbacks(db.Dialect().GetName(), s.DB, &txContext{Tx: sqlTx, ctx: s.ctx}).Set(commitHooksKey, hooks))
+	if err == nil {
+		err = sqlTx.Commit()
+	}
+	panicked = false
+	return err
+}
+
+// txContext runs the statements of the transaction with the context. It begins none, so that gorm runs the writes
+// within it rather than in transactions of their own
+type txContext struct {
+	*sql.Tx
+	ctx context.Context
+}
+
+func (t *txContext) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.ExecContext(t.ctx, query, args...)
+}
+
+func (t *txContext) Prepare(query string) (*sql.Stmt, error) {
+	return t.Tx.PrepareContext(t.ctx, query)
+}
+
+func (t *txContext) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.QueryContext(t.ctx, query, args...)
+}
+
+func (t *txContext) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRowContext(t.ctx, query, args...)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// slowQuery counts on & on, till it's interrupted
+const slowQuery string = "WITH RECURSIVE counter(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM counter) SELECT max(n) FROM counter"
+
+func TestWithContextCancelsSlowQuery(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "slow@example.com")
+	tests := []struct {
+		name  string
+		query func(db *gorm.DB) error
+	}{
+		{"statement", func(db *gorm.DB) error {
+			n := 0
+			return db.Raw(slowQuery).Row().Scan(&n)
+		}},
+		{"transaction", func(db *gorm.DB) error {
+			return transaction(db, func(tx *gorm.DB) error {
+				newTestTodo(t, tx, user.ID, "Rolled back")
+				n := 0
+				return tx.Raw(slowQuery).Row().Scan(&n)
+			})
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			failed := make(chan error, 1)
+			go func() { failed <- test.query(withContext(db, ctx)) }()
+			select {
+			case err := <-failed:
+				if err == nil {
+					t.Error("the slow query succeeded, want it cancelled")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the slow query runs on past the timeout")
+			}
+		})
+	}
+	count := 0
+	db.Model(&Todo{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d todos, want the transaction rolled back", count)
+	}
+}
+
+func TestWithContextKeepsCallbacks(t *testing.T) {
+	db := newTestDB(t)
+	hub := NewTodoHub(db)
+	user := newTestUser(t, db, "callbacks@example.com")
+	done := make(chan struct{})
+	defer close(done)
+	events := hub.subscribe(user.ID, nil, done)
+
+	ctxDB := withContext(db, context.Background())
+	newTestTodo(t, ctxDB, user.ID, "Statement")
+	if err := transaction(ctxDB, func(tx *gorm.DB) error {
+		newTestTodo(t, tx, user.ID, "Transaction")
+		return nil
+	}); err != nil {
+		t.Fatalf("transaction() error = %v", err)
+	}
+	for _, want := range []string{"Statement", "Transaction"} {
+		select {
+		case event := <-events:
+			if event.Todo.Title != want {
+				t.Errorf("event of '%s', want of '%s'", event.Todo.Title, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event of '%s'", want)
+		}
+	}
+}
+
+// logRecorder records the messages logged by gorm
+type logRecorder struct {
+	sync.Mutex
+	messages []string
+}
+
+func (l *logRecorder) Print(v ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.messages = append(l.messages, fmt.Sprint(v...))
+}
+
+func TestWithContextKeepsLogger(t *testing.T) {
+	db := newTestDB(t)
+	NewTodoHub(db)
+	user := newTestUser(t, db, "logged@example.com")
+	recorder := &logRecorder{}
+	SetDBLogger(db, recorder, true)
+
+	ctxDB := withContext(db, context.Background())
+	newTestTodo(t, ctxDB, user.ID, "Statement")
+	if err := transaction(ctxDB, func(tx *gorm.DB) error {
+		newTestTodo(t, tx, user.ID, "Transaction")
+		return nil
+	}); err != nil {
+		t.Fatalf("transaction() error = %v", err)
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	inserts := 0
+	for _, message := range recorder.messages {
+		if strings.Contains(message, "registering callback") {
+			t.Errorf("logged the registering of the callbacks again: %s", message)
+		}
+		if strings.Contains(message, "INSERT INTO \"todos\"") {
+			inserts++
+		}
+	}
+	if inserts != 2 {
+		t.Errorf("logged %d inserts of the todos, want those of the statement & of the transaction", inserts)
+	}
+}
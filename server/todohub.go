@@ -0,0 +1,164 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// replayBufferSize is the number of the latest todo events kept per user, for the todo streams to catch up
+// on reconnecting
+const replayBufferSize = 100
+
+// TodoHub delivers the changes of the todos to the todo streams of their owners & collaborators. The events
+// of every user are numbered in sequence, and the latest ones are kept, so that a stream resubscribing after
+// a dropped connection gets the events it has missed
+type TodoHub struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	users   map[string]*todoEvents // by userID, of those who have subscribed since the start
+	streams map[string]map[*todoStream]struct{}
+}
+
+// todoEvents are the latest events of a user, the oldest first
+type todoEvents struct {
+	sequence int // of the last event
+	events   []*TodoAction
+}
+
+type todoStream struct {
+	events chan *TodoAction
+	done   <-chan struct{}
+}
+
+// NewTodoHub creates an instance of TodoHub, which looks out for the changes of the todos in the DB
+func NewTodoHub(db *gorm.DB) *TodoHub {
+	hub := &TodoHub{
+		db:      db,
+		users:   make(map[string]*todoEvents),
+		streams: make(map[string]map[*todoStream]struct{}),
+	}
+	registerCallbacks(db, func(callback *gorm.Callback) {
+		callback.Create().Register("todohub:create", func(scope *gorm.Scope) {
+			if createdTodo, ok := scope.Value.(*Todo); ok && !scope.HasError() && scope.TableName() == "todos" {
+				afterCommit(scope, func() { hub.publish(ActionCreated, createdTodo) })
+			}
+		})
+		callback.Update().Register("todohub:update", func(scope *gorm.Scope) {
+			if updatedTodo, ok := scope.Value.(*Todo); ok && !scope.HasError() && scope.TableName() == "todos" {
+				afterCommit(scope, func() { hub.publish(ActionUpdated, updatedTodo) })
+			}
+		})
+		callback.Delete().Register("todohub:delete", func(scope *gorm.Scope) {
+			if deletedTodo, ok := scope.Value.(Todo); ok && !scope.HasError() && scope.TableName() == "todos" {
+				afterCommit(scope, func() { hub.publish(ActionDeleted, &deletedTodo) })
+			}
+		})
+	})
+	return hub
+}
+
+// subscribe streams the events of the user from now on, after those following the sequence number 'since',
+// if given. When some of them are no longer kept, a RESYNC event tells the client to fetch the todos again
+func (h *TodoHub) subscribe(userID string, since *int, done <-chan struct{}) <-chan *TodoAction {
+	stream := &todoStream{events: make(chan *TodoAction, replayBufferSize), done: done}
+	h.mu.Lock()
+	user := h.users[userID]
+	if user == nil {
+		user = &todoEvents{}
+		h.users[userID] = user
+	}
+	replay := []*TodoAction{}
+	if since != nil {
+		oldest := user.sequence - len(user.events) + 1
+		if *since < oldest-1 || *since > user.sequence { // Missed more than kept, or numbered before a restart
+			replay = append(replay, &TodoAction{Action: ActionResync})
+		} else {
+			replay = append(replay, user.events[*since-oldest+1:]...)
+		}
+	}
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[*todoStream]struct{})
+	}
+	h.streams[userID][stream] = struct{}{}
+	h.mu.Unlock()
+
+	events := make(chan *TodoAction, 1)
+	go func() {
+		defer h.unsubscribe(userID, stream)
+		for _, event := range replay {
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+		for {
+			select {
+			case event := <-stream.events:
+				select {
+				case events <- event:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return events
+}
+
+func (h *TodoHub) unsubscribe(userID string, stream *todoStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams[userID], stream)
+	if len(h.streams[userID]) == 0 {
+		delete(h.streams, userID)
+	}
+}
+
+// publish numbers the event for the owner & each collaborator of the todo, and sends it to their streams. It never
+// waits on a stream, so that a slow client holds up neither the writer nor the others: one fallen behind by the
+// whole buffer gets its pending events dropped for a RESYNC, to fetch the todos again
+func (h *TodoHub) publish(action Action, todo *Todo) {
+	userIDs := []string{}
+	h.db.Model(&TodoCollaborator{}).Where("todo_id = ?", todo.ID).Pluck("user_id", &userIDs)
+	userIDs = append(userIDs, todo.UserID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range userIDs {
+		user := h.users[userID]
+		if user == nil {
+			continue // The events are kept only for those, who have subscribed
+		}
+		user.sequence++
+		sequence := user.sequence
+		event := &TodoAction{Action: action, Todo: todo, Sequence: &sequence}
+		user.events = append(user.events, event)
+		if len(user.events) > replayBufferSize {
+			user.events = user.events[1:]
+		}
+		for stream := range h.streams[userID] {
+			stream.send(event)
+		}
+	}
+}
+
+// send buffers the event for the stream, or replaces the buffered ones with a RESYNC when full. The hub is locked,
+// so no other event is sent in between
+func (s *todoStream) send(event *TodoAction) {
+	select {
+	case s.events <- event:
+		return
+	default:
+	}
+	for len(s.events) > 0 {
+		select {
+		case <-s.events:
+		default: // taken by the stream meanwhile
+		}
+	}
+	s.events <- &TodoAction{Action: ActionResync}
+}
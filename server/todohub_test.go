@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestTodoHubResyncsSlowStream(t *testing.T) {
+	db := newTestDB(t)
+	hub := NewTodoHub(db)
+	user := newTestUser(t, db, "slow@example.com")
+	done := make(chan struct{})
+	defer close(done)
+	events := hub.subscribe(user.ID, nil, done)
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 3*replayBufferSize; i++ {
+			hub.publish(ActionUpdated, &Todo{ID: "todo", UserID: user.ID})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing waits on the stream, which isn't read")
+	}
+
+	for received := 0; ; received++ {
+		select {
+		case event := <-events:
+			if event.Action == ActionResync {
+				if received > 2 { // the event held by the forwarding goroutine & the one it waits to send
+					t.Errorf("RESYNC after %d events, want the buffered ones dropped", received)
+				}
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no RESYNC after %d events", received)
+		}
+	}
+}
+
+func TestTodoHubPublishesAfterCommit(t *testing.T) {
+	db := newTestDB(t)
+	hub := NewTodoHub(db)
+	user := newTestUser(t, db, "commit@example.com")
+	done := make(chan struct{})
+	defer close(done)
+	events := hub.subscribe(user.ID, nil, done)
+
+	errRollback := errors.New("rollback")
+	err := transaction(db, func(tx *gorm.DB) error {
+		newTestTodo(t, tx, user.ID, "Rolled back")
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("transaction() error = %v, want %v", err, errRollback)
+	}
+	err = transaction(db, func(tx *gorm.DB) error {
+		newTestTodo(t, tx, user.ID, "Committed")
+		select {
+		case event := <-events:
+			t.Errorf("event %s of '%s' before committing", event.Action, event.Todo.Title)
+		case <-time.After(100 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction() error = %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Action != ActionCreated || event.Todo.Title != "Committed" {
+			t.Errorf("event = %s of '%s', want %s of 'Committed'", event.Action, event.Todo.Title, ActionCreated)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event after committing")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %s of '%s'", event.Action, event.Todo.Title)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTodoHubPublishesLabelChanges(t *testing.T) {
+	db := newTestDB(t)
+	hub := NewTodoHub(db)
+	resolver := newTestResolver(db)
+	resolver.TodoEvents = hub
+	owner := newTestUser(t, db, "owner@example.com")
+	collaborator := newTestUser(t, db, "collaborator@example.com")
+	stranger := newTestUser(t, db, "stranger@example.com")
+	todo := newTestTodo(t, db, owner.ID, "Labelled")
+	work, home := newTestLabel(t, db, owner.ID, "Work"), newTestLabel(t, db, owner.ID, "Home")
+	if err := db.Create(&TodoCollaborator{TodoID: todo.ID, UserID: collaborator.ID, Permission: PermissionWrite}).Error; err != nil {
+		t.Fatalf("Error while sharing the todo -> %s", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	streams := map[string]<-chan *TodoAction{}
+	for _, user := range []*User{owner, collaborator, stranger} {
+		streams[user.ID] = hub.subscribe(user.ID, nil, done)
+	}
+
+	tests := []struct {
+		name       string
+		by         *User
+		change     func(ctx context.Context, id string, labelID string) (*Todo, error)
+		label      *Label
+		wantLabels string // of the todo published to the owner & the collaborator
+	}{
+		{"owner adds", owner, resolver.Mutation().AddLabelToTodo, work, "Work"},
+		{"collaborator adds", collaborator, resolver.Mutation().AddLabelToTodo, home, "Work,Home"},
+		{"owner removes", owner, resolver.Mutation().RemoveLabelFromTodo, work, "Home"},
+		{"collaborator removes", collaborator, resolver.Mutation().RemoveLabelFromTodo, home, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.change(userContext(test.by.ID), todo.ID, test.label.ID); err != nil {
+				t.Fatalf("Error while changing the labels -> %s", err)
+			}
+			for _, user := range []*User{owner, collaborator} {
+				select {
+				case event := <-streams[user.ID]:
+					names := []string{}
+					for _, label := range event.Todo.Labels {
+						names = append(names, label.Name)
+					}
+					if event.Action != ActionUpdated || event.Todo.ID != todo.ID || strings.Join(names, ",") != test.wantLabels {
+						t.Errorf("%s got %s of todo %s labelled %q, want %s labelled %q", user.Email, event.Action, event.Todo.ID, strings.Join(names, ","), ActionUpdated, test.wantLabels)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("%s got no event", user.Email)
+				}
+			}
+			select {
+			case event := <-streams[stranger.ID]:
+				t.Errorf("the stranger got %s of todo %s", event.Action, event.Todo.ID)
+			default:
+			}
+		})
+	}
+}
+
+func TestTodoStreamOfOwnAndSharedTodos(t *testing.T) {
+	db := newTestDB(t)
+	resolver := newTestResolver(db)
+	resolver.TodoEvents = NewTodoHub(db)
+	resolver.Reminders = NewReminderHub()
+	alice := newTestUser(t, db, "alice@example.com")
+	bob := newTestUser(t, db, "bob@example.com")
+	carol := newTestUser(t, db, "carol@example.com")
+	todo := newTestTodo(t, db, alice.ID, "Groceries")
+	if _, err := resolver.Mutation().ShareTodo(userContext(alice.ID), todo.ID, carol.Email, PermissionWrite); err != nil {
+		t.Fatalf("ShareTodo() error = %v", err)
+	}
+	subscribe := func(userID string) <-chan *TodoAction {
+		ctx, cancel := context.WithCancel(userContext(userID))
+		t.Cleanup(cancel)
+		stream, err := resolver.Subscription().TodoStream(ctx, nil)
+		if err != nil {
+			t.Fatalf("TodoStream() error = %v", err)
+		}
+		return stream
+	}
+	aliceStream, bobStream, carolStream := subscribe(alice.ID), subscribe(bob.ID), subscribe(carol.ID)
+
+	if _, err := resolver.Mutation().PinTodo(userContext(alice.ID), todo.ID, true); err != nil {
+		t.Fatalf("PinTodo() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		stream <-chan *TodoAction
+		want   int // of the events of the pinned todo
+	}{
+		{"owner", aliceStream, 1},
+		{"other user", bobStream, 0},
+		{"collaborator", carolStream, 1},
+	}
+	for _, test := range tests {
+		for received := 0; received < test.want; received++ {
+			select {
+			case event := <-test.stream:
+				if event.Action != ActionUpdated || event.Todo.ID != todo.ID || !event.Todo.IsPinned {
+					t.Errorf("%s's stream event = %s of '%s', want %s of the pinned 'Groceries'", test.name, event.Action, event.Todo.Title, ActionUpdated)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s's stream has no event %s of 'Groceries'", test.name, ActionUpdated)
+			}
+		}
+		select {
+		case event := <-test.stream:
+			t.Errorf("%s's stream has the unexpected event %s of '%s'", test.name, event.Action, event.Todo.Title)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// commitHooksKey holds the hooks of the transaction, to run once it's committed
+const commitHooksKey string = "gkc:commit_hooks"
+
+type commitHooks struct {
+	mu    sync.Mutex
+	hooks []func()
+}
+
+// transaction runs fn in a transaction of the DB, like gorm's Transaction, followed by the hooks queued with
+// afterCommit once it's committed. A rolled back one runs none, and those of a nested one are left to the outer.
+// The transaction of a DB with a context runs its statements with it
+func transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.Get(commitHooksKey); ok {
+		return fn(db)
+	}
+	hooks := &commitHooks{}
+	var err error
+	if ctxDB, ok := db.CommonDB().(*sqlContext); ok {
+		err = ctxDB.transaction(db, hooks, fn)
+	} else {
+		err = db.Set(commitHooksKey, hooks).Transaction(fn)
+	}
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks.hooks {
+		hook()
+	}
+	return nil
+}
+
+// afterCommit runs the hook once the transaction of the scope is committed, so that the changes aren't told of
+// before the others can read them, or at all when rolled back. Outside of a transaction, it runs right away, as the
+// callbacks of gorm run after committing the statement by itself
+func afterCommit(scope *gorm.Scope, hook func()) {
+	value, ok := scope.Get(commitHooksKey)
+	if !ok {
+		hook()
+		return
+	}
+	hooks := value.(*commitHooks)
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.hooks = append(hooks.hooks, hook)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// MsgUndoExpired is the constant for Undo Expired message
+const MsgUndoExpired string = "UndoExpired"
+
+// undoTokenSize is the size of the undo tokens, long enough not to be guessed within the window
+const undoTokenSize int = 21
+
+// undoAction is what a token undoes, the deletion of the todo or the change to its archived state
+type undoAction struct {
+	userID    string
+	todoID    string
+	deleted   bool
+	archived  bool // as before the change
+	expiresAt time.Time
+}
+
+// UndoLog keeps in memory the destructive changes to the todos, which may be undone for a while with the token
+// given along. Each token undoes once, by the user who made the change only
+type UndoLog struct {
+	mu      sync.Mutex
+	window  time.Duration
+	actions map[string]*undoAction // by token
+}
+
+// NewUndoLog creates an instance of UndoLog, whose tokens expire after the window
+func NewUndoLog(window time.Duration) *UndoLog {
+	return &UndoLog{
+		window:  window,
+		actions: make(map[string]*undoAction),
+	}
+}
+
+// issue keeps the action for the window, and gives the token undoing it. The expired actions are dropped meanwhile
+func (u *UndoLog) issue(action *undoAction) *string {
+	token, _ := gonanoid.New(undoTokenSize)
+	now := time.Now()
+	action.expiresAt = now.Add(u.window)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for token, action := range u.actions {
+		if now.After(action.expiresAt) {
+			delete(u.actions, token)
+		}
+	}
+	u.actions[token] = action
+	return &token
+}
+
+// take gives the action of the token, which is used up then. The tokens of the others are not found, and are left
+// for their users
+func (u *UndoLog) take(userID string, token string) (*undoAction, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	action := u.actions[token]
+	if action == nil || time.Now().After(action.expiresAt) {
+		delete(u.actions, token)
+		return nil, errors.New(MsgUndoExpired) // Once dropped, the expired tokens are not told apart from the used ones
+	}
+	if action.userID != userID {
+		return nil, errors.New(MsgNotFound)
+	}
+	delete(u.actions, token)
+	return action, nil
+}
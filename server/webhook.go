@@ -0,0 +1,343 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	// MsgInvalidWebhookURL is the constant for Invalid Webhook URL message
+	MsgInvalidWebhookURL string = "InvalidWebhookURL"
+	// MsgNoWebhookEvents is the constant for No Webhook Events message
+	MsgNoWebhookEvents string = "NoWebhookEvents"
+)
+
+const (
+	maxWebhooks       = 10   // per user
+	webhookSecretSize = 32   // long enough not to be guessed, as it signs the payloads
+	webhookQueueSize  = 1000 // of the events not yet delivered, beyond which the newer ones are dropped
+	webhookWorkers    = 4
+	webhookAttempts   = 5 // of each delivery, a second after the first & twice as long after each next
+	webhookTimeout    = 10 * time.Second
+)
+
+// errWebhookAddress tells that the webhook resolves to an address of the host or its network, which isn't called
+var errWebhookAddress = errors.New("the webhook resolves to a private address")
+
+// privateNetworks are the loopback, private & link-local networks, which the webhooks can't reach into. Otherwise
+// a user could have the server call the services behind the firewall, like the metadata of the cloud
+var privateNetworks = func() []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range []string{"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7", "fe80::/10"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// refusePrivateAddress fails the connection to the private address, which is checked once resolved, so that the
+// host of the webhook can't resolve to another address after it's registered
+func refusePrivateAddress(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errWebhookAddress
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// webhookEventMask is the mask of the events, each of which is the bit of its index in AllWebhookEvent
+func webhookEventMask(events []WebhookEvent) int {
+	mask := 0
+	for index, event := range AllWebhookEvent {
+		for _, e := range events {
+			if e == event {
+				mask |= 1 << index
+			}
+		}
+	}
+	return mask
+}
+
+// newWebhook validates the URL & the events of the webhook to register, and gives it a secret
+func newWebhook(userID string, rawURL string, events []WebhookEvent) (*Webhook, error) {
+	webhookURL, err := url.Parse(rawURL)
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" || webhookURL.User != nil {
+		return nil, errors.New(MsgInvalidWebhookURL)
+	}
+	if len(events) == 0 {
+		return nil, errors.New(MsgNoWebhookEvents)
+	}
+	id, _ := gonanoid.New(IDSize)
+	secret, _ := gonanoid.New(webhookSecretSize)
+	return &Webhook{
+		ID:        id,
+		URL:       webhookURL.String(),
+		EventMask: webhookEventMask(events),
+		Secret:    secret,
+		UserID:    userID,
+	}, nil
+}
+
+// webhookPayload is the JSON POSTed to the webhooks. The 'text' makes the incoming webhooks of Slack post it as is
+type webhookPayload struct {
+	Event      WebhookEvent `json:"event"`
+	Text       string       `json:"text"`
+	Todo       webhookTodo  `json:"todo"`
+	OccurredAt time.Time    `json:"occurredAt"`
+}
+
+type webhookTodo struct {
+	ID         string        `json:"id"`
+	Title      string        `json:"title"`
+	Notes      []webhookNote `json:"notes"`
+	Labels     []string      `json:"labels"` // by name
+	Color      string        `json:"color"`
+	IsPinned   bool          `json:"isPinned"`
+	IsArchived bool          `json:"isArchived"`
+	RemindAt   *time.Time    `json:"remindAt"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+}
+
+type webhookNote struct {
+	Text        string `json:"text"`
+	IsCompleted bool   `json:"isCompleted"`
+}
+
+// webhookEvent is the event of a todo, to be delivered to the webhooks of the todo's owner & collaborators
+type webhookEvent struct {
+	event  WebhookEvent
+	todoID string
+	userID string // of the owner
+	body   []byte
+}
+
+type webhookDelivery struct {
+	webhook *Webhook
+	event   *webhookEvent
+	id      string // the same for all the attempts, so that the receiver can tell the retries apart
+	attempt int
+}
+
+// WebhookDispatcher POSTs the events of the todos to the webhooks, which the owners & the collaborators of the
+// todos have registered. The events are handed over to the workers, so the resolvers never wait for the webhooks.
+// They're kept in memory meanwhile, so those not yet delivered are lost on a restart
+type WebhookDispatcher struct {
+	db         *gorm.DB
+	client     *http.Client
+	events     chan *webhookEvent
+	deliveries chan *webhookDelivery
+	logger     *Logger
+}
+
+// NewWebhookDispatcher creates an instance of WebhookDispatcher, which looks out for the changes of the todos in
+// the DB. The webhooks may reach the private addresses, like of the host itself, only when allowed
+func NewWebhookDispatcher(db *gorm.DB, privateIPs bool, logger *Logger) *WebhookDispatcher {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !privateIPs {
+		dialer.Control = refusePrivateAddress
+	}
+	d := &WebhookDispatcher{
+		db: db,
+		client: &http.Client{
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout},
+			Timeout:   webhookTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse // A redirect fails the delivery, rather than posting elsewhere
+			},
+		},
+		events:     make(chan *webhookEvent, webhookQueueSize),
+		deliveries: make(chan *webhookDelivery, webhookQueueSize),
+		logger:     logger,
+	}
+	registerCallbacks(db, func(callback *gorm.Callback) {
+		callback.Create().Register("webhooks:create", func(scope *gorm.Scope) {
+			if createdTodo, ok := scope.Value.(*Todo); ok && !scope.HasError() && scope.TableName() == "todos" {
+				if e := d.newEvent(WebhookEventCreated, createdTodo); e != nil {
+					afterCommit(scope, func() { d.queueEvent(e) })
+				}
+			}
+		})
+		callback.Update().Register("webhooks:update", func(scope *gorm.Scope) {
+			if updatedTodo, ok := scope.Value.(*Todo); ok && !scope.HasError() && scope.TableName() == "todos" {
+				if e := d.newEvent(WebhookEventUpdated, updatedTodo); e != nil {
+					afterCommit(scope, func() { d.queueEvent(e) })
+				}
+			}
+		})
+		callback.Delete().Register("webhooks:delete", func(scope *gorm.Scope) {
+			if deletedTodo, ok := scope.Value.(Todo); ok && !scope.HasError() && scope.TableName() == "todos" {
+				if e := d.newEvent(WebhookEventDeleted, &deletedTodo); e != nil {
+					afterCommit(scope, func() { d.queueEvent(e) })
+				}
+			}
+		})
+	})
+	go d.fanOut()
+	for worker := 0; worker < webhookWorkers; worker++ {
+		go d.deliver()
+	}
+	return d
+}
+
+// Notify tells the webhooks of the todos, whose reminders have fallen due
+func (d *WebhookDispatcher) Notify(todos []*Todo) {
+	for _, todo := range todos {
+		d.publish(WebhookEventReminderDue, todo)
+	}
+}
+
+// publish queues the event of the todo
+func (d *WebhookDispatcher) publish(event WebhookEvent, todo *Todo) {
+	if e := d.newEvent(event, todo); e != nil {
+		d.queueEvent(e)
+	}
+}
+
+// newEvent makes the event of the todo. The payload is made right away, as the todo may be changed once the
+// resolver goes on, and before queuing it once the transaction is committed
+func (d *WebhookDispatcher) newEvent(event WebhookEvent, todo *Todo) *webhookEvent {
+	payload := webhookPayload{
+		Event: event,
+		Todo: webhookTodo{
+			ID:         todo.ID,
+			Title:      todo.Title,
+			Notes:      make([]webhookNote, len(todo.Notes)),
+			Labels:     make([]string, len(todo.Labels)),
+			Color:      todo.Color,
+			IsPinned:   todo.IsPinned,
+			IsArchived: todo.IsArchived,
+			RemindAt:   todo.RemindAt,
+			UpdatedAt:  todo.UpdatedAt,
+		},
+		OccurredAt: time.Now().UTC(),
+	}
+	for index, note := range todo.Notes {
+		payload.Todo.Notes[index] = webhookNote{Text: note.Text, IsCompleted: note.IsCompleted}
+	}
+	for index, label := range todo.Labels {
+		payload.Todo.Labels[index] = label.Name
+	}
+	switch event {
+	case WebhookEventCreated:
+		payload.Text = fmt.Sprintf("Todo '%s' was created", todo.Title)
+	case WebhookEventUpdated:
+		payload.Text = fmt.Sprintf("Todo '%s' was updated", todo.Title)
+	case WebhookEventDeleted:
+		payload.Text = fmt.Sprintf("Todo '%s' was deleted", todo.Title)
+	case WebhookEventReminderDue:
+		payload.Text = fmt.Sprintf("Reminder: %s", todo.Title)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.logger.Errorf("Error while encoding the webhook event of todo %s -> %s", todo.ID, err)
+		return nil
+	}
+	return &webhookEvent{event: event, todoID: todo.ID, userID: todo.UserID, body: body}
+}
+
+func (d *WebhookDispatcher) queueEvent(e *webhookEvent) {
+	select {
+	case d.events <- e:
+	default:
+		d.logger.Warnf("Webhook event %s of todo %s is dropped, as too many are waiting", e.event, e.todoID)
+	}
+}
+
+// fanOut looks up the webhooks told of each event, and queues a delivery to each of them
+func (d *WebhookDispatcher) fanOut() {
+	for event := range d.events {
+		userIDs := []string{}
+		d.db.Model(&TodoCollaborator{}).Where("todo_id = ?", event.todoID).Pluck("user_id", &userIDs)
+		userIDs = append(userIDs, event.userID)
+		webhooks := []*Webhook{}
+		if err := d.db.Where("user_id IN (?)", userIDs).Find(&webhooks).Error; err != nil {
+			d.logger.Errorf("Error while looking up the webhooks of todo %s -> %s", event.todoID, err)
+			continue
+		}
+		mask := webhookEventMask([]WebhookEvent{event.event})
+		for _, webhook := range webhooks {
+			if webhook.EventMask&mask == 0 {
+				continue
+			}
+			id, _ := gonanoid.New()
+			d.queue(&webhookDelivery{webhook: webhook, event: event, id: id, attempt: 1})
+		}
+	}
+}
+
+func (d *WebhookDispatcher) queue(delivery *webhookDelivery) {
+	select {
+	case d.deliveries <- delivery:
+	default:
+		d.logger.Warnf("Webhook delivery %s to %s is dropped, as too many are waiting", delivery.id, delivery.webhook.URL)
+	}
+}
+
+// deliver POSTs the queued deliveries. Those failing on the network, or with 429 or 5xx, are retried later,
+// waiting twice as long after each attempt, while the other statuses are taken as the receiver refusing them
+func (d *WebhookDispatcher) deliver() {
+	for delivery := range d.deliveries {
+		retry, err := d.post(delivery)
+		if err == nil {
+			continue
+		}
+		if !retry || delivery.attempt >= webhookAttempts {
+			d.logger.Warnf("Webhook delivery %s to %s failed after %d attempts -> %s", delivery.id, delivery.webhook.URL, delivery.attempt, err)
+			continue
+		}
+		backoff := time.Second << (delivery.attempt - 1)
+		delivery.attempt++
+		time.AfterFunc(backoff, func() { d.queue(delivery) })
+	}
+}
+
+// post sends the payload, signed with HMAC-SHA256 of the webhook's secret in 'X-Signature', and tells whether
+// it's worth retrying on failing
+func (d *WebhookDispatcher) post(delivery *webhookDelivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.webhook.URL, bytes.NewReader(delivery.event.body))
+	if err != nil {
+		return false, err
+	}
+	mac := hmac.New(sha256.New, []byte(delivery.webhook.Secret))
+	mac.Write(delivery.event.body)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "GoogleKeepClone-Webhook")
+	request.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	request.Header.Set("X-Webhook-Event", delivery.event.event.String())
+	request.Header.Set("X-Webhook-Delivery", delivery.id)
+	response, err := d.client.Do(request)
+	if err != nil {
+		return !errors.Is(err, errWebhookAddress), err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return false, nil
+	}
+	retry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+	return retry, fmt.Errorf("the webhook responded with %s", response.Status)
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketConns tracks the open websocket connections, as they are hijacked from the
+// http.Server and aren't closed on its shutdown. The connections of each user are capped, and
+// closed after the max lifetime or once the client has been idle for long, when set
+type WebsocketConns struct {
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	users       map[string]int // connections by userID
+	maxPerUser  int            // unlimited when 0
+	maxLifetime time.Duration  // forever when 0
+	idleTimeout time.Duration  // never idle when 0
+	maxMessage  int64          // in bytes, unlimited when 0
+}
+
+// NewWebsocketConns creates an instance of WebsocketConns, with the limits of the connections
+func NewWebsocketConns(maxPerUser int, maxLifetime time.Duration, idleTimeout time.Duration, maxMessage int64) *WebsocketConns {
+	return &WebsocketConns{
+		conns:       make(map[net.Conn]struct{}),
+		users:       make(map[string]int),
+		maxPerUser:  maxPerUser,
+		maxLifetime: maxLifetime,
+		idleTimeout: idleTimeout,
+		maxMessage:  maxMessage,
+	}
+}
+
+// Track records the connections hijacked by the handler, till the handler returns. The upgrades of a user,
+// who has got the max connections already, are closed right away with the reason
+func (c *WebsocketConns) Track(h http.Handler) http.Handler {
+	rejecter := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker := &connHijacker{ResponseWriter: w, conns: c}
+		defer hijacker.untrack()
+		userID, _ := r.Context().Value(CtxUserIDKey).(string)
+		if !websocket.IsWebSocketUpgrade(r) || userID == "" {
+			h.ServeHTTP(hijacker, r)
+			return
+		}
+		c.mu.Lock()
+		if c.maxPerUser > 0 && c.users[userID] >= c.maxPerUser {
+			c.mu.Unlock()
+			// Browsers don't tell the status of a failed upgrade, but they do the reason of closing
+			if conn, err := rejecter.Upgrade(w, r, nil); err == nil {
+				message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many connections of the user")
+				conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+				conn.Close()
+			}
+			return
+		}
+		c.users[userID]++
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			if c.users[userID]--; c.users[userID] == 0 {
+				delete(c.users, userID)
+			}
+			c.mu.Unlock()
+		}()
+		h.ServeHTTP(hijacker, r)
+	})
+}
+
+// CloseAll sends a 'going away' close frame to the clients, so they reconnect elsewhere, and closes the connections.
+// It's the number of those closed
+func (c *WebsocketConns) CloseAll() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for conn := range c.conns {
+		writeCloseFrame(conn, websocket.CloseGoingAway, "")
+		conn.Close()
+	}
+	return len(c.conns)
+}
+
+// writeCloseFrame writes the close frame right on the hijacked connection, as the websocket is owned by gqlgen
+func writeCloseFrame(conn net.Conn, code int, reason string) {
+	payload := websocket.FormatCloseMessage(code, reason)
+	conn.Write(append([]byte{0x88, byte(len(payload))}, payload...)) // FIN + close opcode, unmasked from the server
+}
+
+type connHijacker struct {
+	http.ResponseWriter
+	conns    *WebsocketConns
+	conn     net.Conn
+	lifetime *time.Timer
+}
+
+func (h *connHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := h.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return conn, rw, err
+	}
+	h.conns.mu.Lock()
+	h.conns.conns[conn] = struct{}{}
+	h.conns.mu.Unlock()
+	h.conn = conn
+	if h.conns.maxLifetime > 0 {
+		h.lifetime = time.AfterFunc(h.conns.maxLifetime, func() {
+			writeCloseFrame(conn, websocket.CloseGoingAway, "max connection lifetime reached, reconnect")
+			conn.Close()
+		})
+	}
+	if h.conns.idleTimeout > 0 {
+		conn = &idleConn{Conn: conn, timeout: h.conns.idleTimeout}
+	}
+	if h.conns.maxMessage > 0 {
+		conn = &limitedConn{Conn: conn, limit: h.conns.maxMessage}
+	}
+	return conn, rw, nil
+}
+
+func (h *connHijacker) untrack() {
+	if h.conn != nil {
+		h.conns.mu.Lock()
+		delete(h.conns.conns, h.conn)
+		h.conns.mu.Unlock()
+	}
+	if h.lifetime != nil {
+		h.lifetime.Stop()
+	}
+}
+
+// idleConn fails the reads, once the client has sent nothing for the timeout. The upgrader has to read
+// through it, rather than the buffer of the http.Server, which is why its ReadBufferSize is set
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// errMessageTooBig fails the reads of the websocket, once the client has sent a message over the limit
+var errMessageTooBig = errors.New("websocket message too big")
+
+// limitedConn closes the connection, once the client sends a message over the limit. The websocket is owned by
+// gqlgen, which sets no read limit, so the frames are followed as they are read through. No close frame is sent, as
+// it may cut into a message gqlgen is writing meanwhile
+type limitedConn struct {
+	net.Conn
+	limit   int64
+	header  []byte // of the frame being read, until it's whole
+	payload int64  // left to read of the frame
+	message int64  // read of the message so far, along its continuation frames
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	for i := 0; i < n; {
+		if c.payload > 0 {
+			skipped := int64(n - i)
+			if skipped > c.payload {
+				skipped = c.payload
+			}
+			c.payload -= skipped
+			i += int(skipped)
+			continue
+		}
+		c.header = append(c.header, b[i])
+		i++
+		length, ok := frameLength(c.header)
+		if !ok {
+			continue
+		}
+		opcode := c.header[0] & 0x0f
+		c.header = c.header[:0]
+		c.payload = length
+		if opcode&0x08 != 0 {
+			continue // the control frames, like ping & close, are interleaved and small
+		}
+		if opcode != 0 {
+			c.message = 0 // a new message, rather than a continuation
+		}
+		if c.message += length; length < 0 || c.message > c.limit { // a length over 63 bits overflows
+			c.Conn.Close()
+			return 0, errMessageTooBig
+		}
+	}
+	return n, err
+}
+
+// frameLength is the payload length of the websocket frame, once its header is whole
+func frameLength(header []byte) (int64, bool) {
+	if len(header) < 2 {
+		return 0, false
+	}
+	size, lengthSize := 2, 0
+	switch header[1] & 0x7f {
+	case 126:
+		lengthSize = 2
+	case 127:
+		lengthSize = 8
+	}
+	size += lengthSize
+	if header[1]&0x80 != 0 {
+		size += 4 // the mask of the frames of the clients
+	}
+	if len(header) < size {
+		return 0, false
+	}
+	if lengthSize == 0 {
+		return int64(header[1] & 0x7f), true
+	}
+	length := int64(0)
+	for _, b := range header[2 : 2+lengthSize] {
+		length = length<<8 | int64(b)
+	}
+	return length, true
+}
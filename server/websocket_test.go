@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWebsocketServer serves the websockets tracked by the conns, which echo the messages of the clients. The user
+// is told by the header 'X-User'
+func newWebsocketServer(t *testing.T, conns *WebsocketConns) string {
+	upgrader := websocket.Upgrader{ReadBufferSize: 4096}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), CtxUserIDKey, r.Header.Get("X-User"))
+		conns.Track(echo).ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dialWebsocket(t *testing.T, url string, userID string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User": {userID}})
+	if err != nil {
+		t.Fatalf("Error while dialing -> %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// closeCode is the code the websocket is closed with, reading on till then
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return closeErr.Code
+		} else if err != nil {
+			t.Fatalf("Error while reading -> %s", err)
+		}
+	}
+}
+
+func TestWebsocketConnsCapsConnsOfUser(t *testing.T) {
+	url := newWebsocketServer(t, NewWebsocketConns(2, 0, 0, 0))
+	first, second := dialWebsocket(t, url, "alice"), dialWebsocket(t, url, "alice")
+	if code := closeCode(t, dialWebsocket(t, url, "alice")); code != websocket.ClosePolicyViolation {
+		t.Errorf("close code of the third = %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+	other := dialWebsocket(t, url, "bob")
+	for _, conn := range []*websocket.Conn{first, second, other} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+			t.Fatalf("Error while writing -> %s", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, message, err := conn.ReadMessage(); err != nil || string(message) != "ping" {
+			t.Errorf("echo = '%s', %v, want 'ping'", message, err)
+		}
+	}
+
+	first.Close()
+	time.Sleep(100 * time.Millisecond) // for the server to see it closed
+	third := dialWebsocket(t, url, "alice")
+	if err := third.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatalf("Error while writing -> %s", err)
+	}
+	third.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := third.ReadMessage(); err != nil {
+		t.Errorf("the connection in place of one closed is closed too -> %s", err)
+	}
+}
+
+func TestWebsocketConnsCloses(t *testing.T) {
+	tests := []struct {
+		name     string
+		conns    *WebsocketConns
+		closeAll bool
+		message  int // sent, of the length
+		wantCode int
+	}{
+		{"idle", NewWebsocketConns(0, 0, 100*time.Millisecond, 0), false, 0, websocket.CloseAbnormalClosure},
+		{"max lifetime", NewWebsocketConns(0, 100*time.Millisecond, 0, 0), false, 0, websocket.CloseGoingAway},
+		{"all", NewWebsocketConns(0, 0, 0, 0), true, 0, websocket.CloseGoingAway},
+		{"message too big", NewWebsocketConns(0, 0, 0, 1000), false, 2000, websocket.CloseAbnormalClosure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := dialWebsocket(t, newWebsocketServer(t, test.conns), "alice")
+			start := time.Now()
+			if test.message > 0 {
+				if err := conn.WriteMessage(websocket.TextMessage, make([]byte, test.message)); err != nil {
+					t.Fatalf("Error while writing -> %s", err)
+				}
+			}
+			if test.closeAll {
+				time.Sleep(100 * time.Millisecond) // for the upgrade to be tracked
+				if closed := test.conns.CloseAll(); closed != 1 {
+					t.Errorf("CloseAll() = %d, want 1", closed)
+				}
+			}
+			if code := closeCode(t, conn); code != test.wantCode {
+				t.Errorf("close code = %d, want %d", code, test.wantCode)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("closed after %s", elapsed)
+			}
+		})
+	}
+}
+
+// clientFrame is a masked frame of the client, of the length & of zeros
+func clientFrame(fin bool, opcode byte, length int) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 0x80|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	}
+	frame = append(frame, 1, 2, 3, 4) // the mask
+	return append(frame, make([]byte, length)...)
+}
+
+func TestLimitedConn(t *testing.T) {
+	join := func(frames ...[]byte) []byte {
+		joined := []byte{}
+		for _, frame := range frames {
+			joined = append(joined, frame...)
+		}
+		return joined
+	}
+	tests := []struct {
+		name    string
+		sent    []byte
+		wantErr bool
+	}{
+		{"within", clientFrame(true, websocket.TextMessage, 100), false},
+		{"at the limit", clientFrame(true, websocket.TextMessage, 1000), false},
+		{"over", clientFrame(true, websocket.TextMessage, 1001), true},
+		{"over in 16 bits", clientFrame(true, websocket.BinaryMessage, 40000), true},
+		{"over in 64 bits", clientFrame(true, websocket.BinaryMessage, 70000), true},
+		{"messages within", join(clientFrame(true, websocket.TextMessage, 600), clientFrame(true, websocket.TextMessage, 600)), false},
+		{"continued over", join(clientFrame(false, websocket.TextMessage, 600), clientFrame(true, 0, 600)), true},
+		{"continued within, with a ping", join(clientFrame(false, websocket.TextMessage, 400), clientFrame(true, websocket.PingMessage, 100), clientFrame(true, 0, 400)), false},
+		{"length over 63 bits", append([]byte{0x81, 0x80 | 127, 0xff, 0, 0, 0, 0, 0, 0, 0}, 1, 2, 3, 4), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			go func() {
+				client.Write(test.sent)
+				client.Close()
+			}()
+			conn := &limitedConn{Conn: server, limit: 1000}
+			buffer := make([]byte, 7) // for the headers to be split across the reads
+			var err error
+			for err == nil {
+				_, err = conn.Read(buffer)
+			}
+			if isTooBig := err == errMessageTooBig; isTooBig != test.wantErr {
+				t.Errorf("Read() error = %v, want too big %t", err, test.wantErr)
+			}
+		})
+	}
+}
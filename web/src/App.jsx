@@ -4,6 +4,8 @@ import { Router } from "@reach/router";
 import Main from "./components/Main";
 import Login from "./components/Login";
 import Register from "./components/Register";
+import Recover from "./components/Recover";
+import Confirm from "./components/Confirm";
 import { light } from "./theme";
 import { ThemeProvider, CssBaseline } from "@material-ui/core";
 
@@ -23,6 +25,8 @@ export default function App() {
           <Main path="/" />
           <Login path="/login" />
           <Register path="/register" />
+          <Recover path="/recover/*" />
+          <Confirm path="/confirm" />
         </Router>
       </ThemeProvider>
     </>
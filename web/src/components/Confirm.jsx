@@ -0,0 +1,15 @@
+import React from "react";
+import Loading from "./Loading";
+import useAxios from "axios-hooks";
+
+export default function ({ navigate, location }) {
+    const [{ loading }] = useAxios({
+        url: `/auth/confirm${location.search}`,
+        method: "GET"
+    });
+    if (!loading) { // Confirming redirects, so the result is known only on logging in
+        navigate("/login");
+        return (<></>)
+    }
+    return (<Loading />)
+}
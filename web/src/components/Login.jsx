@@ -1,6 +1,6 @@
 import React, { useState } from "react";
 import Container from "@material-ui/core/Container";
-import { Paper, TextField, Button, Typography } from "@material-ui/core";
+import { Paper, TextField, Button, Typography, MenuItem } from "@material-ui/core";
 import { makeStyles } from "@material-ui/core/styles";
 import { Link } from "@reach/router";
 import Loading from "./Loading";
@@ -36,6 +36,10 @@ const useStyles = makeStyles(theme => ({
         ...theme.custom.fontFamily.metropolis,
         paddingTop: theme.spacing(3)
     },
+    textRecoverText: {
+        ...theme.custom.fontFamily.metropolis,
+        paddingTop: theme.spacing(1)
+    },
     textNotice: {
         ...theme.custom.fontFamily.roboto,
         lineHeight: "unset",
@@ -58,6 +62,13 @@ const useStyles = makeStyles(theme => ({
         color: theme.palette.secondary.contrastText,
         textTransform: "capitalize"
     },
+    oauthButtonRoot: {
+        marginTop: theme.spacing(1.5)
+    },
+    oauthButtonText: {
+        ...theme.custom.fontFamily.metropolis,
+        textTransform: "capitalize"
+    },
     logo: {
         height: theme.spacing(7),
         padding: theme.spacing(0, 0, 1, 0)
@@ -80,6 +91,7 @@ export default function ({ navigate }) {
     const classes = useStyles();
     const [email, setEmail] = useState("");
     const [password, setPassword] = useState("");
+    const [keepSignedIn, setKeepSignedIn] = useState("0s");
     const inputProps = {
         classes: {
             root: classes.inputRoot,
@@ -97,7 +109,7 @@ export default function ({ navigate }) {
         url: "/auth/login",
         method: "POST",
         data: {
-            email, password
+            email, password, keepSignedIn
         }
     }, { manual: true });
     const onLoginClick = (event) => {
@@ -118,12 +130,19 @@ export default function ({ navigate }) {
                         <img className={classes.logo} src={`../logo.png`} alt={"logo"} />
                         <Typography className={classes.textWelcome} color="textSecondary" variant="subtitle1">Welcome back!</Typography>
                         <TextField error={result.status === "failure"} InputLabelProps={inputLabelProps} InputProps={inputProps} name="email" onChange={event => setEmail(event.target.value)} label="Email" type="email" variant="outlined" fullWidth margin="normal" />
-                        <TextField error={result.status === "failure"} InputLabelProps={inputLabelProps} InputProps={inputProps} name="password" onChange={event => setPassword(event.target.value)} label="Password" type="password" variant="outlined" fullWidth margin="normal" helperText={result.error} />
+                        <TextField error={result.status === "failure"} InputLabelProps={inputLabelProps} InputProps={inputProps} name="password" onChange={event => setPassword(event.target.value)} label="Password" type="password" variant="outlined" fullWidth margin="normal" helperText={result.error || (result.status === "failure" && result.message)} />
+                        <TextField select InputLabelProps={inputLabelProps} InputProps={inputProps} name="keepSignedIn" value={keepSignedIn} onChange={event => setKeepSignedIn(event.target.value)} label="Keep me signed in" variant="outlined" fullWidth margin="normal">
+                            <MenuItem value="0s">Until I close the browser</MenuItem>
+                            <MenuItem value="168h">For 7 days</MenuItem>
+                            <MenuItem value="720h">For 30 days</MenuItem>
+                        </TextField>
                         <Button classes={{ root: classes.loginButtonRoot, label: classes.loginButtonText }} type="submit" disabled={loading || email === "" || password === ""} variant="contained" color="secondary" disableElevation fullWidth size="large">Log In</Button>
+                        <Button classes={{ root: classes.oauthButtonRoot, label: classes.oauthButtonText }} href="/auth/oauth2/google" disabled={loading} variant="outlined" fullWidth size="large">Sign in with Google</Button>
                         <Typography className={classes.textNotice} color="textSecondary" variant="caption">Your user login &amp; data will be deleted<br />on container restart, and happens so<br />often as I'm running this on Free Tier<br /></Typography>
                     </form>
                 </Paper>
                 <Typography className={classes.textRegisterText} color="textSecondary" variant="body2">Don't have an account? <Link className={classes.textRegister} to="/register">Register</Link></Typography>
+                <Typography className={classes.textRecoverText} color="textSecondary" variant="body2">Forgot your password? <Link className={classes.textRegister} to="/recover">Reset it</Link></Typography>
             </Container>
             <Typography className={classes.textAttribution} color="textSecondary" variant="body2">Created by <a className={classes.textCreator} href="https://github.com/anselm94">Merbin J Anselm</a></Typography>
         </div>
@@ -0,0 +1,132 @@
+import React, { useState } from "react";
+import Container from "@material-ui/core/Container";
+import { Paper, TextField, Button, Typography } from "@material-ui/core";
+import { makeStyles } from "@material-ui/core/styles";
+import { Link } from "@reach/router";
+import Loading from "./Loading";
+import useAxios from "axios-hooks";
+
+const useStyles = makeStyles(theme => ({
+    pageWrapper: {
+        height: "100vh",
+        display: "flex",
+        flexDirection: "column"
+    },
+    pageContainer: {
+        display: "flex",
+        flexDirection: "column",
+        alignItems: "center",
+        justifyContent: "center",
+        flexGrow: "1"
+    },
+    boxWrapper: {
+        display: "flex",
+        flexDirection: "column",
+        alignItems: "center",
+        padding: theme.spacing(3)
+    },
+    textWelcome: {
+        ...theme.custom.fontFamily.metropolis
+    },
+    textRegister: {
+        textDecoration: "none",
+        color: theme.palette.secondary.dark
+    },
+    textRegisterText: {
+        ...theme.custom.fontFamily.metropolis,
+        paddingTop: theme.spacing(3)
+    },
+    textNotice: {
+        ...theme.custom.fontFamily.roboto,
+        lineHeight: "unset",
+        textAlign: "center",
+        paddingTop: theme.spacing(2)
+    },
+    textAttribution: {
+        padding: theme.spacing(0, 2, 2, 0),
+        textAlign: "right"
+    },
+    textCreator: {
+        textDecoration: "none",
+        color: theme.palette.secondary.dark
+    },
+    loginButtonRoot: {
+        marginTop: theme.spacing(3)
+    },
+    loginButtonText: {
+        ...theme.custom.fontFamily.metropolis,
+        color: theme.palette.secondary.contrastText,
+        textTransform: "capitalize"
+    },
+    logo: {
+        height: theme.spacing(7),
+        padding: theme.spacing(0, 0, 1, 0)
+    },
+    inputRoot: {
+        '&$inputFocused $inputNotchedOutline': {
+            borderColor: theme.palette.secondary.main
+        },
+    },
+    inputNotchedOutline: {},
+    inputFocused: {},
+    inputLabelRoot: {
+        '&$inputFocused': {
+            color: theme.palette.secondary.main
+        },
+    }
+}));
+
+export default function ({ navigate, location }) {
+    const classes = useStyles();
+    const token = new URLSearchParams(location.search).get("token");
+    const [email, setEmail] = useState("");
+    const [password, setPassword] = useState("");
+    const inputProps = {
+        classes: {
+            root: classes.inputRoot,
+            notchedOutline: classes.inputNotchedOutline,
+            focused: classes.inputFocused
+        }
+    }
+    const inputLabelProps = {
+        classes: {
+            root: classes.inputLabelRoot,
+            focused: classes.inputFocused
+        }
+    }
+    const [{ data: result = {}, loading }, doRecover] = useAxios({
+        url: token ? "/auth/recover/end" : "/auth/recover",
+        method: "POST",
+        data: token ? { token, password } : { email }
+    }, { manual: true });
+    const onRecoverClick = (event) => {
+        event.preventDefault();
+        doRecover();
+    }
+    if (result.status === "success" && token) {
+        navigate("/login");
+        return (<></>)
+    } else if (loading) {
+        return (<Loading />)
+    }
+    return (
+        <div className={classes.pageWrapper}>
+            <Container maxWidth="md" className={classes.pageContainer}>
+                <Paper elevation={3}>
+                    <form className={classes.boxWrapper} onSubmit={onRecoverClick}>
+                        <img className={classes.logo} src={`../logo.png`} alt={"logo"} />
+                        <Typography className={classes.textWelcome} color="textSecondary" variant="subtitle1">{token ? "Choose a new password" : "Forgot your password?"}</Typography>
+                        {token ? (
+                            <TextField required error={result.status === "failure"} InputLabelProps={inputLabelProps} InputProps={inputProps} name="password" onChange={event => setPassword(event.target.value)} label="New Password" type="password" variant="outlined" fullWidth margin="normal" helperText={(result.errors && result.errors["password"] && result.errors["password"][0]) || result.error} />
+                        ) : (
+                            <TextField required error={result.status === "failure"} InputLabelProps={inputLabelProps} InputProps={inputProps} name="email" onChange={event => setEmail(event.target.value)} label="Email" type="email" variant="outlined" fullWidth margin="normal" helperText={result.message || result.error} />
+                        )}
+                        <Button classes={{ root: classes.loginButtonRoot, label: classes.loginButtonText }} type="submit" disabled={loading || (token ? password === "" : email === "")} variant="contained" color="secondary" disableElevation fullWidth size="large">{token ? "Reset Password" : "Send Reset Link"}</Button>
+                    </form>
+                </Paper>
+                <Typography className={classes.textRegisterText} color="textSecondary" variant="body2">Remember your password? <Link className={classes.textRegister} to="/login">Log In</Link></Typography>
+            </Container>
+            <Typography className={classes.textAttribution} color="textSecondary" variant="body2">Created by <a className={classes.textCreator} href="https://github.com/anselm94">Merbin J Anselm</a></Typography>
+        </div>
+    )
+}
@@ -70,7 +70,7 @@ export default function ({ noteItem, isEditMode }) {
     updateTodoExecute({
       id: noteItem.id,
       title: todoItem.title || title,
-      notes: todoItem.notes || noteinputs.map((note) => { return { text: note.text, isCompleted: note.isCompleted } }),
+      notes: todoItem.notes || noteinputs.map((note) => { return { text: note.text, isCompleted: note.isCompleted, isIndented: !!(note.isIndented || note.parentId) } }),
       color: todoItem.color || color,
       isCheckboxMode: todoItem.isCheckboxMode || isCheckboxMode,
       labels: todoItem.labels || labels.map((label) => label.id)
@@ -32,6 +32,9 @@ const useStyles = makeStyles(theme => ({
     marginRight: theme.spacing(1),
     minHeight: theme.spacing(4)
   },
+  itemIndented: {
+    marginLeft: theme.spacing(5)
+  },
   inputRoot: {
     flex: 1
   },
@@ -80,7 +83,13 @@ export default function ({ notes, setNotes, isEditMode }) {
     setNotes(updatedNoteItems);
   };
   const onKeyPressed = (index, event) => {
-    if (event.keyCode === 13) { // Enter pressed, create a new row item
+    if (event.keyCode === 9 && index > 0) { // Tab pressed, nest the item under the one above, or not with Shift
+      event.preventDefault();
+      const updatedNoteItems = Object.assign([], notes);
+      const { text, isCompleted } = updatedNoteItems[index];
+      updatedNoteItems[index] = { text, isCompleted, isIndented: !event.shiftKey };
+      setNotes(updatedNoteItems);
+    } else if (event.keyCode === 13) { // Enter pressed, create a new row item
       event.preventDefault();
       var updatedNoteItems = Object.assign([], notes);
       updatedNoteItems = updatedNoteItems.filter(note => note.text !== "")
@@ -95,12 +104,13 @@ export default function ({ notes, setNotes, isEditMode }) {
 
   return (
     <>
-      {notes.map(({ text, isCompleted }, index) => (
+      {notes.map(({ text, isCompleted, isIndented, parentId }, index) => (
         <ContentListItem
           key={index}
           index={index}
           text={text}
           isCompleted={isCompleted}
+          isIndented={index > 0 && !!(isIndented || parentId)}
           isEditMode={isEditMode}
           onTextChange={onTextChange}
           onMarkCompleted={onMarkCompleted}
@@ -116,6 +126,7 @@ function ContentListItem({
   index,
   text,
   isCompleted,
+  isIndented,
   isEditMode,
   onTextChange,
   onMarkCompleted,
@@ -137,7 +148,7 @@ function ContentListItem({
       onMouseEnter={() => setHovered(true)}
       onMouseLeave={() => setHovered(false)}
     >
-      <div className={classes.itemWrapper}>
+      <div className={isIndented ? `${classes.itemWrapper} ${classes.itemIndented}` : classes.itemWrapper}>
         <Checkbox
           icon={
             (isEmpty && isEditMode) ? (
@@ -20,7 +20,7 @@ import {
   SearchOutlined as SearchIcon
 } from "@material-ui/icons";
 import { useMutation } from "urql";
-import { createLabel } from "../../gql";
+import { getOrCreateLabel } from "../../gql";
 import { useLabelsStore } from "../../store";
 
 const useStyles = makeStyles(theme => ({
@@ -89,7 +89,7 @@ export default function LabelPopover({ anchorEl, labels, setLabels, isOpen, onCl
   const filteredLabelItems = allLabelItems.filter(labelItem =>
     newLabelName === "" || labelItem.name.includes(newLabelName)
   );
-  const [, createLabelExecute] = useMutation(createLabel);
+  const [, getOrCreateLabelExecute] = useMutation(getOrCreateLabel);
   const updateLabelsForNote = (labelItem) => {
     const updatedLabelIndex = labels.findIndex(selectedLabel => selectedLabel.id === labelItem.id);
     if (updatedLabelIndex > -1) {
@@ -100,8 +100,8 @@ export default function LabelPopover({ anchorEl, labels, setLabels, isOpen, onCl
     setLabels(Object.assign([], labels));
   };
   const onCreateTodoClick = () => {
-    createLabelExecute({ name: newLabelName }).then(({ data }) => {
-      dispatchLabel({ type: "CREATED", payload: data.createLabel });
+    getOrCreateLabelExecute({ name: newLabelName }).then(({ data }) => {
+      dispatchLabel({ type: "CREATED", payload: data.getOrCreateLabel });
     });
     setNewLabelName("");
   }
@@ -0,0 +1,43 @@
+import axios from "axios";
+
+// The token is fetched once and reused, until the server rejects it
+let token = null;
+
+const csrfToken = () => {
+    if (!token) {
+        token = fetch("/csrf", { credentials: "same-origin" })
+            .then(response => response.json())
+            .then(({ token }) => token)
+            .catch(error => {
+                token = null;
+                throw error;
+            });
+    }
+    return token;
+}
+
+const resetOnRejection = response => {
+    if (response.status === 403) {
+        token = null;
+    }
+    return response;
+}
+
+// csrfFetch sends the token along with the GraphQL requests
+const csrfFetch = (url, options = {}) => csrfToken()
+    .then(token => fetch(url, { ...options, headers: { ...options.headers, "X-CSRF-Token": token } }))
+    .then(resetOnRejection);
+
+// Sends the token along with the requests to '/auth'
+axios.interceptors.request.use(config => csrfToken().then(token => {
+    config.headers["X-CSRF-Token"] = token;
+    return config;
+}));
+axios.interceptors.response.use(resetOnRejection, error => {
+    if (error.response) {
+        resetOnRejection(error.response);
+    }
+    return Promise.reject(error);
+});
+
+export { csrfToken, csrfFetch };
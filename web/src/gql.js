@@ -8,6 +8,7 @@ query GetTodos{
         notes {
             text
             isCompleted
+            parentId
         }
         labels {
             id
@@ -38,6 +39,15 @@ mutation CreateLabel ($name: String!) {
 }
 `
 
+const getOrCreateLabel = gql`
+mutation GetOrCreateLabel ($name: String!) {
+    getOrCreateLabel (name: $name) {
+        id
+        name
+    }
+}
+`
+
 const createTodo = gql`
 mutation CreateTodo ($title: String!, $notes: [String!]!, $labels: [ID]!, $color: String, $isCheckboxMode: Boolean) {
     createTodo (title: $title, notes: $notes, labels: $labels, color: $color, isCheckboxMode: $isCheckboxMode) {
@@ -46,6 +56,7 @@ mutation CreateTodo ($title: String!, $notes: [String!]!, $labels: [ID]!, $color
         notes {
             text
             isCompleted
+            parentId
         }
         labels {
             id
@@ -65,6 +76,7 @@ mutation DeleteTodo ($id: ID!) {
         notes {
             text
             isCompleted
+            parentId
         }
         labels {
             id
@@ -84,6 +96,7 @@ mutation CopyTodo ($id: ID!) {
         notes {
             text
             isCompleted
+            parentId
         }
         labels {
             id
@@ -103,6 +116,7 @@ mutation UpdateTodo ($id: ID!, $title: String, $notes: [NotesInput], $labels: [I
         notes {
             text
             isCompleted
+            parentId
         }
         labels {
             id
@@ -133,6 +147,7 @@ subscription SubcribeTodos{
         notes {
             text
             isCompleted
+            parentId
         }
         labels {
             id
@@ -160,6 +175,7 @@ subscription SubcribeLabels{
 export {
     getTodosAndLabels,
     createLabel,
+    getOrCreateLabel,
     createTodo,
     deleteTodo,
     copyTodo,
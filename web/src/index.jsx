@@ -3,6 +3,7 @@ import ReactDOM from "react-dom";
 import App from "./App";
 import { Provider as UrqlProvider, createClient, defaultExchanges, subscriptionExchange } from 'urql';
 import { SubscriptionClient } from 'subscriptions-transport-ws';
+import { csrfFetch } from './csrf';
 
 const subscriptionClient = new SubscriptionClient(
   import.meta.env.REACT_APP_WEBSOCKET_ENDPOINT,
@@ -10,6 +11,8 @@ const subscriptionClient = new SubscriptionClient(
 );
 const gqlclient = createClient({
   url: "/query",
+  fetch: csrfFetch,
+  fetchOptions: { headers: { "X-Client-Device": "web" } }, // the todos created here are told to be of the web
   exchanges: [
     ...defaultExchanges,
     subscriptionExchange({